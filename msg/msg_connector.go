@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	metricsutil "github.com/huangjunwen/platform-kit/util/metrics"
 	stan "github.com/nats-io/go-nats-streaming"
 	"github.com/rs/zerolog"
 )
@@ -48,6 +49,12 @@ type MsgConnector struct {
 	batch         int
 	fetchInterval time.Duration
 	logger        zerolog.Logger
+	registry      *metricsutil.Registry
+
+	// metrics
+	published     *metricsutil.Counter
+	failed        *metricsutil.Counter
+	batchDuration *metricsutil.Histogram
 }
 
 // Option 是用于创建 MsgConnector 的配置
@@ -80,6 +87,14 @@ func OptLogger(logger *zerolog.Logger) Option {
 	}
 }
 
+// OptMetrics 设置指标注册到的注册表，默认为 metricsutil.DefaultRegistry；为 nil 时不记录指标
+func OptMetrics(registry *metricsutil.Registry) Option {
+	return func(c *MsgConnector) error {
+		c.registry = registry
+		return nil
+	}
+}
+
 // NewMsgConnector 创建一个 MsgConnector
 func NewMsgConnector(sc stan.Conn, src MsgStore, opts ...Option) (*MsgConnector, error) {
 	ret := &MsgConnector{
@@ -90,6 +105,7 @@ func NewMsgConnector(sc stan.Conn, src MsgStore, opts ...Option) (*MsgConnector,
 		batch:         DefaultOptBatch,
 		fetchInterval: DefaultOptFetchInterval,
 		logger:        zerolog.Nop(),
+		registry:      metricsutil.DefaultRegistry,
 	}
 
 	for _, opt := range opts {
@@ -98,6 +114,12 @@ func NewMsgConnector(sc stan.Conn, src MsgStore, opts ...Option) (*MsgConnector,
 		}
 	}
 
+	if ret.registry != nil {
+		ret.published = ret.registry.Counter("msg_published_total", "Total number of messages published by MsgConnector.").With()
+		ret.failed = ret.registry.Counter("msg_failed_total", "Total number of messages failed to publish by MsgConnector.").With()
+		ret.batchDuration = ret.registry.Histogram("msg_batch_duration_seconds", "Duration of publishing a batch of messages by MsgConnector.", nil).With()
+	}
+
 	go ret.loop()
 	return ret, nil
 }
@@ -129,6 +151,7 @@ func (c *MsgConnector) loop() {
 			}
 
 			// 开始发送
+			batchStartTime := time.Now()
 			var (
 				id2Msg  = make(map[string]int)
 				wg      sync.WaitGroup
@@ -181,6 +204,11 @@ func (c *MsgConnector) loop() {
 			// 一些统计
 			nMsgs += len(msgs)
 			nSuccess += len(success)
+			if c.registry != nil {
+				c.published.Add(float64(len(success)))
+				c.failed.Add(float64(len(msgs) - len(success)))
+				c.batchDuration.Observe(time.Since(batchStartTime).Seconds())
+			}
 
 		}
 		dur := time.Since(startTime)
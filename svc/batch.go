@@ -0,0 +1,363 @@
+package libsvc
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchCall 代表批量调用中的一个调用
+type BatchCall struct {
+	// Service 为所调用的服务
+	Service Service
+
+	// Method 为所调用的方法，Input/Output 必须满足其定义的类型
+	Method Method
+	Input  interface{}
+	Output interface{}
+
+	// Err 为该调用的错误，由 InvokeBatch 设置；仅当 Err 为 nil 时 Output 有效
+	Err error
+}
+
+// BatchService 可以由 Service 实现以支持在一次往返中调用多个方法
+type BatchService interface {
+	Service
+
+	// InvokeBatch 调用多个方法，calls 中的 Service 都是该服务本身；各个调用的错误设置在其 Err 中
+	InvokeBatch(ctx context.Context, calls []*BatchCall)
+}
+
+// batch 汇总经过中间件的批量调用中的各个子调用，所有子调用都到达中间件链的最内层（或者提前返回）后一次过调用
+type batch struct {
+	t  *terminal
+	bs BatchService
+	// InvokeBatch 的 ctx
+	ctx context.Context
+
+	mu sync.Mutex
+	// 还没有到达最内层且没有返回的子调用数
+	remaining int
+	arrived   []*batchSlot
+}
+
+// batchSlot 为批量调用中的一个子调用
+type batchSlot struct {
+	batch *batch
+	index int
+	// 已经到达过最内层或者已经返回，由 batch.mu 保护
+	used bool
+
+	// 到达最内层时设置
+	ctx  context.Context
+	call *BatchCall
+	done chan struct{}
+}
+
+type batchSlotKeyType struct{}
+
+var batchSlotKey = batchSlotKeyType{}
+
+var (
+	_ BatchService = (*rpcClientService)(nil)
+	_ BatchService = (*decSvc)(nil)
+	_ BatchService = (*decSvcWithItf)(nil)
+)
+
+// InvokeBatch 批量调用多个方法，这些方法可以属于不同的服务：同一个服务的调用若该服务实现了 BatchService
+// 则一次过发出，否则并发地逐个调用（并发数不超过 DefaultBatchConcurrency）；各个调用的错误设置在其 Err 中，
+// 返回值为第一个出错的调用的错误
+func InvokeBatch(ctx context.Context, calls ...*BatchCall) error {
+	// 按服务分组，保持原来的顺序
+	groups := map[interface{}][]*BatchCall{}
+	keys := []interface{}{}
+	for i, call := range calls {
+		key := batchGroupKey(call.Service, i)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], call)
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, key := range keys {
+		group := groups[key]
+		svc := group[0].Service
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if bs, ok := svc.(BatchService); ok {
+				bs.InvokeBatch(ctx, group)
+				return
+			}
+			invokeEach(group, func(call *BatchCall) error {
+				return call.Service.Invoke(ctx, call.Method, call.Input, call.Output)
+			})
+		}()
+	}
+	wg.Wait()
+
+	for _, call := range calls {
+		if call.Err != nil {
+			return call.Err
+		}
+	}
+	return nil
+}
+
+// batchGroupKey 返回按服务分组所用的 key：不可比较的 Service（例如基于 func 或 map 的）不能作为 map 的 key，
+// 这时使用调用的序号，即单独一组
+func batchGroupKey(svc Service, i int) interface{} {
+	if v := reflect.ValueOf(svc); !v.IsValid() || !v.Comparable() {
+		return i
+	}
+	return svc
+}
+
+// invokeEach 使用 invoke 并发地逐个调用，并发数不超过 DefaultBatchConcurrency，全部完成后返回
+func invokeEach(calls []*BatchCall, invoke func(call *BatchCall) error) {
+	n := DefaultBatchConcurrency
+	if n < 1 {
+		n = 1
+	}
+	sem := make(chan struct{}, n)
+	wg := &sync.WaitGroup{}
+	for _, call := range calls {
+		call := call
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			call.Err = invoke(call)
+		}()
+	}
+	wg.Wait()
+}
+
+// InvokeBatch 实现 BatchService 接口，每个子调用都经过中间件，见 invokeBatchThrough
+func (svc *decSvc) InvokeBatch(ctx context.Context, calls []*BatchCall) {
+	invokeBatchThrough(context.WithValue(ctx, svcNameKey, svc.svc.Name()), svc.t, svc.h, calls)
+}
+
+// InvokeBatch 实现 BatchService 接口，每个子调用都经过中间件，见 invokeBatchThrough
+func (svc *decSvcWithItf) InvokeBatch(ctx context.Context, calls []*BatchCall) {
+	invokeBatchThrough(context.WithValue(ctx, svcNameKey, svc.svc.Name()), svc.t, svc.h, calls)
+}
+
+// invokeBatchThrough 通过中间件链 h 批量调用：每个子调用分别经过中间件，到达最内层 t 后汇总起来，
+// 一次过交给被装饰的服务的 InvokeBatch；被装饰的服务不支持批量调用时逐个调用
+func invokeBatchThrough(ctx context.Context, t *terminal, h ServiceHandler, calls []*BatchCall) {
+	bs, ok := t.svc.(BatchService)
+	if !ok {
+		invokeEach(calls, func(call *BatchCall) error {
+			return h(ctx, call.Method, call.Input, call.Output)
+		})
+		return
+	}
+
+	// NOTE: 子调用在最内层等待汇总，因此这里不能限制并发数，否则会死锁；真正的调用只有一次
+	b := &batch{
+		t:         t,
+		bs:        bs,
+		ctx:       ctx,
+		remaining: len(calls),
+	}
+	wg := &sync.WaitGroup{}
+	for i, call := range calls {
+		call := call
+		slot := &batchSlot{
+			batch: b,
+			index: i,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			call.Err = h(context.WithValue(ctx, batchSlotKey, slot), call.Method, call.Input, call.Output)
+			b.leave(slot)
+		}()
+	}
+	wg.Wait()
+}
+
+func batchSlotFromContext(ctx context.Context) *batchSlot {
+	slot, _ := ctx.Value(batchSlotKey).(*batchSlot)
+	return slot
+}
+
+// arrive 在子调用到达最内层时调用，等待汇总后的调用完成并返回该子调用的错误；
+// 若该子调用已经到达过最内层（例如被重试），则返回 false，应当直接调用
+func (b *batch) arrive(ctx context.Context, slot *batchSlot, method Method, input, output interface{}) (bool, error) {
+	b.mu.Lock()
+	if slot.used {
+		b.mu.Unlock()
+		return false, nil
+	}
+	slot.used = true
+	slot.ctx = ctx
+	slot.call = &BatchCall{
+		Service: b.bs,
+		Method:  method,
+		Input:   input,
+		Output:  output,
+	}
+	slot.done = make(chan struct{})
+	b.arrived = append(b.arrived, slot)
+	b.remaining--
+	flush := b.remaining == 0
+	b.mu.Unlock()
+
+	if flush {
+		b.flush()
+	}
+	<-slot.done
+	return true, slot.call.Err
+}
+
+// leave 在子调用返回后调用，若子调用没有到达最内层（例如被中间件拒绝）则不再等待它
+func (b *batch) leave(slot *batchSlot) {
+	b.mu.Lock()
+	if slot.used {
+		b.mu.Unlock()
+		return
+	}
+	slot.used = true
+	b.remaining--
+	flush := b.remaining == 0
+	b.mu.Unlock()
+
+	if flush {
+		b.flush()
+	}
+}
+
+// flush 将到达最内层的子调用按原来的顺序交给被装饰的服务：中间件可能为各个子调用设置了不同的元数据，
+// 元数据相同的子调用作为一批，使用其中最早的截止时间
+func (b *batch) flush() {
+	sort.Slice(b.arrived, func(i, j int) bool {
+		return b.arrived[i].index < b.arrived[j].index
+	})
+
+	keys := []string{}
+	groups := map[string][]*batchSlot{}
+	for _, slot := range b.arrived {
+		key := metadataKey(OutgoingMetadata(slot.ctx))
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], slot)
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, key := range keys {
+		group := groups[key]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				for _, slot := range group {
+					close(slot.done)
+				}
+			}()
+
+			ctx := WithOutgoingMetadata(WithIncomingMetadata(b.ctx, nil), OutgoingMetadata(group[0].ctx))
+			deadline, hasDeadline := time.Time{}, false
+			calls := make([]*BatchCall, 0, len(group))
+			for _, slot := range group {
+				if d, ok := slot.ctx.Deadline(); ok && (!hasDeadline || d.Before(deadline)) {
+					deadline, hasDeadline = d, true
+				}
+				calls = append(calls, slot.call)
+			}
+			if hasDeadline {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, deadline)
+				defer cancel()
+			}
+			b.bs.InvokeBatch(ctx, calls)
+		}()
+	}
+	wg.Wait()
+}
+
+// metadataKey 将元数据序列化为字符串用于分组
+func metadataKey(kv map[string]string) string {
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b := &strings.Builder{}
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte(0)
+		b.WriteString(kv[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// InvokeBatch 实现 BatchService 接口，若协议不支持批量请求则逐个调用
+func (svc *rpcClientService) InvokeBatch(ctx context.Context, calls []*BatchCall) {
+	client := svc.client
+	protocol, ok := client.protocol.Protocol().(RPCClientBatchProtocol)
+	if !ok {
+		invokeEach(calls, func(call *BatchCall) error {
+			return svc.Invoke(ctx, call.Method, call.Input, call.Output)
+		})
+		return
+	}
+
+	// 首先检查一下 input/output type
+	methodNames := make([]string, 0, len(calls))
+	inputs := make([]interface{}, 0, len(calls))
+	outputs := make([]interface{}, 0, len(calls))
+	for _, call := range calls {
+		call.Method.AssertInputType(call.Input)
+		call.Method.AssertOutputType(call.Output)
+		methodNames = append(methodNames, call.Method.Name())
+		inputs = append(inputs, call.Input)
+		outputs = append(outputs, call.Output)
+	}
+
+	errs, err := svc.invokeBatch(ctx, protocol, methodNames, inputs, outputs)
+	for i, call := range calls {
+		if err != nil {
+			call.Err = err
+		} else {
+			call.Err = errs[i]
+		}
+	}
+}
+
+func (svc *rpcClientService) invokeBatch(ctx context.Context, protocol RPCClientBatchProtocol,
+	methodNames []string, inputs, outputs []interface{}) ([]error, error) {
+
+	if err := setTimeout(ctx, protocol); err != nil {
+		return nil, err
+	}
+
+	// 发现服务
+	requestor, err := svc.client.transport.Discover(ctx, svc.name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 远程调用
+	respReader, err := requestor.Invoke(ctx, func(reqWriter io.Writer) error {
+		// 入参 -> RPC 批量请求
+		return protocol.ProcessBatchInput(reqWriter, methodNames, inputs, Passthru(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// RPC 批量响应 -> 出参
+	return protocol.ProcessBatchOutput(respReader, outputs)
+}
@@ -0,0 +1,143 @@
+package libsvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	addMethod = NewTypedMethod[addInput, addOutput]("add")
+)
+
+func TestInvokeBatch(t *testing.T) {
+	a := assert.New(t)
+
+	svc1 := NewLocalService("batch.svc1", addMethod, addMethod.Handler(func(_ context.Context, input *addInput, output *addOutput) error {
+		output.Sum = input.A + input.B
+		return nil
+	}))
+	svc2 := NewLocalService("batch.svc2", noopMethod, MethodHandlerFunc(func(context.Context, interface{}, interface{}) error {
+		return nil
+	}))
+
+	calls := []*BatchCall{
+		{Service: svc1, Method: addMethod, Input: &addInput{1, 2}, Output: &addOutput{}},
+		{Service: svc2, Method: noopMethod, Input: noopMethod.GenInput(), Output: noopMethod.GenOutput()},
+		{Service: svc1, Method: addMethod, Input: &addInput{3, 4}, Output: &addOutput{}},
+		{Service: svc2, Method: addMethod, Input: &addInput{}, Output: &addOutput{}},
+	}
+	a.Equal(ErrMethodNotFound, InvokeBatch(context.Background(), calls...))
+	a.NoError(calls[0].Err)
+	a.Equal(3, calls[0].Output.(*addOutput).Sum)
+	a.NoError(calls[1].Err)
+	a.NoError(calls[2].Err)
+	a.Equal(7, calls[2].Output.(*addOutput).Sum)
+	a.Equal(ErrMethodNotFound, calls[3].Err)
+
+	a.NoError(InvokeBatch(context.Background()))
+
+	// 不可比较的 Service 不会令分组 panic
+	fn := funcService(func(_ context.Context, _ Method, input, output interface{}) error {
+		output.(*addOutput).Sum = input.(*addInput).A
+		return nil
+	})
+	calls = []*BatchCall{
+		{Service: fn, Method: addMethod, Input: &addInput{A: 1}, Output: &addOutput{}},
+		{Service: fn, Method: addMethod, Input: &addInput{A: 2}, Output: &addOutput{}},
+	}
+	a.NoError(InvokeBatch(context.Background(), calls...))
+	a.Equal(1, calls[0].Output.(*addOutput).Sum)
+	a.Equal(2, calls[1].Output.(*addOutput).Sum)
+}
+
+// funcService 是基于 func 的 Service，不可比较
+type funcService func(ctx context.Context, method Method, input, output interface{}) error
+
+func (fn funcService) Name() string {
+	return "batch.func"
+}
+
+func (fn funcService) Invoke(ctx context.Context, method Method, input, output interface{}) error {
+	return fn(ctx, method, input, output)
+}
+
+// recordBatchService 记录 InvokeBatch 收到的各批调用
+type recordBatchService struct {
+	ServiceWithInterface
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (svc *recordBatchService) InvokeBatch(ctx context.Context, calls []*BatchCall) {
+	tenant := OutgoingMetadata(ctx)["tenant"]
+	names := []string{}
+	for _, call := range calls {
+		call.Err = svc.Invoke(ctx, call.Method, call.Input, call.Output)
+		names = append(names, tenant+":"+call.Input.(*addInput).String())
+	}
+	svc.mu.Lock()
+	svc.batches = append(svc.batches, names)
+	svc.mu.Unlock()
+}
+
+func (input *addInput) String() string {
+	return fmt.Sprintf("%d+%d", input.A, input.B)
+}
+
+func TestInvokeBatchMiddleware(t *testing.T) {
+	a := assert.New(t)
+
+	inner := &recordBatchService{
+		ServiceWithInterface: NewLocalService("batch.mw", addMethod, addMethod.Handler(func(_ context.Context, input *addInput, output *addOutput) error {
+			output.Sum = input.A + input.B
+			return nil
+		})),
+	}
+	errDenied := errors.New("denied")
+	mu := &sync.Mutex{}
+	seen := []string{}
+	mw := func(h ServiceHandler) ServiceHandler {
+		return func(ctx context.Context, method Method, input, output interface{}) error {
+			in := input.(*addInput)
+			mu.Lock()
+			seen = append(seen, in.String())
+			mu.Unlock()
+			if in.A < 0 {
+				return errDenied
+			}
+			// 中间件可以为子调用设置不同的元数据
+			if in.B > 100 {
+				ctx = WithOutgoingMetadata(ctx, map[string]string{"tenant": "t2"})
+			}
+			return h(ctx, method, input, output)
+		}
+	}
+
+	for _, svc := range []Service{
+		DecorateService(inner, mw),
+		DecorateServiceWithInterface(inner, mw),
+	} {
+		inner.batches = nil
+		seen = seen[:0]
+		calls := []*BatchCall{
+			{Service: svc, Method: addMethod, Input: &addInput{1, 2}, Output: &addOutput{}},
+			{Service: svc, Method: addMethod, Input: &addInput{-1, 2}, Output: &addOutput{}},
+			{Service: svc, Method: addMethod, Input: &addInput{3, 4}, Output: &addOutput{}},
+			{Service: svc, Method: addMethod, Input: &addInput{5, 101}, Output: &addOutput{}},
+		}
+		a.Equal(errDenied, InvokeBatch(context.Background(), calls...))
+
+		// 每个子调用都经过中间件，通过的子调用按元数据汇总为批量调用
+		a.ElementsMatch([]string{"1+2", "-1+2", "3+4", "5+101"}, seen)
+		a.ElementsMatch([][]string{{":1+2", ":3+4"}, {"t2:5+101"}}, inner.batches)
+		a.Equal(3, calls[0].Output.(*addOutput).Sum)
+		a.Equal(errDenied, calls[1].Err)
+		a.Equal(7, calls[2].Output.(*addOutput).Sum)
+		a.Equal(106, calls[3].Output.(*addOutput).Sum)
+	}
+}
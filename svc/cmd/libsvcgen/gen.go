@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	libsvcImportPath = "github.com/huangjunwen/platform-kit/svc"
+)
+
+var (
+	// 生成的代码中固定的 import：路径 -> 名字
+	fixedImports = map[string]string{
+		"context":        "context",
+		libsvcImportPath: "libsvc",
+	}
+
+	// 生成的代码中已经使用了的名字（固定的 import 以及函数中的变量），import 的别名不能与之相同
+	reservedNames = map[string]bool{
+		"context": true,
+		"libsvc":  true,
+		"ctx":     true,
+		"input":   true,
+		"output":  true,
+		"result":  true,
+		"err":     true,
+		"impl":    true,
+		"c":       true,
+		"client":  true,
+		"svcName": true,
+	}
+)
+
+// genData 是模板所需的数据
+type genData struct {
+	Package string
+	Type    string
+	Imports []genImport
+	Methods []genMethod
+}
+
+type genImport struct {
+	// 总是带有别名，即源文件中使用的包名，因此不需要知道包的真实名字
+	Name string
+	Path string
+}
+
+type genMethod struct {
+	Name string
+	In   string
+	Out  string
+}
+
+var (
+	genTmpl = template.Must(template.New("libsvcgen").Parse(`// Code generated by libsvcgen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"context"
+
+	libsvc "` + libsvcImportPath + `"
+{{- range .Imports }}
+	{{ .Name }} "{{ .Path }}"
+{{- end }}
+)
+
+{{ $type := .Type -}}
+var (
+{{- range .Methods }}
+	// {{ $type }}{{ .Name }}Method 为 {{ $type }}.{{ .Name }} 的方法定义
+	{{ $type }}{{ .Name }}Method = libsvc.NewTypedMethod[{{ .In }}, {{ .Out }}]("{{ .Name }}")
+{{- end }}
+
+	// {{ $type }}Interface 为 {{ $type }} 的接口定义
+	{{ $type }}Interface = libsvc.NewInterface(
+{{- range .Methods }}
+		{{ $type }}{{ .Name }}Method,
+{{- end }}
+	)
+)
+
+// {{ $type }}Client 为 {{ $type }} 的客户端
+type {{ $type }}Client struct {
+	svc libsvc.Service
+}
+
+var (
+	_ {{ $type }} = (*{{ $type }}Client)(nil)
+)
+
+// New{{ $type }}Client 使用 client 创建名为 svcName 的服务的客户端
+func New{{ $type }}Client(client libsvc.ServiceClient, svcName string) *{{ $type }}Client {
+	return &{{ $type }}Client{
+		svc: client.Make(svcName),
+	}
+}
+{{ range .Methods }}
+// {{ .Name }} 调用远程服务的 {{ .Name }} 方法
+func (c *{{ $type }}Client) {{ .Name }}(ctx context.Context, input *{{ .In }}) (*{{ .Out }}, error) {
+	return {{ $type }}{{ .Name }}Method.Invoke(ctx, c.svc, input)
+}
+{{ end }}
+// New{{ $type }}Service 将 {{ $type }} 的实现 impl 适配为名为 svcName 的服务
+func New{{ $type }}Service(svcName string, impl {{ $type }}) libsvc.ServiceWithInterface {
+	return libsvc.NewLocalService(
+		svcName,
+{{- range .Methods }}
+		{{ $type }}{{ .Name }}Method, {{ $type }}{{ .Name }}Method.Handler(func(ctx context.Context, input *{{ .In }}, output *{{ .Out }}) error {
+			result, err := impl.{{ .Name }}(ctx, input)
+			if err != nil {
+				return err
+			}
+			if result != nil {
+				*output = *result
+			}
+			return nil
+		}),
+{{- end }}
+	)
+}
+`))
+)
+
+// generate 从源文件 src 中找出名为 typeName 的 interface 并生成代码
+func generate(filename string, src []byte, typeName string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	itf := findInterface(file, typeName)
+	if itf == nil {
+		return nil, fmt.Errorf("interface %+q not found in %s", typeName, filename)
+	}
+
+	// 文件中的 import：名字 -> 路径；有别名的优先，没有别名的只能按路径猜测包名
+	fileImports := map[string]string{}
+	for _, spec := range file.Imports {
+		if spec.Name != nil {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			fileImports[spec.Name.Name] = path
+		}
+	}
+	for _, spec := range file.Imports {
+		if spec.Name == nil {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			for _, name := range importNames(path) {
+				if _, ok := fileImports[name]; !ok {
+					fileImports[name] = path
+				}
+			}
+		}
+	}
+
+	data := &genData{
+		Package: file.Name.Name,
+		Type:    typeName,
+	}
+	// 源文件中的包名 -> 生成的代码中的别名
+	aliases := map[string]string{}
+	aliasOf := func(name, path string) string {
+		if alias, ok := aliases[name]; ok {
+			return alias
+		}
+		alias, ok := fixedImports[path]
+		if !ok {
+			alias = name
+			for i := 2; reservedNames[alias] || (alias != name && fileImports[alias] != "") || isAlias(aliases, alias); i++ {
+				alias = name + strconv.Itoa(i)
+			}
+		}
+		aliases[name] = alias
+		return alias
+	}
+	usedImports := map[string]genImport{}
+	for _, field := range itf.Methods.List {
+		fn, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded interface is not supported", fset.Position(field.Pos()))
+		}
+		in, out, err := checkSignature(fn)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s.%s %s", fset.Position(field.Pos()), typeName, field.Names[0].Name, err)
+		}
+
+		method := genMethod{Name: field.Names[0].Name}
+		for _, t := range []struct {
+			expr ast.Expr
+			dst  *string
+		}{{in, &method.In}, {out, &method.Out}} {
+			// 收集所用到的 import，生成的代码中以源文件中使用的包名作为别名，跟生成的代码冲突时改名
+			var unresolved *ast.Ident
+			ast.Inspect(t.expr, func(node ast.Node) bool {
+				if sel, ok := node.(*ast.SelectorExpr); ok {
+					if x, ok := sel.X.(*ast.Ident); ok {
+						if path, ok := fileImports[x.Name]; ok {
+							x.Name = aliasOf(x.Name, path)
+							usedImports[x.Name] = genImport{Name: x.Name, Path: path}
+						} else if unresolved == nil {
+							unresolved = x
+						}
+					}
+					return false
+				}
+				return true
+			})
+			if unresolved != nil {
+				return nil, fmt.Errorf("%s: can't find the import of package %q, import it with an explicit name", fset.Position(unresolved.Pos()), unresolved.Name)
+			}
+			buf := &bytes.Buffer{}
+			if err := printer.Fprint(buf, fset, t.expr); err != nil {
+				return nil, err
+			}
+			*t.dst = buf.String()
+		}
+		data.Methods = append(data.Methods, method)
+	}
+	if len(data.Methods) == 0 {
+		return nil, fmt.Errorf("interface %+q has no method", typeName)
+	}
+
+	for _, imp := range usedImports {
+		if _, ok := fixedImports[imp.Path]; ok {
+			continue
+		}
+		data.Imports = append(data.Imports, imp)
+	}
+	sort.Slice(data.Imports, func(i, j int) bool {
+		return data.Imports[i].Path < data.Imports[j].Path
+	})
+
+	buf := &bytes.Buffer{}
+	if err := genTmpl.Execute(buf, data); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// findInterface 在文件中查找名为 typeName 的 interface 定义
+func findInterface(file *ast.File, typeName string) *ast.InterfaceType {
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if ts.Name.Name != typeName {
+				continue
+			}
+			itf, _ := ts.Type.(*ast.InterfaceType)
+			return itf
+		}
+	}
+	return nil
+}
+
+// checkSignature 检查方法签名是否为 func(context.Context, *In) (*Out, error)，返回 In 和 Out
+func checkSignature(fn *ast.FuncType) (in, out ast.Expr, err error) {
+	params := flattenFields(fn.Params)
+	results := flattenFields(fn.Results)
+	if len(params) != 2 || len(results) != 2 {
+		return nil, nil, fmt.Errorf("should be func(context.Context, *In) (*Out, error)")
+	}
+	if !isSelector(params[0], "context", "Context") {
+		return nil, nil, fmt.Errorf("first param should be context.Context")
+	}
+	inPtr, ok := params[1].(*ast.StarExpr)
+	if !ok {
+		return nil, nil, fmt.Errorf("second param should be a pointer")
+	}
+	outPtr, ok := results[0].(*ast.StarExpr)
+	if !ok {
+		return nil, nil, fmt.Errorf("first result should be a pointer")
+	}
+	if ident, ok := results[1].(*ast.Ident); !ok || ident.Name != "error" {
+		return nil, nil, fmt.Errorf("second result should be error")
+	}
+	return inPtr.X, outPtr.X, nil
+}
+
+// flattenFields 将 (a, b T) 展开为 [T, T]
+func flattenFields(fields *ast.FieldList) []ast.Expr {
+	if fields == nil {
+		return nil
+	}
+	ret := []ast.Expr{}
+	for _, field := range fields.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			ret = append(ret, field.Type)
+		}
+	}
+	return ret
+}
+
+func isSelector(expr ast.Expr, x, sel string) bool {
+	s, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := s.X.(*ast.Ident)
+	return ok && ident.Name == x && s.Sel.Name == sel
+}
+
+func isAlias(aliases map[string]string, name string) bool {
+	for _, alias := range aliases {
+		if alias == name {
+			return true
+		}
+	}
+	return false
+}
+
+// importNames 返回没有别名的 import 可能的包名：一般为路径的最后一段，但也常见形如
+// "go-xxx"，"xxx-go"，"xxx.v2" 以及 ".../xxx/v2" 这样的路径
+func importNames(path string) []string {
+	seg := lastSegment(path)
+	if len(seg) > 1 && seg[0] == 'v' && strings.Trim(seg[1:], "0123456789") == "" && seg != path {
+		seg = lastSegment(path[:len(path)-len(seg)-1])
+	}
+	if i := strings.Index(seg, ".v"); i > 0 {
+		seg = seg[:i]
+	}
+	names := []string{seg}
+	trimmed := strings.TrimSuffix(strings.TrimPrefix(seg, "go-"), "-go")
+	trimmed = strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return -1
+		}
+		return r
+	}, trimmed)
+	if trimmed != seg {
+		names = append(names, trimmed)
+	}
+	return names
+}
+
+func lastSegment(path string) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == '/' {
+			return path[i+1:]
+		}
+	}
+	return path
+}
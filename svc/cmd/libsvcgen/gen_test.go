@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	update = flag.Bool("update", false, "update golden files")
+)
+
+func TestGenerateGolden(t *testing.T) {
+	a := assert.New(t)
+
+	for srcFile, typeName := range map[string]string{
+		"testdata/calc.go": "Calc",
+	} {
+		src, err := ioutil.ReadFile(srcFile)
+		a.NoError(err)
+
+		code, err := generate(srcFile, src, typeName)
+		a.NoError(err)
+
+		goldenFile := srcFile[:len(srcFile)-len(filepath.Ext(srcFile))] + ".golden"
+		if *update {
+			a.NoError(ioutil.WriteFile(goldenFile, code, 0644))
+			continue
+		}
+		expect, err := ioutil.ReadFile(goldenFile)
+		a.NoError(err)
+		a.Equal(string(expect), string(code), "Generated code of %s mismatch with %s, run with -update to regenerate", srcFile, goldenFile)
+
+		// 生成的代码需要能跟源文件一起通过类型检查
+		a.NoError(typeCheck(srcFile, src, goldenFile, expect))
+	}
+}
+
+// typeCheck 对源文件以及生成的代码一起做类型检查
+func typeCheck(srcFile string, src []byte, genFile string, gen []byte) error {
+	fset := token.NewFileSet()
+	files := []*ast.File{}
+	for filename, content := range map[string][]byte{
+		srcFile: src,
+		genFile: gen,
+	} {
+		file, err := parser.ParseFile(fset, filename, content, 0)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+	}
+	_, err := conf.Check(files[0].Name.Name, fset, files, nil)
+	return err
+}
+
+func TestGenerateError(t *testing.T) {
+	a := assert.New(t)
+
+	for src, desc := range map[string]string{
+		"package x\ntype Other interface{}":          "interface not found",
+		"package x\ntype Svc struct{}":               "not an interface",
+		"package x\ntype Svc interface{}":            "no method",
+		"package x\ntype Svc interface{ io.Reader }": "embedded interface",
+		"package x\nimport \"context\"\ntype Svc interface{ M(ctx context.Context, in In) (*Out, error) }":    "input not ptr",
+		"package x\nimport \"context\"\ntype Svc interface{ M(ctx context.Context, in *In) (Out, error) }":    "output not ptr",
+		"package x\nimport \"context\"\ntype Svc interface{ M(ctx context.Context, in *In) (*Out, bool) }":    "no error result",
+		"package x\nimport \"context\"\ntype Svc interface{ M(ctx context.Context, in *In, out *Out) error }": "libsvc handler shape",
+		"package x\ntype Svc interface{ M(in *In) (*Out, error) }":                                            "missing ctx",
+		"package x\nimport \"context\"\ntype Svc interface{ M(ctx context.Context, in *y.In) (*Out, error) }": "unknown package",
+	} {
+		_, err := generate("x.go", []byte(src), "Svc")
+		a.Error(err, "Expect error since %s", desc)
+	}
+}
+
+func TestImportNames(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal([]string{"time"}, importNames("time"))
+	a.Equal([]string{"json"}, importNames("encoding/json"))
+	a.Equal([]string{"go-nats", "nats"}, importNames("github.com/nats-io/go-nats"))
+	a.Equal([]string{"yaml"}, importNames("gopkg.in/yaml.v2"))
+	a.Equal([]string{"redis"}, importNames("github.com/go-redis/redis/v8"))
+	a.Equal([]string{"v8"}, importNames("v8"))
+
+	// 生成的代码中总是带有别名
+	code, err := generate("x.go", []byte(`package x
+import (
+	"context"
+	"github.com/nats-io/go-nats"
+)
+type Svc interface{ M(ctx context.Context, in *nats.Msg) (*Out, error) }`), "Svc")
+	a.NoError(err)
+	a.Contains(string(code), `nats "github.com/nats-io/go-nats"`)
+}
+
+func TestImportAlias(t *testing.T) {
+	a := assert.New(t)
+
+	// 与生成的代码中的名字冲突时改名
+	code, err := generate("x.go", []byte(`package x
+import (
+	"context"
+	libsvc "example.com/other/libsvc"
+	ctx "example.com/other/ctx"
+	ctx2 "example.com/other/ctx2"
+)
+type Svc interface{
+	M1(ctx context.Context, in *libsvc.In) (*ctx.Out, error)
+	M2(ctx context.Context, in *ctx2.In) (*libsvc.Out, error)
+}`), "Svc")
+	a.NoError(err)
+	a.Contains(string(code), `libsvc2 "example.com/other/libsvc"`)
+	a.Contains(string(code), `ctx3 "example.com/other/ctx"`)
+	a.Contains(string(code), `ctx2 "example.com/other/ctx2"`)
+	a.Contains(string(code), `libsvc.NewTypedMethod[libsvc2.In, ctx3.Out]("M1")`)
+	a.Contains(string(code), `libsvc.NewTypedMethod[ctx2.In, libsvc2.Out]("M2")`)
+
+	// 固定的 import 使用固定的名字
+	code, err = generate("x.go", []byte(`package x
+import (
+	"context"
+	lsvc "github.com/huangjunwen/platform-kit/svc"
+)
+type Svc interface{ M(ctx context.Context, in *lsvc.BatchCall) (*Out, error) }`), "Svc")
+	a.NoError(err)
+	a.Contains(string(code), `libsvc.NewTypedMethod[libsvc.BatchCall, Out]("M")`)
+	a.NotContains(string(code), "lsvc")
+}
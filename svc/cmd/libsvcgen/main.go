@@ -0,0 +1,57 @@
+// libsvcgen 从一个普通的 go interface 生成 libsvc 的方法定义，客户端以及服务端适配器，
+// interface 中的方法必须形如：
+//
+//	Method(ctx context.Context, input *In) (*Out, error)
+//
+// 一般配合 go generate 使用：
+//
+//	//go:generate libsvcgen -type Calc
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeName = flag.String("type", "", "interface type name; must be set")
+	srcFile  = flag.String("src", "", "source file contains the interface; default $GOFILE")
+	output   = flag.String("output", "", "output file name; default <src dir>/<lower(type)>_libsvc.go")
+)
+
+func main() {
+	flag.Parse()
+	if *typeName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *srcFile == "" {
+		*srcFile = os.Getenv("GOFILE")
+	}
+	if *srcFile == "" {
+		fmt.Fprintln(os.Stderr, "libsvcgen: -src not set and $GOFILE is empty")
+		os.Exit(2)
+	}
+	if *output == "" {
+		*output = filepath.Join(filepath.Dir(*srcFile), strings.ToLower(*typeName)+"_libsvc.go")
+	}
+
+	src, err := ioutil.ReadFile(*srcFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "libsvcgen: %s\n", err)
+		os.Exit(1)
+	}
+	code, err := generate(*srcFile, src, *typeName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "libsvcgen: %s\n", err)
+		os.Exit(1)
+	}
+	if err := ioutil.WriteFile(*output, code, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "libsvcgen: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,29 @@
+package calc
+
+import (
+	"context"
+	libsvc "net/url"
+	"time"
+
+	tm "time"
+)
+
+type AddInput struct {
+	A, B int
+}
+
+type AddOutput struct {
+	Sum int
+}
+
+type NowOutput struct {
+	Now time.Time
+}
+
+// Calc 是一个计算器服务
+type Calc interface {
+	Add(ctx context.Context, input *AddInput) (*AddOutput, error)
+	Now(ctx context.Context, input *tm.Location) (*NowOutput, error)
+	Parse(ctx context.Context, input *libsvc.URL) (*libsvc.Userinfo, error)
+	Batch(ctx context.Context, input *[]AddInput) (*map[string]AddOutput, error)
+}
@@ -4,30 +4,123 @@ import (
 	"context"
 )
 
-type passthruKeyType struct{}
+type metadataKeyType struct{}
 
-// proxyContext 只允许该 key 通过
-var passthruKey = passthruKeyType{}
+// metadataCtxKey 为元数据在 Context 中的 key
+var metadataCtxKey = metadataKeyType{}
 
-// Passthru 从 Context 中提取 Passthru 字典
-func Passthru(ctx context.Context) map[string]string {
-	v := ctx.Value(passthruKey)
-	if v == nil {
-		return nil
+// metadata 是 Context 中的元数据，不可变：修改时复制一份新的
+type metadata struct {
+	// incoming 为从上一跳收到的元数据
+	incoming map[string]string
+	// outgoing 为本地设置的元数据，覆盖 incoming 中的同名项
+	outgoing map[string]string
+}
+
+func metadataFromContext(ctx context.Context) *metadata {
+	md, _ := ctx.Value(metadataCtxKey).(*metadata)
+	if md == nil {
+		return &metadata{}
 	}
-	return v.(map[string]string)
+	return md
+}
+
+// Passthru 从 Context 中提取 Passthru 字典，等同于 OutgoingMetadata
+func Passthru(ctx context.Context) map[string]string {
+	return OutgoingMetadata(ctx)
 }
 
 // WithPassthru 给 Context 添加 Passthru 字典，用于在 Service 调用过程中传递一些
-// 上下文信息（参数不应该放在这里）
+// 上下文信息（参数不应该放在这里），等同于 WithOutgoingMetadata
 func WithPassthru(ctx context.Context, kv map[string]string) context.Context {
-	p := Passthru(ctx)
-	if p == nil {
-		p = kv
-	} else {
-		for k, v := range kv {
-			p[k] = v
+	return WithOutgoingMetadata(ctx, kv)
+}
+
+// IncomingMetadata 返回从上一跳收到的元数据（的副本），没有时返回 nil
+func IncomingMetadata(ctx context.Context) map[string]string {
+	return copyMetadata(metadataFromContext(ctx).incoming)
+}
+
+// OutgoingMetadata 返回发起调用时需要传到下一跳的元数据（的副本），没有时返回 nil：
+// 包括从上一跳收到的策略为 PropagateAll 的元数据，以及本地设置的策略不为 LocalOnly 的元数据
+func OutgoingMetadata(ctx context.Context) map[string]string {
+	md := metadataFromContext(ctx)
+	ret := map[string]string{}
+	for k, v := range md.incoming {
+		if metadataPolicy(k) == PropagateAll {
+			ret[k] = v
+		}
+	}
+	for k, v := range md.outgoing {
+		if metadataPolicy(k) != LocalOnly {
+			ret[k] = v
 		}
 	}
-	return context.WithValue(ctx, passthruKey, p)
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
+
+// WithIncomingMetadata 设置从上一跳收到的元数据，替换原来的；一般由服务端（例如 rpcServer）在收到请求时调用
+func WithIncomingMetadata(ctx context.Context, kv map[string]string) context.Context {
+	md := metadataFromContext(ctx)
+	return context.WithValue(ctx, metadataCtxKey, &metadata{
+		incoming: copyMetadata(kv),
+		outgoing: md.outgoing,
+	})
+}
+
+// WithOutgoingMetadata 给 Context 添加本地设置的元数据，返回的 Context 带有合并后的副本，不影响原来的 Context
+func WithOutgoingMetadata(ctx context.Context, kv map[string]string) context.Context {
+	md := metadataFromContext(ctx)
+	outgoing := make(map[string]string, len(md.outgoing)+len(kv))
+	for k, v := range md.outgoing {
+		outgoing[k] = v
+	}
+	for k, v := range kv {
+		outgoing[k] = v
+	}
+	return context.WithValue(ctx, metadataCtxKey, &metadata{
+		incoming: md.incoming,
+		outgoing: outgoing,
+	})
+}
+
+// withNextHopMetadata 返回下一跳看到的 Context：发起调用时的 OutgoingMetadata 成为收到的元数据，
+// 没有本地设置的元数据，跟 rpcServer 收到请求时一样；用于进程内的调用
+func withNextHopMetadata(ctx context.Context) context.Context {
+	return context.WithValue(ctx, metadataCtxKey, &metadata{
+		incoming: OutgoingMetadata(ctx),
+	})
+}
+
+// metadataValue 返回元数据的值，本地设置的优先于从上一跳收到的
+func metadataValue(ctx context.Context, name string) (string, bool) {
+	md := metadataFromContext(ctx)
+	if v, ok := md.outgoing[name]; ok {
+		return v, true
+	}
+	v, ok := md.incoming[name]
+	return v, ok
+}
+
+// MetadataSize 返回元数据的大小（所有 key 跟 value 的长度之和），协议可以用来限制元数据的大小
+func MetadataSize(kv map[string]string) int {
+	n := 0
+	for k, v := range kv {
+		n += len(k) + len(v)
+	}
+	return n
+}
+
+func copyMetadata(kv map[string]string) map[string]string {
+	if len(kv) == 0 {
+		return nil
+	}
+	ret := make(map[string]string, len(kv))
+	for k, v := range kv {
+		ret[k] = v
+	}
+	return ret
 }
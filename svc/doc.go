@@ -13,7 +13,8 @@ Package libsvc 提供一个服务框架.
 	                                     |  |                  * *          +-- InprocServer()
 	                                     |  |                  v *          |
 	  NewLocalService() -----------------+  +------------> ServiceServer <--+-- NewRPCServer(RPCServerProtocolFactory, RPCTransportServer)
-	                                           Register()
+	                                     |     Register()
+	  NewStructService() ----------------+
 
 核心类型是“服务” Service（以及 ServiceWithInterface）：可对其方法发起调用
 */
@@ -0,0 +1,180 @@
+package libsvc
+
+import (
+	"errors"
+	"sync"
+)
+
+// 错误代码，与 jsonrpc 的错误代码保持一致，-32000 ~ -32099 保留给 libsvc 使用
+const (
+	CodeUnknown           = -1
+	CodeInvalidParams     = -32602
+	CodeMethodNotFound    = -32601
+	CodeInternal          = -32603
+	CodeSvcNotFound       = -32000
+	CodeStreamUnsupported = -32001
+	CodeNotifyUnsupported = -32002
+	CodeMetadataTooLarge  = -32003
+	CodeUnavailable       = -32004
+	CodeOverloaded        = -32005
+	CodeUnauthenticated   = -32006
+	CodePermissionDenied  = -32007
+)
+
+// Error 是一个结构化的、与传输层无关的错误，RPC 协议应当将其完整地传到客户端；
+// 若 Code 已通过 RegisterError 注册，则 errors.Is(e, 所注册的错误) 成立，因此远程调用跟进程内调用的错误可以同样地判断
+type Error struct {
+	// Code 为错误代码
+	Code int `json:"code"`
+
+	// Message 为错误信息
+	Message string `json:"message"`
+
+	// Details 为额外数据，需要可以被 json 序列化；经过 RPC 后为 json.RawMessage
+	Details interface{} `json:"details,omitempty"`
+
+	// Temporary 表示错误是暂时性的（例如超时、过载），重试可能成功
+	Temporary bool `json:"temporary,omitempty"`
+}
+
+type registeredError struct {
+	code int
+	err  error
+}
+
+var (
+	errRegistry = struct {
+		mu   sync.RWMutex
+		errs []registeredError
+	}{}
+)
+
+func init() {
+	RegisterError(CodeInvalidParams, ErrInvalidParams)
+	RegisterError(CodeMethodNotFound, ErrMethodNotFound)
+	RegisterError(CodeInternal, ErrInternal)
+	RegisterError(CodeSvcNotFound, ErrSvcNotFound)
+	RegisterError(CodeStreamUnsupported, ErrStreamUnsupported)
+	RegisterError(CodeNotifyUnsupported, ErrNotifyUnsupported)
+	RegisterError(CodeMetadataTooLarge, ErrMetadataTooLarge)
+	RegisterError(CodeUnavailable, ErrUnavailable)
+	RegisterError(CodeOverloaded, ErrOverloaded)
+	RegisterError(CodeUnauthenticated, ErrUnauthenticated)
+	RegisterError(CodePermissionDenied, ErrPermissionDenied)
+}
+
+// RegisterError 注册错误代码 code 所对应的错误 err（一般为 sentinel 错误），使得：
+//   - 服务端返回 err（或包装了 err 的错误）时，AsError 使用 code 作为错误代码
+//   - 客户端收到代码为 code 的 Error 时，errors.Is(err, 所注册的错误) 成立
+//
+// 一般在 init 中调用，重复注册同一代码或同一错误会 panic
+func RegisterError(code int, err error) {
+	errRegistry.mu.Lock()
+	defer errRegistry.mu.Unlock()
+	for _, r := range errRegistry.errs {
+		if r.code == code || r.err == err {
+			panic(ErrCodeConflict)
+		}
+	}
+	errRegistry.errs = append(errRegistry.errs, registeredError{code: code, err: err})
+}
+
+// registeredErrorByCode 返回代码所注册的错误
+func registeredErrorByCode(code int) error {
+	errRegistry.mu.RLock()
+	defer errRegistry.mu.RUnlock()
+	for _, r := range errRegistry.errs {
+		if r.code == code {
+			return r.err
+		}
+	}
+	return nil
+}
+
+// registeredCode 返回错误（或其所包装的错误）所注册的代码
+func registeredCode(err error) (int, bool) {
+	errRegistry.mu.RLock()
+	defer errRegistry.mu.RUnlock()
+	for _, r := range errRegistry.errs {
+		if errors.Is(err, r.err) {
+			return r.code, true
+		}
+	}
+	return 0, false
+}
+
+// Unavailable 将传输层的错误（例如连接断开）包装为暂时性的 Error，使得 errors.Is(e, ErrUnavailable) 成立，
+// 一般由 RPCTransport 的实现使用
+func Unavailable(err error) *Error {
+	return &Error{
+		Code:      CodeUnavailable,
+		Message:   err.Error(),
+		Temporary: true,
+	}
+}
+
+// Overloaded 返回一个暂时性的 Error，使得 errors.Is(e, ErrOverloaded) 成立，用于服务端过载时拒绝请求，
+// 客户端应当退避后再重试
+func Overloaded(message string) *Error {
+	return &Error{
+		Code:      CodeOverloaded,
+		Message:   message,
+		Temporary: true,
+	}
+}
+
+// NewError 创建一个 Error
+func NewError(code int, message string) *Error {
+	return &Error{
+		Code:    code,
+		Message: message,
+	}
+}
+
+// AsError 将任意错误转换为 Error：若 err 本身（或其所包装的错误）是 *Error 则直接返回；
+// 若是已注册的错误则使用所注册的代码；否则使用 CodeUnknown
+func AsError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	e := (*Error)(nil)
+	if errors.As(err, &e) {
+		return e
+	}
+	code, ok := registeredCode(err)
+	if !ok {
+		code = CodeUnknown
+	}
+	return &Error{
+		Code:      code,
+		Message:   err.Error(),
+		Temporary: IsTemporary(err),
+	}
+}
+
+// IsTemporary 判断错误是否是暂时性的：*Error 的 Temporary 字段，或是实现了 Temporary() bool 的错误（例如超时）
+func IsTemporary(err error) bool {
+	e := (*Error)(nil)
+	if errors.As(err, &e) {
+		return e.Temporary
+	}
+	t := interface{ Temporary() bool }(nil)
+	if errors.As(err, &t) {
+		return t.Temporary()
+	}
+	return false
+}
+
+// Error 实现 error 接口
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is 用于 errors.Is：代码相同的 *Error，或是代码所注册的错误
+func (e *Error) Is(target error) bool {
+	if t, ok := target.(*Error); ok {
+		return t.Code == e.Code
+	}
+	registered := registeredErrorByCode(e.Code)
+	return registered != nil && registered == target
+}
@@ -0,0 +1,60 @@
+package libsvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type temporaryErr struct{}
+
+func (temporaryErr) Error() string   { return "temporary" }
+func (temporaryErr) Temporary() bool { return true }
+
+var (
+	errTestRegistered = errors.New("registered")
+)
+
+func init() {
+	RegisterError(1000, errTestRegistered)
+}
+
+func TestError(t *testing.T) {
+	a := assert.New(t)
+
+	a.Panics(func() {
+		RegisterError(1000, errors.New("another"))
+	}, "Expect panic since code conflict")
+
+	a.Nil(AsError(nil))
+
+	// 已注册的错误
+	e := AsError(fmt.Errorf("wrapped: %w", ErrMethodNotFound))
+	a.Equal(CodeMethodNotFound, e.Code)
+	a.Equal("wrapped: Method not found or not implemented", e.Message)
+	a.True(errors.Is(e, ErrMethodNotFound))
+	a.False(errors.Is(e, ErrSvcNotFound))
+	a.Equal(1000, AsError(errTestRegistered).Code)
+	a.True(errors.Is(NewError(1000, "remote"), errTestRegistered))
+
+	// 未注册的错误
+	e = AsError(errors.New("unknown"))
+	a.Equal(CodeUnknown, e.Code)
+	a.False(e.Temporary)
+	a.True(errors.Is(e, NewError(CodeUnknown, "")))
+
+	// *Error 本身
+	e = &Error{Code: 1001, Message: "x", Temporary: true}
+	a.Equal(e, AsError(fmt.Errorf("wrapped: %w", e)))
+
+	// 暂时性错误
+	a.True(IsTemporary(e))
+	a.True(IsTemporary(temporaryErr{}))
+	a.True(AsError(temporaryErr{}).Temporary)
+	a.True(IsTemporary(context.DeadlineExceeded))
+	a.False(IsTemporary(errors.New("x")))
+	a.False(IsTemporary(nil))
+}
@@ -20,4 +20,17 @@ var (
 	ErrSvcNotFound       = errors.New("Service not found")
 	ErrSvcNameConflict   = errors.New("Service name conflict (duplicated)")
 	ErrMethodHandlerPair = errors.New("Expect Method and MethodHandler pairs")
+	ErrNotStruct         = errors.New("Expect a struct or a non-nil pointer to struct")
+	ErrNoMethod          = errors.New("No method found")
+	ErrStreamUnsupported = errors.New("Stream not supported")
+	ErrNotifyUnsupported = errors.New("Notification not supported")
+	ErrInvalidParams     = errors.New("Invalid params")
+	ErrInternal          = errors.New("Internal error")
+	ErrCodeConflict      = errors.New("Error code conflict (duplicated)")
+	ErrMetadataConflict  = errors.New("Metadata key conflict (duplicated)")
+	ErrMetadataTooLarge  = errors.New("Metadata too large")
+	ErrUnavailable       = errors.New("Service unavailable")
+	ErrOverloaded        = errors.New("Service overloaded")
+	ErrUnauthenticated   = errors.New("Unauthenticated")
+	ErrPermissionDenied  = errors.New("Permission denied")
 )
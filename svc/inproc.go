@@ -67,7 +67,8 @@ func (server inprocServer) Deregister(svcName string) error {
 	return nil
 }
 
-// InprocClient 创建一个进程内客户端，可以访问同进程内的注册的服务
+// InprocClient 创建一个进程内客户端，可以访问同进程内的注册的服务；
+// 跟远程调用一样，服务看到的是调用方的 OutgoingMetadata（见 IncomingMetadata）
 func InprocClient() ServiceClient {
 	return defaultInprocClient
 }
@@ -93,6 +94,10 @@ func (svc *inprocClientService) Invoke(ctx context.Context, method Method, input
 	if s == nil {
 		return ErrSvcNotFound
 	}
+	ctx = withNextHopMetadata(ctx)
+	if IsNotification(ctx) {
+		return invokeAsync(ctx, s, method, input, output)
+	}
 	// 这里不需要再次检查 input/output 类型，因为接下来 s.Invoke 是会检查的
 	return s.Invoke(ctx, method, input, output)
 
@@ -130,5 +135,9 @@ func (svc *inprocFirstClientService) Invoke(ctx context.Context, method Method,
 	if s == nil {
 		return svc.alt.Invoke(ctx, method, input, output)
 	}
+	ctx = withNextHopMetadata(ctx)
+	if IsNotification(ctx) {
+		return invokeAsync(ctx, s, method, input, output)
+	}
 	return s.Invoke(ctx, method, input, output)
 }
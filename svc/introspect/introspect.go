@@ -0,0 +1,174 @@
+// introspect 提供一个内省服务，用于查询进程中注册了哪些服务，以及这些服务的方法及其出入参的 JSON Schema
+package introspect
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/huangjunwen/platform-kit/svc/jsonschema"
+)
+
+// ServiceName 是内省服务的保留服务名
+const ServiceName = "libsvc.introspect"
+
+// ListServicesInput 是 ListServicesMethod 的入参
+type ListServicesInput struct{}
+
+// ListServicesOutput 是 ListServicesMethod 的出参
+type ListServicesOutput struct {
+	Services []string `json:"services"`
+}
+
+// DescribeServiceInput 是 DescribeServiceMethod 的入参
+type DescribeServiceInput struct {
+	Service string `json:"service"`
+}
+
+// DescribeServiceOutput 是 DescribeServiceMethod 的出参
+type DescribeServiceOutput struct {
+	Service *ServiceInfo `json:"service"`
+}
+
+// ServiceInfo 描述一个服务
+type ServiceInfo struct {
+	Name    string        `json:"name"`
+	Methods []*MethodInfo `json:"methods"`
+}
+
+// MethodInfo 描述一个方法，除名字及出入参外的字段来自方法的元数据，见 libsvc.MethodMeta
+type MethodInfo struct {
+	Name        string             `json:"name"`
+	Input       *jsonschema.Schema `json:"input"`
+	Output      *jsonschema.Schema `json:"output"`
+	Description string             `json:"description,omitempty"`
+	Idempotent  bool               `json:"idempotent,omitempty"`
+	ReadOnly    bool               `json:"readOnly,omitempty"`
+	// Timeout 为默认超时，格式同 time.Duration.String()
+	Timeout    string   `json:"timeout,omitempty"`
+	Deprecated string   `json:"deprecated,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+var (
+	// ListServicesMethod 列出所有已注册的服务名
+	ListServicesMethod = libsvc.WithMethodMeta(
+		libsvc.NewTypedMethod[ListServicesInput, ListServicesOutput]("listServices"),
+		libsvc.MethodMeta{Description: "List registered services", ReadOnly: true},
+	)
+
+	// DescribeServiceMethod 描述一个已注册的服务，若服务不存在返回 libsvc.ErrSvcNotFound
+	DescribeServiceMethod = libsvc.WithMethodMeta(
+		libsvc.NewTypedMethod[DescribeServiceInput, DescribeServiceOutput]("describeService"),
+		libsvc.MethodMeta{Description: "Describe a registered service", ReadOnly: true},
+	)
+
+	// Interface 是内省服务的接口定义
+	Interface = libsvc.NewInterface(ListServicesMethod, DescribeServiceMethod)
+)
+
+type server struct {
+	server libsvc.ServiceServer
+	mu     sync.RWMutex
+	svcs   map[string]libsvc.ServiceWithInterface
+}
+
+var (
+	_ libsvc.ServiceServer = (*server)(nil)
+)
+
+// NewServer 包装一个 ServiceServer（例如 libsvc.InprocServer() 或 libsvc.NewRPCServer(...) 的返回值），
+// 并在其上注册内省服务；之后通过返回的 ServiceServer 注册的服务都可以被内省服务查询到
+func NewServer(s libsvc.ServiceServer) (libsvc.ServiceServer, error) {
+	ret := &server{
+		server: s,
+		svcs:   make(map[string]libsvc.ServiceWithInterface),
+	}
+	svc := libsvc.NewLocalService(
+		ServiceName,
+		ListServicesMethod, ListServicesMethod.Handler(ret.listServices),
+		DescribeServiceMethod, DescribeServiceMethod.Handler(ret.describeService),
+	)
+	if err := ret.Register(svc); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Register 实现 libsvc.ServiceServer 接口
+func (s *server) Register(svc libsvc.ServiceWithInterface) error {
+	if err := s.server.Register(svc); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.svcs[svc.Name()] = svc
+	s.mu.Unlock()
+	return nil
+}
+
+// Deregister 实现 libsvc.ServiceServer 接口
+func (s *server) Deregister(svcName string) error {
+	if err := s.server.Deregister(svcName); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.svcs, svcName)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *server) listServices(_ context.Context, input *ListServicesInput, output *ListServicesOutput) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	output.Services = make([]string, 0, len(s.svcs))
+	for name := range s.svcs {
+		output.Services = append(output.Services, name)
+	}
+	sort.Strings(output.Services)
+	return nil
+}
+
+func (s *server) describeService(_ context.Context, input *DescribeServiceInput, output *DescribeServiceOutput) error {
+	s.mu.RLock()
+	svc := s.svcs[input.Service]
+	s.mu.RUnlock()
+
+	if svc == nil {
+		return libsvc.ErrSvcNotFound
+	}
+	output.Service = DescribeService(svc)
+	return nil
+}
+
+// DescribeService 返回服务的描述信息，方法按名字排序
+func DescribeService(svc libsvc.ServiceWithInterface) *ServiceInfo {
+	methods := svc.Interface().Methods()
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Name() < methods[j].Name()
+	})
+
+	info := &ServiceInfo{
+		Name:    svc.Name(),
+		Methods: make([]*MethodInfo, 0, len(methods)),
+	}
+	for _, method := range methods {
+		meta := libsvc.MethodMetaOf(method)
+		m := &MethodInfo{
+			Name:        method.Name(),
+			Input:       jsonschema.For(method.GenInput()),
+			Output:      jsonschema.For(method.GenOutput()),
+			Description: meta.Description,
+			Idempotent:  meta.Idempotent,
+			ReadOnly:    meta.ReadOnly,
+			Deprecated:  meta.Deprecated,
+			Tags:        meta.Tags,
+		}
+		if meta.Timeout > 0 {
+			m.Timeout = meta.Timeout.String()
+		}
+		info.Methods = append(info.Methods, m)
+	}
+	return info
+}
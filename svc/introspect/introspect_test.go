@@ -0,0 +1,70 @@
+package introspect
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/huangjunwen/platform-kit/svc/jsonschema"
+	"github.com/stretchr/testify/assert"
+)
+
+type echoInput struct {
+	Msg string `json:"msg"`
+}
+
+func TestIntrospect(t *testing.T) {
+	a := assert.New(t)
+
+	server, err := NewServer(libsvc.InprocServer())
+	a.NoError(err)
+	defer libsvc.InprocServer().Deregister(ServiceName)
+
+	_, err = NewServer(libsvc.InprocServer())
+	a.Equal(libsvc.ErrSvcNameConflict, err, "Expect error since introspect service has already registered")
+
+	echo := libsvc.WithMethodMeta(libsvc.NewTypedMethod[echoInput, echoInput]("echo"), libsvc.MethodMeta{
+		Description: "Echo the message",
+		ReadOnly:    true,
+		Timeout:     time.Second,
+		Tags:        []string{"test"},
+	})
+	a.NoError(server.Register(libsvc.NewLocalService("test.echo", echo, echo.Handler(func(_ context.Context, input, output *echoInput) error {
+		*output = *input
+		return nil
+	}))))
+	defer server.Deregister("test.echo")
+
+	ctx := context.Background()
+	svc := libsvc.InprocClient().Make(ServiceName)
+
+	list, err := ListServicesMethod.Invoke(ctx, svc, &ListServicesInput{})
+	a.NoError(err)
+	a.Equal([]string{ServiceName, "test.echo"}, list.Services)
+
+	desc, err := DescribeServiceMethod.Invoke(ctx, svc, &DescribeServiceInput{Service: "test.echo"})
+	a.NoError(err)
+	a.Equal(&ServiceInfo{
+		Name: "test.echo",
+		Methods: []*MethodInfo{
+			{
+				Name:        "echo",
+				Input:       jsonschema.For(&echoInput{}),
+				Output:      jsonschema.For(&echoInput{}),
+				Description: "Echo the message",
+				ReadOnly:    true,
+				Timeout:     "1s",
+				Tags:        []string{"test"},
+			},
+		},
+	}, desc.Service)
+
+	_, err = DescribeServiceMethod.Invoke(ctx, svc, &DescribeServiceInput{Service: "test.not.exists"})
+	a.Equal(libsvc.ErrSvcNotFound, err)
+
+	a.NoError(server.Deregister("test.echo"))
+	list, err = ListServicesMethod.Invoke(ctx, svc, &ListServicesInput{})
+	a.NoError(err)
+	a.Equal([]string{ServiceName}, list.Services)
+}
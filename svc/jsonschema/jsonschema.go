@@ -0,0 +1,366 @@
+// jsonschema 通过反射从 go 类型生成 JSON Schema (draft 2020-12)，一般用于描述 libsvc.Method 的出入参，
+// 生成的 Schema 也可以用于校验原始的 json 数据；字段默认是可选的，
+// 在 tag 中标记了 jsonschema:"required" 的字段才是必填的，例如：
+//
+//	Name string `json:"name" jsonschema:"required"`
+package jsonschema
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/mailru/easyjson"
+)
+
+// Draft 是生成的 Schema 所使用的版本
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema 代表一个 JSON Schema，这里只包含所需的一个子集
+type Schema struct {
+	Schema string             `json:"$schema,omitempty"`
+	Ref    string             `json:"$ref,omitempty"`
+	Defs   map[string]*Schema `json:"$defs,omitempty"`
+
+	Type        Type          `json:"type,omitempty"`
+	Format      string        `json:"format,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+	AnyOf       []*Schema     `json:"anyOf,omitempty"`
+
+	// object
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+
+	// array
+	Items    *Schema `json:"items,omitempty"`
+	MinItems *int    `json:"minItems,omitempty"`
+	MaxItems *int    `json:"maxItems,omitempty"`
+}
+
+// Type 是 Schema 的 type 字段，只有一个类型时序列化为字符串，否则序列化为数组
+type Type []string
+
+// Schemaer 可以由类型实现以自定义其 Schema
+type Schemaer interface {
+	JSONSchema() *Schema
+}
+
+// Reflector 从 go 类型生成 Schema：具名结构体类型会放到 Defs 中并以 $ref 引用，
+// 因此同一个 Reflector 生成的多个 Schema 共享同一份 Defs
+type Reflector struct {
+	// RefPrefix 为 $ref 的前缀，默认为 "#/$defs/"
+	RefPrefix string
+
+	defs  map[string]*Schema
+	names map[reflect.Type]string
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	jsonRawMessageType  = reflect.TypeOf(json.RawMessage{})
+	easyjsonRawMsgType  = reflect.TypeOf(easyjson.RawMessage{})
+	schemaerType        = reflect.TypeOf((*Schemaer)(nil)).Elem()
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	easyjsonMarshalType = reflect.TypeOf((*easyjson.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+const (
+	easyjsonOptPkgPath = "github.com/mailru/easyjson/opt"
+)
+
+var (
+	defNameRegexp = regexp.MustCompile(`[^a-zA-Z0-9_.\-]`)
+)
+
+// For 返回 v 的类型所对应的独立的 Schema（包含 $schema 以及 $defs），若 v 为指针则取其所指类型，例如：
+//
+//	jsonschema.For(method.GenInput())
+func For(v interface{}) *Schema {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return &Schema{Schema: Draft}
+	}
+	return Reflect(t)
+}
+
+// Reflect 返回类型 t 所对应的独立的 Schema（包含 $schema 以及 $defs），若 t 为指针则取其所指类型
+func Reflect(t reflect.Type) *Schema {
+	r := &Reflector{}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	s := r.Reflect(t)
+	s.Schema = Draft
+	s.Defs = r.Defs()
+	return s
+}
+
+// ForMethod 返回方法出入参的 Schema
+func ForMethod(method libsvc.Method) (input, output *Schema) {
+	return For(method.GenInput()), For(method.GenOutput())
+}
+
+// Reflect 返回类型 t 对应的 Schema，其中的 $ref 引用 Defs 中的定义
+func (r *Reflector) Reflect(t reflect.Type) *Schema {
+	if r.defs == nil {
+		r.defs = make(map[string]*Schema)
+		r.names = make(map[reflect.Type]string)
+	}
+	return r.reflect(t)
+}
+
+// Defs 返回目前为止所有生成的定义
+func (r *Reflector) Defs() map[string]*Schema {
+	if len(r.defs) == 0 {
+		return nil
+	}
+	return r.defs
+}
+
+func (r *Reflector) reflect(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		return nullable(r.reflect(t.Elem()))
+	}
+
+	// 一些特殊的类型
+	switch {
+	case t.Kind() != reflect.Interface && implements(t, schemaerType):
+		// NOTE: 使用指向零值的指针，不管方法的 receiver 是否指针都可以调用；
+		// 接口类型的零值为 nil，无法调用，当作任意值处理
+		return reflect.New(t).Interface().(Schemaer).JSONSchema()
+
+	case t == timeType:
+		return &Schema{Type: Type{"string"}, Format: "date-time"}
+
+	case t == jsonRawMessageType || t == easyjsonRawMsgType:
+		return &Schema{}
+
+	case t.PkgPath() == easyjsonOptPkgPath:
+		// easyjson/opt 中的类型，未定义时序列化为 null
+		switch {
+		case strings.HasPrefix(t.Name(), "Int") || strings.HasPrefix(t.Name(), "Uint"):
+			return &Schema{Type: Type{"integer", "null"}}
+		case strings.HasPrefix(t.Name(), "Float"):
+			return &Schema{Type: Type{"number", "null"}}
+		case t.Name() == "String":
+			return &Schema{Type: Type{"string", "null"}}
+		case t.Name() == "Bool":
+			return &Schema{Type: Type{"boolean", "null"}}
+		}
+		return &Schema{}
+
+	case implements(t, jsonMarshalerType) || implements(t, easyjsonMarshalType):
+		// 自定义了序列化的类型无法得知其格式，除非是 easyjson 为结构体生成的代码：它跟 encoding/json 一样遵守 json tag
+		if t.Kind() != reflect.Struct || !implements(t, easyjsonMarshalType) {
+			return &Schema{}
+		}
+
+	case implements(t, textMarshalerType):
+		return &Schema{Type: Type{"string"}}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: Type{"boolean"}}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: Type{"integer"}}
+
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Type{"number"}}
+
+	case reflect.String:
+		return &Schema{Type: Type{"string"}}
+
+	case reflect.Slice:
+		// []byte 会被 encoding/json 序列化为 base64 字符串
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: Type{"string", "null"}, Format: "byte"}
+		}
+		return &Schema{Type: Type{"array", "null"}, Items: r.reflect(t.Elem())}
+
+	case reflect.Array:
+		n := t.Len()
+		return &Schema{Type: Type{"array"}, Items: r.reflect(t.Elem()), MinItems: &n, MaxItems: &n}
+
+	case reflect.Map:
+		return &Schema{Type: Type{"object", "null"}, AdditionalProperties: r.reflect(t.Elem())}
+
+	case reflect.Struct:
+		// 匿名结构体直接展开
+		if t.Name() == "" {
+			return r.reflectStruct(t)
+		}
+		name, ok := r.names[t]
+		if !ok {
+			name = r.defName(t)
+			r.names[t] = name
+			// 先占位以处理递归类型
+			r.defs[name] = &Schema{}
+			*r.defs[name] = *r.reflectStruct(t)
+		}
+		return &Schema{Ref: r.refPrefix() + name}
+
+	default:
+		// interface{} 等：任意值
+		return &Schema{}
+	}
+}
+
+func (r *Reflector) reflectStruct(t reflect.Type) *Schema {
+	s := &Schema{
+		Type:       Type{"object"},
+		Properties: map[string]*Schema{},
+	}
+	r.reflectFields(t, s, map[reflect.Type]bool{}, false)
+	return s
+}
+
+// reflectFields 将结构体 t 的字段加到 s 中，包括嵌入的结构体的字段；
+// 只有 tag 中标记了 jsonschema:"required" 的字段才是必填的，
+// viaPtr 表示 t 是通过指针嵌入的，其字段在指针为 nil 时不会出现，所以都不是必填的
+func (r *Reflector) reflectFields(t reflect.Type, s *Schema, visited map[reflect.Type]bool, viaPtr bool) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+
+	type embed struct {
+		t     reflect.Type
+		isPtr bool
+	}
+	embedded := []embed{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, required, skip := parseTag(field)
+		if skip {
+			continue
+		}
+
+		// 没有在 tag 中指定名字的嵌入结构体，其字段会被提升到外层
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			isPtr := ft.Kind() == reflect.Ptr
+			if isPtr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, embed{t: ft, isPtr: isPtr})
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			// 非导出字段
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := s.Properties[name]; ok {
+			continue
+		}
+		s.Properties[name] = r.reflect(field.Type)
+		if required && !viaPtr {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	// NOTE: 外层字段优先于嵌入结构体的字段
+	for _, e := range embedded {
+		r.reflectFields(e.t, s, visited, viaPtr || e.isPtr)
+	}
+}
+
+func (r *Reflector) refPrefix() string {
+	if r.RefPrefix == "" {
+		return "#/$defs/"
+	}
+	return r.RefPrefix
+}
+
+// defName 为具名类型找一个没冲突的名字
+func (r *Reflector) defName(t reflect.Type) string {
+	name := defNameRegexp.ReplaceAllString(t.Name(), "_")
+	if _, ok := r.defs[name]; !ok {
+		return name
+	}
+	base := defNameRegexp.ReplaceAllString(t.PkgPath()+"."+t.Name(), "_")
+	name = base
+	for i := 2; ; i++ {
+		if _, ok := r.defs[name]; !ok {
+			return name
+		}
+		name = base + strconv.Itoa(i)
+	}
+}
+
+// parseTag 解析字段的 json tag 以及 jsonschema tag（目前只支持 "required"）
+func parseTag(field reflect.StructField) (name string, required bool, skip bool) {
+	for _, opt := range strings.Split(field.Tag.Get("jsonschema"), ",") {
+		if opt == "required" {
+			required = true
+		}
+	}
+	tag, ok := field.Tag.Lookup("json")
+	if !ok {
+		return "", required, false
+	}
+	if tag == "-" {
+		return "", false, true
+	}
+	return strings.Split(tag, ",")[0], required, false
+}
+
+// nullable 返回允许为 null 的 Schema
+func nullable(s *Schema) *Schema {
+	switch {
+	case s.Ref != "":
+		return &Schema{AnyOf: []*Schema{s, {Type: Type{"null"}}}}
+	case len(s.Type) == 0:
+		// 任意值已经包括 null
+		return s
+	}
+	for _, t := range s.Type {
+		if t == "null" {
+			return s
+		}
+	}
+	ret := *s
+	ret.Type = append(append(Type{}, s.Type...), "null")
+	return &ret
+}
+
+func implements(t, itf reflect.Type) bool {
+	return t.Implements(itf) || reflect.PtrTo(t).Implements(itf)
+}
+
+// MarshalJSON 实现 json.Marshaler 接口
+func (t Type) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler 接口
+func (t *Type) UnmarshalJSON(data []byte) error {
+	if len(data) != 0 && data[0] == '"' {
+		s := ""
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*t = Type{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
@@ -0,0 +1,143 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mailru/easyjson"
+	"github.com/mailru/easyjson/opt"
+	"github.com/stretchr/testify/assert"
+)
+
+type node struct {
+	Value    int      `json:"value" jsonschema:"required"`
+	Children []*node  `json:"children,omitempty"`
+	Skip     string   `json:"-"`
+	Tags     []string `json:",omitempty"`
+	private  int
+}
+
+type Base struct {
+	ID      string    `json:"id" jsonschema:"required"`
+	Created time.Time `json:"created" jsonschema:"required"`
+}
+
+type meta struct {
+	Version int `json:"version" jsonschema:"required"` // 通过指针嵌入，不是必填的
+}
+
+type article struct {
+	Base
+	*meta
+	ID     int                 `json:"id,omitempty"` // 覆盖 Base.ID
+	Title  string              `json:"title" jsonschema:"required"`
+	Attrs  map[string]float64  `json:"attrs,omitempty"`
+	Cover  []byte              `json:"cover,omitempty"`
+	Score  opt.Int             `json:"score" jsonschema:"required"`
+	Raw    easyjson.RawMessage `json:"raw,omitempty"`
+	Pair   [2]string           `json:"pair" jsonschema:"required"`
+	Status status              `json:"status" jsonschema:"required"`
+	Note   string              `json:"note"`
+	Any    interface{}         `json:"any,omitempty"`
+}
+
+type status int
+
+func (s status) JSONSchema() *Schema {
+	return &Schema{Type: Type{"string"}, Enum: []interface{}{"draft", "published"}}
+}
+
+type level struct {
+	n *int
+}
+
+// JSONSchema 的 receiver 为指针，零值的字段为 nil
+func (l *level) JSONSchema() *Schema {
+	if l.n != nil {
+		return &Schema{Type: Type{"integer"}}
+	}
+	return &Schema{Type: Type{"number"}}
+}
+
+func marshal(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestReflect(t *testing.T) {
+	a := assert.New(t)
+
+	a.JSONEq(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$ref": "#/$defs/node",
+		"$defs": {
+			"node": {
+				"type": "object",
+				"properties": {
+					"value": {"type": "integer"},
+					"children": {"type": ["array", "null"], "items": {"anyOf": [{"$ref": "#/$defs/node"}, {"type": "null"}]}},
+					"Tags": {"type": ["array", "null"], "items": {"type": "string"}}
+				},
+				"required": ["value"]
+			}
+		}
+	}`, marshal(t, For(&node{})))
+
+	a.JSONEq(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$ref": "#/$defs/article",
+		"$defs": {
+			"article": {
+				"type": "object",
+				"properties": {
+					"id": {"type": "integer"},
+					"created": {"type": "string", "format": "date-time"},
+					"version": {"type": "integer"},
+					"title": {"type": "string"},
+					"attrs": {"type": ["object", "null"], "additionalProperties": {"type": "number"}},
+					"cover": {"type": ["string", "null"], "format": "byte"},
+					"score": {"type": ["integer", "null"]},
+					"raw": {},
+					"pair": {"type": "array", "items": {"type": "string"}, "minItems": 2, "maxItems": 2},
+					"status": {"type": "string", "enum": ["draft", "published"]},
+					"note": {"type": "string"},
+					"any": {}
+				},
+				"required": ["title", "score", "pair", "status", "created"]
+			}
+		}
+	}`, marshal(t, For(&article{})))
+
+	a.JSONEq(`{"$schema": "https://json-schema.org/draft/2020-12/schema"}`, marshal(t, For(nil)))
+	a.JSONEq(`{"$schema": "https://json-schema.org/draft/2020-12/schema", "type": "object", "properties": {"x": {"type": "boolean"}}, "required": ["x"]}`,
+		marshal(t, For(&struct {
+			X bool `json:"x" jsonschema:"required"`
+			Y bool `json:"-" jsonschema:"required"`
+		}{})))
+
+	// 实现了 Schemaer 的接口类型以及指针 receiver
+	a.JSONEq(`{"$schema": "https://json-schema.org/draft/2020-12/schema", "type": "object", "properties": {"s": {}, "l": {"type": "number"}, "pl": {"type": ["number", "null"]}}}`,
+		marshal(t, For(&struct {
+			S  Schemaer `json:"s"`
+			L  level    `json:"l"`
+			PL *level   `json:"pl"`
+		}{})))
+
+	// 共享 Defs
+	r := &Reflector{RefPrefix: "#/components/schemas/"}
+	s1 := r.Reflect(reflect.TypeOf(&node{}))
+	s2 := r.Reflect(reflect.TypeOf([]node{}))
+	a.Equal("#/components/schemas/node", s1.AnyOf[0].Ref)
+	a.Equal("#/components/schemas/node", s2.Items.Ref)
+	a.Len(r.Defs(), 1)
+
+	// Type 的序列化/反序列化
+	typ := Type{}
+	a.NoError(json.Unmarshal([]byte(`"string"`), &typ))
+	a.Equal(Type{"string"}, typ)
+	a.NoError(json.Unmarshal([]byte(`["string","null"]`), &typ))
+	a.Equal(Type{"string", "null"}, typ)
+}
@@ -0,0 +1,265 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ValidationError 代表校验时的单个错误
+type ValidationError struct {
+	// Path 是出错位置的 JSON Pointer，例如 "/items/0/name"，根为 ""
+	Path string `json:"path"`
+
+	// Message 是错误信息
+	Message string `json:"message"`
+}
+
+// ValidationErrors 是校验时的所有错误
+type ValidationErrors []*ValidationError
+
+type validator struct {
+	root *Schema
+	errs ValidationErrors
+}
+
+// Validate 用 s 校验 json 数据，s 中的 $ref 在 s.Defs 中查找；若不满足返回 ValidationErrors；
+// 跟 encoding/json 解码到结构体时一样，属性名优先精确匹配，其次不区分大小写地匹配
+func (s *Schema) Validate(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v := interface{}(nil)
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	return s.ValidateValue(v)
+}
+
+// ValidateValue 用 s 校验已解码的 json 值（其中数字须为 json.Number 或 float64）；若不满足返回 ValidationErrors
+func (s *Schema) ValidateValue(v interface{}) error {
+	vd := &validator{root: s}
+	vd.validate(s, v, "")
+	if len(vd.errs) != 0 {
+		return vd.errs
+	}
+	return nil
+}
+
+func (vd *validator) addError(path string, format string, args ...interface{}) {
+	vd.errs = append(vd.errs, &ValidationError{
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (vd *validator) validate(s *Schema, v interface{}, path string) {
+	if s.Ref != "" {
+		def := vd.resolve(s.Ref)
+		if def == nil {
+			vd.addError(path, "unresolved $ref %+q", s.Ref)
+			return
+		}
+		vd.validate(def, v, path)
+	}
+
+	if len(s.AnyOf) != 0 {
+		// 若去除 null 后只剩一个分支（即 nullable 的情况），直接用该分支校验以获得更详细的错误
+		candidates := s.AnyOf
+		if v != nil {
+			candidates = []*Schema{}
+			for _, sub := range s.AnyOf {
+				if !(len(sub.Type) == 1 && sub.Type[0] == "null") {
+					candidates = append(candidates, sub)
+				}
+			}
+		}
+		if len(candidates) == 1 {
+			vd.validate(candidates[0], v, path)
+			return
+		}
+		matched := false
+		for _, sub := range candidates {
+			sv := &validator{root: vd.root}
+			sv.validate(sub, v, path)
+			if len(sv.errs) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			vd.addError(path, "does not match any of the allowed schemas")
+			return
+		}
+	}
+
+	if len(s.Type) != 0 {
+		actual := jsonType(v)
+		ok := false
+		for _, t := range s.Type {
+			if t == actual || (t == "number" && actual == "integer") {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			vd.addError(path, "expect %s but got %s", strings.Join(s.Type, " or "), actual)
+			return
+		}
+	}
+
+	if len(s.Enum) != 0 {
+		ok := false
+		for _, e := range s.Enum {
+			if equalJSON(e, v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			vd.addError(path, "should be one of %v", s.Enum)
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, val); err != nil {
+				vd.addError(path, "should be a RFC3339 date-time")
+			}
+		}
+
+	case []interface{}:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			vd.addError(path, "should have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			vd.addError(path, "should have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range val {
+				vd.validate(s.Items, item, fmt.Sprintf("%s/%d", path, i))
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if !hasKey(val, name) {
+				vd.addError(path+"/"+escapePointer(name), "is required")
+			}
+		}
+		// 按 key 排序以使得错误的顺序稳定
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sub := property(s.Properties, k)
+			if sub == nil {
+				sub = s.AdditionalProperties
+			}
+			if sub != nil {
+				vd.validate(sub, val[k], path+"/"+escapePointer(k))
+			}
+		}
+	}
+}
+
+func (vd *validator) resolve(ref string) *Schema {
+	const prefix = "#/$defs/"
+	if !strings.HasPrefix(ref, prefix) || vd.root.Defs == nil {
+		return nil
+	}
+	return vd.root.Defs[ref[len(prefix):]]
+}
+
+// Error 实现 error 接口
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Error 实现 error 接口
+func (err *ValidationError) Error() string {
+	if err.Path == "" {
+		return err.Message
+	}
+	return fmt.Sprintf("%s: %s", err.Path, err.Message)
+}
+
+// jsonType 返回已解码 json 值的类型
+func jsonType(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if f, ok := new(big.Float).SetString(val.String()); ok && f.IsInt() {
+			return "integer"
+		}
+		return "number"
+	case float64:
+		if val == float64(int64(val)) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "unknown"
+}
+
+func equalJSON(a, b interface{}) bool {
+	da, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	db, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(da, db)
+}
+
+// escapePointer 按 JSON Pointer 规则转义
+func escapePointer(s string) string {
+	return strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+}
+
+// property 返回名为 name 的属性的 Schema：跟 encoding/json 一样优先精确匹配，其次不区分大小写
+func property(props map[string]*Schema, name string) *Schema {
+	if sub, ok := props[name]; ok {
+		return sub
+	}
+	for k, sub := range props {
+		if strings.EqualFold(k, name) {
+			return sub
+		}
+	}
+	return nil
+}
+
+// hasKey 判断对象中是否有（不区分大小写）名为 name 的属性
+func hasKey(obj map[string]interface{}, name string) bool {
+	if _, ok := obj[name]; ok {
+		return true
+	}
+	for k := range obj {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
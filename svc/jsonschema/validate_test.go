@@ -0,0 +1,56 @@
+package jsonschema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	a := assert.New(t)
+
+	s := For(&article{})
+
+	a.NoError(s.Validate([]byte(`{
+		"title": "hello",
+		"score": null,
+		"pair": ["a", "b"],
+		"status": "draft",
+		"created": "2018-01-02T03:04:05Z",
+		"version": 1,
+		"attrs": {"x": 1.5, "y": 2},
+		"any": [1, "2"]
+	}`)))
+
+	err := s.Validate([]byte(`{
+		"id": 1.5,
+		"score": "x",
+		"pair": ["a"],
+		"status": "unknown",
+		"created": "yesterday",
+		"attrs": {"x": "y"}
+	}`))
+	a.Equal(ValidationErrors{
+		{Path: "/title", Message: "is required"},
+		{Path: "/attrs/x", Message: "expect number but got string"},
+		{Path: "/created", Message: "should be a RFC3339 date-time"},
+		{Path: "/id", Message: "expect integer but got number"},
+		{Path: "/pair", Message: "should have at least 2 items"},
+		{Path: "/score", Message: "expect integer or null but got string"},
+		{Path: "/status", Message: "should be one of [draft published]"},
+	}, err)
+
+	err = For(&node{}).Validate([]byte(`{"value": 1, "children": [{"value": 2}, {"children": null}, 3]}`))
+	a.Equal(ValidationErrors{
+		{Path: "/children/1/value", Message: "is required"},
+		{Path: "/children/2", Message: "expect object but got integer"},
+	}, err)
+
+	// 跟 encoding/json 一样，属性名不区分大小写
+	a.NoError(For(&node{}).Validate([]byte(`{"Value": 1, "TAGS": ["a"]}`)))
+	a.Equal(ValidationErrors{
+		{Path: "/VALUE", Message: "expect integer but got string"},
+	}, For(&node{}).Validate([]byte(`{"VALUE": "x"}`)))
+
+	a.Error(s.Validate([]byte(`{`)), "Expect error since bad json")
+}
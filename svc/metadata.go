@@ -0,0 +1,150 @@
+package libsvc
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+)
+
+// MetadataPolicy 为元数据的传播策略
+type MetadataPolicy int
+
+const (
+	// PropagateAll 表示元数据会一直传播下去（默认）
+	PropagateAll MetadataPolicy = iota
+	// PropagateNextHop 表示元数据只传到下一跳，下一跳再发起调用时不会继续传播
+	PropagateNextHop
+	// LocalOnly 表示元数据只在本地使用，不会传到下一跳
+	LocalOnly
+)
+
+var (
+	// DefaultMaxMetadataSize 为协议默认允许的元数据大小上限，见 MetadataSize
+	DefaultMaxMetadataSize = 8 << 10
+)
+
+// MetadataCodec 负责元数据的值与字符串之间的转换
+type MetadataCodec[T any] interface {
+	// Encode 将值编码为字符串，值无法编码时（编程错误）可以 panic
+	Encode(v T) string
+
+	// Decode 从字符串解码出值
+	Decode(s string) (T, error)
+}
+
+// MetadataKey 是强类型的元数据 key
+type MetadataKey[T any] struct {
+	name   string
+	codec  MetadataCodec[T]
+	policy MetadataPolicy
+}
+
+type stringCodec struct{}
+
+type int64Codec struct{}
+
+type jsonCodec[T any] struct{}
+
+var (
+	// StringCodec 为字符串的 MetadataCodec
+	StringCodec MetadataCodec[string] = stringCodec{}
+	// Int64Codec 为整数的 MetadataCodec
+	Int64Codec MetadataCodec[int64] = int64Codec{}
+)
+
+var (
+	// 元数据名 -> 传播策略
+	metadataPolicies = struct {
+		mu       sync.RWMutex
+		policies map[string]MetadataPolicy
+	}{
+		policies: make(map[string]MetadataPolicy),
+	}
+)
+
+// NewMetadataKey 定义一个强类型的元数据 key，传播策略会按名字登记下来，因此两端都应当定义同样的 key；
+// 没有定义 key 的元数据（例如通过 WithOutgoingMetadata 设置的）策略为 PropagateAll。重复定义同名的 key 会 panic
+func NewMetadataKey[T any](name string, codec MetadataCodec[T], policy MetadataPolicy) *MetadataKey[T] {
+	metadataPolicies.mu.Lock()
+	defer metadataPolicies.mu.Unlock()
+	if _, ok := metadataPolicies.policies[name]; ok {
+		panic(ErrMetadataConflict)
+	}
+	metadataPolicies.policies[name] = policy
+	return &MetadataKey[T]{
+		name:   name,
+		codec:  codec,
+		policy: policy,
+	}
+}
+
+// JSONCodec 返回使用 json 编码的 MetadataCodec
+func JSONCodec[T any]() MetadataCodec[T] {
+	return jsonCodec[T]{}
+}
+
+// metadataPolicy 返回元数据的传播策略
+func metadataPolicy(name string) MetadataPolicy {
+	metadataPolicies.mu.RLock()
+	defer metadataPolicies.mu.RUnlock()
+	return metadataPolicies.policies[name]
+}
+
+// Name 返回元数据名
+func (k *MetadataKey[T]) Name() string {
+	return k.name
+}
+
+// Policy 返回传播策略
+func (k *MetadataKey[T]) Policy() MetadataPolicy {
+	return k.policy
+}
+
+// Get 返回 ctx 中该元数据的值，本地设置的优先于从上一跳收到的；不存在或解码失败时 ok 为 false
+func (k *MetadataKey[T]) Get(ctx context.Context) (v T, ok bool) {
+	s, ok := metadataValue(ctx, k.name)
+	if !ok {
+		return v, false
+	}
+	v, err := k.codec.Decode(s)
+	if err != nil {
+		return v, false
+	}
+	return v, true
+}
+
+// With 返回设置了该元数据的 Context
+func (k *MetadataKey[T]) With(ctx context.Context, v T) context.Context {
+	return WithOutgoingMetadata(ctx, map[string]string{k.name: k.codec.Encode(v)})
+}
+
+func (stringCodec) Encode(v string) string {
+	return v
+}
+
+func (stringCodec) Decode(s string) (string, error) {
+	return s, nil
+}
+
+func (int64Codec) Encode(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+func (int64Codec) Decode(s string) (int64, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func (jsonCodec[T]) Encode(v T) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (jsonCodec[T]) Decode(s string) (T, error) {
+	v := *new(T)
+	err := json.Unmarshal([]byte(s), &v)
+	return v, err
+}
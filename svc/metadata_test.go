@@ -0,0 +1,101 @@
+package libsvc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type traceInfo struct {
+	ID   string `json:"id"`
+	Span int    `json:"span"`
+}
+
+var (
+	mdUserKey  = NewMetadataKey("test.user", StringCodec, PropagateAll)
+	mdHopKey   = NewMetadataKey("test.hop", Int64Codec, PropagateNextHop)
+	mdLocalKey = NewMetadataKey("test.local", JSONCodec[traceInfo](), LocalOnly)
+)
+
+func TestMetadata(t *testing.T) {
+	a := assert.New(t)
+
+	a.Panics(func() {
+		NewMetadataKey("test.user", StringCodec, LocalOnly)
+	}, "Expect panic since duplicated key")
+
+	// 写时复制
+	ctx := context.Background()
+	a.Nil(Passthru(ctx))
+	ctx1 := WithPassthru(ctx, map[string]string{"a": "1"})
+	ctx2 := WithPassthru(ctx1, map[string]string{"b": "2"})
+	ctx3 := WithPassthru(ctx1, map[string]string{"c": "3"})
+	a.Equal(map[string]string{"a": "1"}, Passthru(ctx1))
+	a.Equal(map[string]string{"a": "1", "b": "2"}, Passthru(ctx2))
+	a.Equal(map[string]string{"a": "1", "c": "3"}, Passthru(ctx3))
+	Passthru(ctx1)["x"] = "y"
+	a.Equal(map[string]string{"a": "1"}, Passthru(ctx1))
+
+	// 强类型 key
+	ctx = mdUserKey.With(ctx, "alice")
+	ctx = mdHopKey.With(ctx, 1)
+	ctx = mdLocalKey.With(ctx, traceInfo{ID: "t", Span: 2})
+	user, ok := mdUserKey.Get(ctx)
+	a.True(ok)
+	a.Equal("alice", user)
+	hop, ok := mdHopKey.Get(ctx)
+	a.True(ok)
+	a.Equal(int64(1), hop)
+	info, ok := mdLocalKey.Get(ctx)
+	a.True(ok)
+	a.Equal(traceInfo{ID: "t", Span: 2}, info)
+	_, ok = mdUserKey.Get(context.Background())
+	a.False(ok)
+	_, ok = mdHopKey.Get(WithPassthru(ctx, map[string]string{"test.hop": "x"}))
+	a.False(ok, "Expect false since decode failed")
+
+	// 传到下一跳：不包括 LocalOnly
+	outgoing := OutgoingMetadata(ctx)
+	a.Equal(map[string]string{"test.user": "alice", "test.hop": "1"}, outgoing)
+
+	// 下一跳收到：本地设置的覆盖收到的，PropagateNextHop 不再继续传播
+	next := WithIncomingMetadata(context.Background(), outgoing)
+	a.Equal(outgoing, IncomingMetadata(next))
+	hop, ok = mdHopKey.Get(next)
+	a.True(ok)
+	a.Equal(int64(1), hop)
+	a.Equal(map[string]string{"test.user": "alice"}, OutgoingMetadata(next))
+	next = mdUserKey.With(next, "bob")
+	a.Equal(map[string]string{"test.user": "bob"}, OutgoingMetadata(next))
+	a.Equal("alice", IncomingMetadata(next)["test.user"])
+
+	a.Equal(len("test.user")+len("alice"), MetadataSize(map[string]string{"test.user": "alice"}))
+}
+
+func TestInprocMetadata(t *testing.T) {
+	a := assert.New(t)
+
+	type result struct {
+		incoming map[string]string
+		outgoing map[string]string
+	}
+	method := NewTypedMethod[struct{}, struct{}]("md")
+	results := make(chan result, 1)
+	svc := NewLocalService("metadata.inproc", method, method.Handler(func(ctx context.Context, _, _ *struct{}) error {
+		results <- result{IncomingMetadata(ctx), OutgoingMetadata(ctx)}
+		return nil
+	}))
+	a.NoError(InprocServer().Register(svc))
+	defer InprocServer().Deregister(svc.Name())
+
+	// 进程内调用跟远程调用一样：LocalOnly 不会传过去，PropagateNextHop 不再继续传播
+	ctx := mdUserKey.With(context.Background(), "alice")
+	ctx = mdHopKey.With(ctx, 1)
+	ctx = mdLocalKey.With(ctx, traceInfo{ID: "t"})
+	_, err := method.Invoke(ctx, InprocClient().Make("metadata.inproc"), &struct{}{})
+	a.NoError(err)
+	r := <-results
+	a.Equal(map[string]string{"test.user": "alice", "test.hop": "1"}, r.incoming)
+	a.Equal(map[string]string{"test.user": "alice"}, r.outgoing)
+}
@@ -0,0 +1,82 @@
+package libsvc
+
+import (
+	"sync"
+	"time"
+)
+
+// MethodMeta 是方法的可选元数据，中间件（例如重试，超时）以及工具（例如文档，内省）可以据此调整行为，
+// 而不需要另外配置
+type MethodMeta struct {
+	// Description 为方法的说明
+	Description string
+
+	// Idempotent 表示方法是幂等的，重复调用是安全的（例如可以重试）
+	Idempotent bool
+
+	// ReadOnly 表示方法是只读的，没有副作用；只读的方法也是幂等的
+	ReadOnly bool
+
+	// Timeout 为调用方法的默认超时，0 表示没有
+	Timeout time.Duration
+
+	// Deprecated 不为空时表示方法已弃用，内容为弃用说明（例如替代的方法）
+	Deprecated string
+
+	// Tags 为方法的标签，用于分组
+	Tags []string
+}
+
+// MethodWithMeta 是带有元数据的 Method，自定义的 Method 可以实现该接口来提供元数据
+type MethodWithMeta interface {
+	Method
+
+	// Meta 返回方法的元数据
+	Meta() MethodMeta
+}
+
+var (
+	// Method -> 元数据
+	methodMetas = struct {
+		mu    sync.RWMutex
+		metas map[Method]MethodMeta
+	}{
+		metas: make(map[Method]MethodMeta),
+	}
+)
+
+// WithMethodMeta 为方法登记元数据（替换原来的）并返回该方法，一般在定义方法时使用：
+//
+//	var GetMethod = libsvc.WithMethodMeta(libsvc.NewTypedMethod[In, Out]("get"), libsvc.MethodMeta{
+//	  ReadOnly: true,
+//	  Timeout:  time.Second,
+//	})
+func WithMethodMeta[M Method](method M, meta MethodMeta) M {
+	meta.Tags = append([]string(nil), meta.Tags...)
+	methodMetas.mu.Lock()
+	methodMetas.metas[method] = meta
+	methodMetas.mu.Unlock()
+	return method
+}
+
+// MethodMetaOf 返回方法的元数据：实现了 MethodWithMeta 的优先，其次是通过 WithMethodMeta 登记的，都没有时返回零值
+func MethodMetaOf(method Method) MethodMeta {
+	if m, ok := method.(MethodWithMeta); ok {
+		return m.Meta()
+	}
+	methodMetas.mu.RLock()
+	meta := methodMetas.metas[method]
+	methodMetas.mu.RUnlock()
+	meta.Tags = append([]string(nil), meta.Tags...)
+	return meta
+}
+
+// IsIdempotent 判断方法是否幂等：Idempotent 或 ReadOnly
+func (meta MethodMeta) IsIdempotent() bool {
+	return meta.Idempotent || meta.ReadOnly
+}
+
+// IsDeprecated 判断方法是否已弃用
+func (meta MethodMeta) IsDeprecated() bool {
+	return meta.Deprecated != ""
+}
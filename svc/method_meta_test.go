@@ -0,0 +1,54 @@
+package libsvc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type metaMethod struct {
+	*TypedMethod[addInput, addOutput]
+}
+
+func (m metaMethod) Meta() MethodMeta {
+	return MethodMeta{Idempotent: true}
+}
+
+func TestMethodMeta(t *testing.T) {
+	a := assert.New(t)
+
+	// 没有元数据时返回零值
+	plain := NewTypedMethod[addInput, addOutput]("plain")
+	a.Equal(MethodMeta{}, MethodMetaOf(plain))
+	a.False(MethodMetaOf(plain).IsIdempotent())
+
+	// 登记元数据，返回原方法
+	tags := []string{"math"}
+	add := NewTypedMethod[addInput, addOutput]("add")
+	a.True(add == WithMethodMeta(add, MethodMeta{
+		ReadOnly:   true,
+		Timeout:    time.Second,
+		Deprecated: "use sum",
+		Tags:       tags,
+	}))
+	meta := MethodMetaOf(add)
+	a.True(meta.IsIdempotent())
+	a.True(meta.IsDeprecated())
+	a.Equal(time.Second, meta.Timeout)
+	a.Equal([]string{"math"}, meta.Tags)
+
+	// 元数据不受外部修改影响
+	tags[0] = "x"
+	meta.Tags[0] = "y"
+	a.Equal([]string{"math"}, MethodMetaOf(add).Tags)
+
+	// 流式方法
+	newEmpty := func() interface{} { return &struct{}{} }
+	stream := WithMethodMeta(NewStreamMethod("stream", newEmpty, newEmpty), MethodMeta{Description: "stream"})
+	a.Equal("stream", MethodMetaOf(stream).Description)
+
+	// MethodWithMeta 优先
+	m := metaMethod{NewTypedMethod[addInput, addOutput]("meta")}
+	a.True(MethodMetaOf(m).Idempotent)
+}
@@ -12,14 +12,21 @@ type ServiceMiddleware func(ServiceHandler) ServiceHandler
 
 type decSvc struct {
 	svc Service
+	t   *terminal
 	h   ServiceHandler
 }
 
 type decSvcWithItf struct {
 	svc ServiceWithInterface
+	t   *terminal
 	h   ServiceHandler
 }
 
+// terminal 是中间件链的最内层，调用被装饰的服务
+type terminal struct {
+	svc Service
+}
+
 type decClient struct {
 	client ServiceClient
 	mws    []ServiceMiddleware
@@ -30,26 +37,34 @@ type decServer struct {
 	mws    []ServiceMiddleware
 }
 
-// DecorateService 为 Service 添加中间件，mws[0] 是最外层中间件
+type svcNameKeyType struct{}
+
+var svcNameKey = svcNameKeyType{}
+
+// DecorateService 为 Service 添加中间件，mws[0] 是最外层中间件；中间件同样作用于流式方法，见 StreamOutput
 func DecorateService(svc Service, mws ...ServiceMiddleware) Service {
-	h := svc.Invoke
+	t := &terminal{svc: svc}
+	h := ServiceHandler(t.invoke)
 	for i := len(mws) - 1; i >= 0; i-- {
 		h = mws[i](h)
 	}
 	return &decSvc{
 		svc: svc,
+		t:   t,
 		h:   h,
 	}
 }
 
-// DecorateServiceWithInterface 为 ServiceWithInterface 添加中间件，mws[0] 是最外层中间件
+// DecorateServiceWithInterface 为 ServiceWithInterface 添加中间件，mws[0] 是最外层中间件；中间件同样作用于流式方法，见 StreamOutput
 func DecorateServiceWithInterface(svc ServiceWithInterface, mws ...ServiceMiddleware) ServiceWithInterface {
-	h := svc.Invoke
+	t := &terminal{svc: svc}
+	h := ServiceHandler(t.invoke)
 	for i := len(mws) - 1; i >= 0; i-- {
 		h = mws[i](h)
 	}
 	return &decSvcWithItf{
 		svc: svc,
+		t:   t,
 		h:   h,
 	}
 }
@@ -77,9 +92,15 @@ func (svc *decSvc) Name() string {
 	return svc.svc.Name()
 }
 
+// ServiceName 返回当前调用的服务名，在中间件中使用；不是经过 DecorateXXX 装饰的服务调用时返回空字符串
+func ServiceName(ctx context.Context) string {
+	name, _ := ctx.Value(svcNameKey).(string)
+	return name
+}
+
 // Invoke 实现 Service 接口
 func (svc *decSvc) Invoke(ctx context.Context, method Method, input, output interface{}) error {
-	return svc.h(ctx, method, input, output)
+	return svc.h(context.WithValue(ctx, svcNameKey, svc.svc.Name()), method, input, output)
 }
 
 // Name 实现 Service 接口
@@ -89,7 +110,7 @@ func (svc *decSvcWithItf) Name() string {
 
 // Invoke 实现 Service 接口
 func (svc *decSvcWithItf) Invoke(ctx context.Context, method Method, input, output interface{}) error {
-	return svc.h(ctx, method, input, output)
+	return svc.h(context.WithValue(ctx, svcNameKey, svc.svc.Name()), method, input, output)
 }
 
 // Interface 实现 ServiceWithInterface 接口
@@ -111,3 +132,17 @@ func (server *decServer) Register(svc ServiceWithInterface) error {
 func (server *decServer) Deregister(svcName string) error {
 	return server.server.Deregister(svcName)
 }
+
+// invoke 是中间件链最内层的 ServiceHandler：出参为 *StreamOutput 时调用流式方法，批量调用中的子调用汇总后一次过调用，
+// 否则直接调用被装饰的服务
+func (t *terminal) invoke(ctx context.Context, method Method, input, output interface{}) error {
+	if so, ok := output.(*StreamOutput); ok {
+		return t.invokeStream(ctx, method.(StreamMethod), input, so)
+	}
+	if slot := batchSlotFromContext(ctx); slot != nil && slot.batch.t == t {
+		if ok, err := slot.batch.arrive(ctx, slot, method, input, output); ok {
+			return err
+		}
+	}
+	return t.svc.Invoke(ctx, method, input, output)
+}
@@ -0,0 +1,82 @@
+package authmw
+
+import (
+	"encoding/json"
+	"io"
+	"path"
+)
+
+// ACL 为访问控制列表，一般从配置中加载，例如：
+//
+//	{
+//	  "rules": [
+//	    {"service": "user.*", "method": "get*", "roles": ["reader"]},
+//	    {"service": "user.admin", "subjects": ["ops"]}
+//	  ]
+//	}
+//
+// 只要有一条规则允许，调用即被允许，否则拒绝
+type ACL struct {
+	Rules []*ACLRule `json:"rules"`
+}
+
+// ACLRule 为一条允许规则：服务名与方法名都匹配（path.Match 的模式，为空时匹配所有），
+// 且调用者的 Subject 在 Subjects 中或有 Roles 中的任一角色（"*" 表示任意已认证的调用者）
+type ACLRule struct {
+	Service  string   `json:"service,omitempty"`
+	Method   string   `json:"method,omitempty"`
+	Subjects []string `json:"subjects,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// LoadACL 从 json 中加载 ACL，会检查各个模式是否合法
+func LoadACL(r io.Reader) (*ACL, error) {
+	acl := &ACL{}
+	if err := json.NewDecoder(r).Decode(acl); err != nil {
+		return nil, err
+	}
+	for _, rule := range acl.Rules {
+		for _, pattern := range []string{rule.Service, rule.Method} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return acl, nil
+}
+
+// Allow 返回是否允许调用者 p 调用服务 svcName 的方法 methodName
+func (acl *ACL) Allow(p *Principal, svcName, methodName string) bool {
+	for _, rule := range acl.Rules {
+		if rule.match(svcName, methodName) && rule.allow(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *ACLRule) match(svcName, methodName string) bool {
+	return matchPattern(rule.Service, svcName) && matchPattern(rule.Method, methodName)
+}
+
+func (rule *ACLRule) allow(p *Principal) bool {
+	for _, subject := range rule.Subjects {
+		if subject == "*" || subject == p.Subject {
+			return true
+		}
+	}
+	for _, role := range rule.Roles {
+		if role == "*" || p.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPattern(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
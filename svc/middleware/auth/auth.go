@@ -0,0 +1,128 @@
+// authmw 提供服务调用的认证与授权：客户端中间件为每次调用签发凭证并放到元数据中，
+// 服务端中间件校验凭证，将调用者（Principal）放到 ctx 中，并按 ACL 检查是否允许调用该服务的方法
+package authmw
+
+import (
+	"context"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/rs/zerolog"
+)
+
+// Principal 代表调用者
+type Principal struct {
+	// Subject 为调用者的标识，例如服务名或用户 ID
+	Subject string `json:"sub"`
+
+	// Roles 为调用者的角色
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Signer 为调用者签发凭证
+type Signer interface {
+	Sign(p *Principal) (credential string, err error)
+}
+
+// Verifier 校验凭证，返回凭证所代表的调用者
+type Verifier interface {
+	Verify(credential string) (*Principal, error)
+}
+
+// Option 是创建服务端中间件时的选项
+type Option func(*server)
+
+type server struct {
+	verifier Verifier
+	acl      *ACL
+	logger   zerolog.Logger
+}
+
+type principalKeyType struct{}
+
+var principalKey = principalKeyType{}
+
+var (
+	// CredentialKey 为凭证的元数据 key，只传到下一跳：每一跳都以自己的身份重新签发
+	CredentialKey = libsvc.NewMetadataKey("authorization", libsvc.StringCodec, libsvc.PropagateNextHop)
+)
+
+// OptACL 设置 ACL，没有设置时只认证而不检查权限
+func OptACL(acl *ACL) Option {
+	return func(s *server) {
+		s.acl = acl
+	}
+}
+
+// OptLogger 设置 logger，认证失败或没有权限时会记录日志
+func OptLogger(logger *zerolog.Logger) Option {
+	return func(s *server) {
+		s.logger = logger.With().Str("comp", "svc.auth").Logger()
+	}
+}
+
+// NewClient 创建一个客户端中间件，一般通过 libsvc.DecorateClient 安装：以 principal 的身份签发凭证并放到元数据中
+func NewClient(signer Signer, principal *Principal) libsvc.ServiceMiddleware {
+	return func(h libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(ctx context.Context, method libsvc.Method, input, output interface{}) error {
+			credential, err := signer.Sign(principal)
+			if err != nil {
+				return err
+			}
+			return h(CredentialKey.With(ctx, credential), method, input, output)
+		}
+	}
+}
+
+// NewServer 创建一个服务端中间件，一般通过 libsvc.DecorateServer 安装：没有凭证或凭证无效时返回 libsvc.ErrUnauthenticated，
+// ACL 不允许时返回 libsvc.ErrPermissionDenied（包括流式方法）；处理器可以通过 PrincipalFromContext 获得调用者
+func NewServer(verifier Verifier, opts ...Option) libsvc.ServiceMiddleware {
+	s := &server{
+		verifier: verifier,
+		logger:   zerolog.Nop(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return func(h libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(ctx context.Context, method libsvc.Method, input, output interface{}) error {
+			svcName := libsvc.ServiceName(ctx)
+			credential, ok := CredentialKey.Get(ctx)
+			if !ok {
+				s.logger.Warn().Str("svc", svcName).Str("method", method.Name()).Msg("No credential")
+				return libsvc.ErrUnauthenticated
+			}
+			principal, err := s.verifier.Verify(credential)
+			if err != nil {
+				s.logger.Warn().Str("svc", svcName).Str("method", method.Name()).Err(err).Msg("Bad credential")
+				return libsvc.ErrUnauthenticated
+			}
+			if s.acl != nil && !s.acl.Allow(principal, svcName, method.Name()) {
+				s.logger.Warn().Str("svc", svcName).Str("method", method.Name()).Str("sub", principal.Subject).Msg("Permission denied")
+				return libsvc.ErrPermissionDenied
+			}
+			return h(ContextWithPrincipal(ctx, principal), method, input, output)
+		}
+	}
+}
+
+// PrincipalFromContext 返回 ctx 中的调用者，没有时返回 nil
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey).(*Principal)
+	return p
+}
+
+// ContextWithPrincipal 返回带有调用者 p 的 ctx
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// HasRole 返回调用者是否有角色 role
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package authmw
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	getMethod    = libsvc.NewTypedMethod[struct{}, Principal]("getUser")
+	deleteMethod = libsvc.NewTypedMethod[struct{}, Principal]("deleteUser")
+	watchMethod  = libsvc.NewTypedStreamMethod[struct{}, Principal]("watchUser")
+)
+
+var (
+	testKey = []byte("0123456789abcdef0123456789abcdef")
+)
+
+func newUserService() libsvc.Service {
+	handler := func(ctx context.Context, _ *struct{}, output *Principal) error {
+		*output = *PrincipalFromContext(ctx)
+		return nil
+	}
+	return libsvc.NewLocalService(
+		"user.svc",
+		getMethod, getMethod.Handler(handler),
+		deleteMethod, deleteMethod.Handler(handler),
+		watchMethod, watchMethod.Handler(func(ctx context.Context, _ *struct{}, send func(*Principal) error) error {
+			return send(PrincipalFromContext(ctx))
+		}),
+	)
+}
+
+func TestAuth(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	acl, err := LoadACL(strings.NewReader(`{
+		"rules": [
+			{"service": "user.*", "method": "get*", "roles": ["reader"]},
+			{"service": "user.svc", "subjects": ["ops"]}
+		]
+	}`))
+	a.NoError(err)
+	jwt := NewJWT(testKey)
+	server := libsvc.DecorateService(newUserService(), NewServer(jwt, OptACL(acl)))
+	client := func(p *Principal) libsvc.Service {
+		return libsvc.DecorateService(server, NewClient(jwt, p))
+	}
+
+	// 调用者传到处理器中
+	reader := &Principal{Subject: "alice", Roles: []string{"reader"}}
+	p, err := getMethod.Invoke(ctx, client(reader), &struct{}{})
+	a.NoError(err)
+	a.Equal(reader, p)
+
+	// ACL
+	_, err = deleteMethod.Invoke(ctx, client(reader), &struct{}{})
+	a.True(errors.Is(err, libsvc.ErrPermissionDenied))
+	_, err = deleteMethod.Invoke(ctx, client(&Principal{Subject: "ops"}), &struct{}{})
+	a.NoError(err)
+
+	// 没有凭证或凭证无效
+	_, err = getMethod.Invoke(ctx, server, &struct{}{})
+	a.True(errors.Is(err, libsvc.ErrUnauthenticated))
+	_, err = getMethod.Invoke(ctx, libsvc.DecorateService(server, NewClient(NewJWT([]byte(strings.Repeat("x", MinJWTKeySize))), reader)), &struct{}{})
+	a.True(errors.Is(err, libsvc.ErrUnauthenticated))
+
+	// 流式方法同样需要凭证
+	_, err = watchMethod.Invoke(ctx, server, &struct{}{})
+	a.True(errors.Is(err, libsvc.ErrUnauthenticated))
+	_, err = watchMethod.Invoke(ctx, client(reader), &struct{}{})
+	a.True(errors.Is(err, libsvc.ErrPermissionDenied))
+	ops := &Principal{Subject: "ops"}
+	stream, err := watchMethod.Invoke(ctx, client(ops), &struct{}{})
+	a.NoError(err)
+	p, err = stream.Recv()
+	a.NoError(err)
+	a.Equal(ops, p)
+	stream.Close()
+
+	// 凭证从上一跳传来
+	credential, _ := jwt.Sign(reader)
+	_, err = getMethod.Invoke(libsvc.WithIncomingMetadata(ctx, map[string]string{"authorization": credential}), server, &struct{}{})
+	a.NoError(err)
+
+	// 凭证只传到下一跳
+	a.Nil(libsvc.OutgoingMetadata(libsvc.WithIncomingMetadata(ctx, map[string]string{"authorization": credential})))
+
+	_, err = LoadACL(strings.NewReader(`{"rules": [{"service": "["}]}`))
+	a.Error(err)
+}
+
+func TestJWT(t *testing.T) {
+	a := assert.New(t)
+
+	a.PanicsWithValue(ErrShortJWTKey, func() { NewJWT(nil) })
+	a.PanicsWithValue(ErrShortJWTKey, func() { NewJWT([]byte("secret")) })
+
+	now := time.Now()
+	jwt := NewJWT(testKey, OptJWTTTL(time.Minute), OptJWTLeeway(time.Second))
+	jwt.now = func() time.Time { return now }
+
+	token, err := jwt.Sign(&Principal{Subject: "alice"})
+	a.NoError(err)
+	p, err := jwt.Verify(token)
+	a.NoError(err)
+	a.Equal("alice", p.Subject)
+
+	// 篡改
+	parts := strings.Split(token, ".")
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"root","exp":9999999999}`))
+	_, err = jwt.Verify(parts[0] + "." + payload + "." + parts[2])
+	a.Equal(errBadJWTSig, err)
+
+	// 不接受 alg none
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	_, err = jwt.Verify(none + "." + payload + ".")
+	a.Equal(errBadJWTAlg, err)
+
+	_, err = jwt.Verify("abc")
+	a.Equal(errBadJWT, err)
+
+	// 过期
+	now = now.Add(time.Minute + 2*time.Second)
+	_, err = jwt.Verify(token)
+	a.Equal(errJWTExpired, err)
+}
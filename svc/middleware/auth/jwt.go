@@ -0,0 +1,165 @@
+package authmw
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// DefaultJWTTTL 为默认签发的 JWT 的有效期，每次调用都会签发新的 JWT，因此可以很短
+	DefaultJWTTTL = time.Minute
+	// DefaultJWTLeeway 为默认校验有效期时允许的时钟偏差
+	DefaultJWTLeeway = 5 * time.Second
+)
+
+const (
+	// MinJWTKeySize 为 JWT 密钥的最小长度（字节），即 HS256 的输出长度
+	MinJWTKeySize = sha256.Size
+)
+
+var (
+	// ErrShortJWTKey 在 JWT 的密钥太短时 panic：密钥为空或很短时任何人都可以签发凭证
+	ErrShortJWTKey = errors.New("JWT key is too short")
+)
+
+var (
+	errBadJWT     = errors.New("Bad JWT")
+	errBadJWTAlg  = errors.New("Unsupported JWT alg")
+	errBadJWTSig  = errors.New("Bad JWT signature")
+	errJWTExpired = errors.New("JWT expired")
+)
+
+// JWT 使用本地的密钥签发及校验 HS256 的 JWT，它同时实现了 Signer 与 Verifier 接口
+type JWT struct {
+	key    []byte
+	ttl    time.Duration
+	leeway time.Duration
+	now    func() time.Time
+}
+
+// JWTOption 是创建 JWT 时的选项
+type JWTOption func(*JWT)
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+type jwtClaims struct {
+	Principal
+	IssuedAt  int64 `json:"iat"`
+	ExpiresAt int64 `json:"exp"`
+}
+
+var (
+	_ Signer   = (*JWT)(nil)
+	_ Verifier = (*JWT)(nil)
+)
+
+var (
+	// 签发时使用的 header，已经编码
+	jwtHS256Header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+)
+
+// OptJWTTTL 设置签发的 JWT 的有效期，默认为 DefaultJWTTTL
+func OptJWTTTL(ttl time.Duration) JWTOption {
+	return func(j *JWT) {
+		j.ttl = ttl
+	}
+}
+
+// OptJWTLeeway 设置校验有效期时允许的时钟偏差，默认为 DefaultJWTLeeway
+func OptJWTLeeway(leeway time.Duration) JWTOption {
+	return func(j *JWT) {
+		j.leeway = leeway
+	}
+}
+
+// NewJWT 使用密钥 key 创建一个 JWT，通信的双方需要使用相同的密钥；key 短于 MinJWTKeySize 时 panic(ErrShortJWTKey)
+func NewJWT(key []byte, opts ...JWTOption) *JWT {
+	if len(key) < MinJWTKeySize {
+		panic(ErrShortJWTKey)
+	}
+	j := &JWT{
+		key:    append([]byte(nil), key...),
+		ttl:    DefaultJWTTTL,
+		leeway: DefaultJWTLeeway,
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+// Sign 实现 Signer 接口
+func (j *JWT) Sign(p *Principal) (string, error) {
+	now := j.now()
+	payload, err := json.Marshal(&jwtClaims{
+		Principal: *p,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(j.ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := jwtHS256Header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(j.sign(signingInput)), nil
+}
+
+// Verify 实现 Verifier 接口，只接受 HS256
+func (j *JWT) Verify(credential string) (*Principal, error) {
+	parts := strings.Split(credential, ".")
+	if len(parts) != 3 {
+		return nil, errBadJWT
+	}
+
+	header := jwtHeader{}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "HS256" {
+		return nil, errBadJWTAlg
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errBadJWT
+	}
+	if !hmac.Equal(sig, j.sign(parts[0]+"."+parts[1])) {
+		return nil, errBadJWTSig
+	}
+
+	claims := jwtClaims{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if j.now().Add(-j.leeway).Unix() > claims.ExpiresAt {
+		return nil, errJWTExpired
+	}
+	if claims.Subject == "" {
+		return nil, errBadJWT
+	}
+	return &claims.Principal, nil
+}
+
+func (j *JWT) sign(signingInput string) []byte {
+	mac := hmac.New(sha256.New, j.key)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errBadJWT
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errBadJWT
+	}
+	return nil
+}
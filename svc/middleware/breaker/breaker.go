@@ -0,0 +1,325 @@
+// breakermw 提供一个熔断的 libsvc.ServiceMiddleware：按服务名 + 方法名统计失败率，失败率过高时熔断（快速失败），
+// 一段时间后进入半开状态放行少量探测请求，探测成功则恢复
+package breakermw
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	retrymw "github.com/huangjunwen/platform-kit/svc/middleware/retry"
+	"github.com/rs/zerolog"
+)
+
+// State 为熔断器的状态
+type State int
+
+const (
+	// StateClosed 为正常状态
+	StateClosed State = iota
+	// StateOpen 为熔断状态，所有调用都马上返回 ErrOpen
+	StateOpen
+	// StateHalfOpen 为半开状态，只放行少量探测调用
+	StateHalfOpen
+)
+
+var (
+	// ErrOpen 在熔断时返回
+	ErrOpen = errors.New("Circuit breaker is open")
+)
+
+var (
+	// DefaultInterval 为默认统计失败率的时间窗口
+	DefaultInterval = 10 * time.Second
+	// DefaultMinRequests 为默认窗口内触发熔断所需的最少调用次数
+	DefaultMinRequests = 10
+	// DefaultFailureRatio 为默认触发熔断的失败率
+	DefaultFailureRatio = 0.5
+	// DefaultOpenTimeout 为默认熔断持续的时间，之后进入半开状态
+	DefaultOpenTimeout = 5 * time.Second
+	// DefaultHalfOpenProbes 为默认半开状态下最多同时放行的探测调用数
+	DefaultHalfOpenProbes = 1
+)
+
+// Option 是创建熔断中间件时的选项
+type Option func(*breakers)
+
+// result 为调用的结果
+type result int
+
+const (
+	resultSuccess result = iota
+	resultFailure
+	// resultIgnored 表示调用被调用方取消，不能说明下游是否正常，不计入统计
+	resultIgnored
+)
+
+type breakers struct {
+	interval       time.Duration
+	minRequests    int
+	failureRatio   float64
+	openTimeout    time.Duration
+	halfOpenProbes int
+	failure        func(error) bool
+	onStateChange  func(svcName, methodName string, from, to State)
+	logger         zerolog.Logger
+	now            func() time.Time
+
+	mu sync.Mutex
+	bs map[breakerKey]*breaker
+}
+
+type breakerKey struct {
+	svcName    string
+	methodName string
+}
+
+// breaker 为单个服务方法的熔断器
+type breaker struct {
+	key breakerKey
+	mu  sync.Mutex
+	// state 每次变化时 generation 加一，用于忽略旧状态下发出的调用的结果
+	state      State
+	generation uint64
+	// 当前窗口（或熔断）的结束时间
+	expiry   time.Time
+	requests int
+	failures int
+	// 半开状态下正在进行的探测调用数
+	probes int
+}
+
+// OptInterval 设置统计失败率的时间窗口，默认为 DefaultInterval
+func OptInterval(interval time.Duration) Option {
+	return func(bs *breakers) {
+		bs.interval = interval
+	}
+}
+
+// OptThreshold 设置触发熔断的条件：窗口内调用次数不少于 minRequests 且失败率不低于 failureRatio
+func OptThreshold(minRequests int, failureRatio float64) Option {
+	return func(bs *breakers) {
+		bs.minRequests = minRequests
+		bs.failureRatio = failureRatio
+	}
+}
+
+// OptOpenTimeout 设置熔断持续的时间，默认为 DefaultOpenTimeout
+func OptOpenTimeout(timeout time.Duration) Option {
+	return func(bs *breakers) {
+		bs.openTimeout = timeout
+	}
+}
+
+// OptHalfOpenProbes 设置半开状态下最多同时放行的探测调用数，默认为 DefaultHalfOpenProbes
+func OptHalfOpenProbes(n int) Option {
+	return func(bs *breakers) {
+		if n < 1 {
+			n = 1
+		}
+		bs.halfOpenProbes = n
+	}
+}
+
+// OptFailure 设置判断调用是否失败的函数（err 非 nil），默认为 retrymw.IsTransient：
+// 业务错误说明下游是正常的，不应该计为失败；被取消（context.Canceled）的调用总是不计入统计
+func OptFailure(failure func(error) bool) Option {
+	return func(bs *breakers) {
+		bs.failure = failure
+	}
+}
+
+// OptOnStateChange 设置状态变化时的回调，例如用于监控
+func OptOnStateChange(fn func(svcName, methodName string, from, to State)) Option {
+	return func(bs *breakers) {
+		bs.onStateChange = fn
+	}
+}
+
+// OptLogger 设置 logger，状态变化时会记录日志
+func OptLogger(logger *zerolog.Logger) Option {
+	return func(bs *breakers) {
+		bs.logger = logger.With().Str("comp", "svc.breaker").Logger()
+	}
+}
+
+// New 创建一个熔断中间件，一般通过 libsvc.DecorateClient 安装；服务名由 libsvc.ServiceName 获得
+func New(opts ...Option) libsvc.ServiceMiddleware {
+	bs := &breakers{
+		interval:       DefaultInterval,
+		minRequests:    DefaultMinRequests,
+		failureRatio:   DefaultFailureRatio,
+		openTimeout:    DefaultOpenTimeout,
+		halfOpenProbes: DefaultHalfOpenProbes,
+		failure:        retrymw.IsTransient,
+		logger:         zerolog.Nop(),
+		now:            time.Now,
+		bs:             make(map[breakerKey]*breaker),
+	}
+	for _, opt := range opts {
+		opt(bs)
+	}
+
+	return func(h libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(ctx context.Context, method libsvc.Method, input, output interface{}) error {
+			b := bs.get(breakerKey{
+				svcName:    libsvc.ServiceName(ctx),
+				methodName: method.Name(),
+			})
+
+			generation, err := bs.before(b)
+			if err != nil {
+				return err
+			}
+			// 处理器 panic 时计为失败，panic 继续往外传
+			res := resultFailure
+			defer func() {
+				bs.after(b, generation, res)
+			}()
+			err = h(ctx, method, input, output)
+			res = bs.result(err)
+			return err
+		}
+	}
+}
+
+func (bs *breakers) get(key breakerKey) *breaker {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b := bs.bs[key]
+	if b == nil {
+		b = &breaker{
+			key:    key,
+			expiry: bs.now().Add(bs.interval),
+		}
+		bs.bs[key] = b
+	}
+	return b
+}
+
+// before 在调用前检查是否放行
+func (bs *breakers) before(b *breaker) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bs.refresh(b, bs.now())
+	switch b.state {
+	case StateOpen:
+		return 0, ErrOpen
+	case StateHalfOpen:
+		if b.probes >= bs.halfOpenProbes {
+			return 0, ErrOpen
+		}
+		b.probes++
+	}
+	b.requests++
+	return b.generation, nil
+}
+
+// result 判断调用的结果
+func (bs *breakers) result(err error) result {
+	switch {
+	case err == nil:
+		return resultSuccess
+	case errors.Is(err, context.Canceled):
+		return resultIgnored
+	case bs.failure(err):
+		return resultFailure
+	default:
+		return resultSuccess
+	}
+}
+
+// after 在调用后记录结果
+func (bs *breakers) after(b *breaker, generation uint64, res result) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := bs.now()
+	bs.refresh(b, now)
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case StateClosed:
+		switch res {
+		case resultIgnored:
+			b.requests--
+		case resultFailure:
+			b.failures++
+			if b.requests >= bs.minRequests && float64(b.failures) >= bs.failureRatio*float64(b.requests) {
+				bs.setState(b, StateOpen, now)
+			}
+		}
+	case StateHalfOpen:
+		// 被取消的探测调用只释放名额，不改变状态
+		b.probes--
+		switch res {
+		case resultSuccess:
+			bs.setState(b, StateClosed, now)
+		case resultFailure:
+			bs.setState(b, StateOpen, now)
+		}
+	}
+}
+
+// refresh 处理时间窗口到期：正常状态下开始新的窗口，熔断状态下进入半开状态
+func (bs *breakers) refresh(b *breaker, now time.Time) {
+	if now.Before(b.expiry) {
+		return
+	}
+	switch b.state {
+	case StateClosed:
+		bs.setState(b, StateClosed, now)
+	case StateOpen:
+		bs.setState(b, StateHalfOpen, now)
+	}
+}
+
+func (bs *breakers) setState(b *breaker, state State, now time.Time) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.requests = 0
+	b.failures = 0
+	b.probes = 0
+	switch state {
+	case StateClosed:
+		b.expiry = now.Add(bs.interval)
+	case StateOpen:
+		b.expiry = now.Add(bs.openTimeout)
+	case StateHalfOpen:
+		// 半开状态没有期限，直到探测调用有结果
+		b.expiry = time.Time{}.Add(1<<63 - 1)
+	}
+	if from == state {
+		return
+	}
+
+	bs.logger.Warn().
+		Str("svc", b.key.svcName).
+		Str("method", b.key.methodName).
+		Str("from", from.String()).
+		Str("to", state.String()).
+		Msg("")
+	if bs.onStateChange != nil {
+		bs.onStateChange(b.key.svcName, b.key.methodName, from, state)
+	}
+}
+
+// String 实现 fmt.Stringer 接口
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
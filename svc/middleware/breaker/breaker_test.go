@@ -0,0 +1,198 @@
+package breakermw
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	echoMethod  = libsvc.NewTypedMethod[struct{}, struct{}]("echo")
+	otherMethod = libsvc.NewTypedMethod[struct{}, struct{}]("other")
+	errFatal    = errors.New("fatal")
+)
+
+func TestBreaker(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	var fail error
+	calls := 0
+	handler := func(context.Context, *struct{}, *struct{}) error {
+		calls++
+		return fail
+	}
+	svc := libsvc.NewLocalService(
+		"echo",
+		echoMethod, echoMethod.Handler(handler),
+		otherMethod, otherMethod.Handler(handler),
+	)
+
+	now := time.Now()
+	changes := []string{}
+	mw := New(
+		OptInterval(time.Minute),
+		OptThreshold(4, 0.5),
+		OptOpenTimeout(time.Second),
+		OptOnStateChange(func(svcName, methodName string, from, to State) {
+			changes = append(changes, svcName+"."+methodName+":"+from.String()+"->"+to.String())
+		}),
+		func(bs *breakers) {
+			bs.now = func() time.Time { return now }
+		},
+	)
+	dec := libsvc.DecorateService(svc, mw)
+	invoke := func(m *libsvc.TypedMethod[struct{}, struct{}]) error {
+		_, err := m.Invoke(ctx, dec, &struct{}{})
+		return err
+	}
+
+	// 业务错误不计为失败
+	fail = errFatal
+	for i := 0; i < 4; i++ {
+		a.Equal(errFatal, invoke(echoMethod))
+	}
+	a.Empty(changes)
+
+	// 调用次数不足时不熔断
+	fail = libsvc.Unavailable(errors.New("conn closed"))
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		a.True(errors.Is(invoke(echoMethod), libsvc.ErrUnavailable))
+	}
+	a.Empty(changes)
+
+	// 失败率达到阈值后熔断，快速失败
+	a.True(errors.Is(invoke(echoMethod), libsvc.ErrUnavailable))
+	a.Equal([]string{"echo.echo:closed->open"}, changes)
+	calls = 0
+	a.Equal(ErrOpen, invoke(echoMethod))
+	a.Equal(0, calls)
+
+	// 其它方法不受影响
+	a.True(errors.Is(invoke(otherMethod), libsvc.ErrUnavailable))
+	a.Equal(1, calls)
+
+	// 半开状态下探测失败，重新熔断
+	now = now.Add(time.Second)
+	a.True(errors.Is(invoke(echoMethod), libsvc.ErrUnavailable))
+	a.Equal(ErrOpen, invoke(echoMethod))
+	a.Equal([]string{
+		"echo.echo:closed->open",
+		"echo.echo:open->half-open",
+		"echo.echo:half-open->open",
+	}, changes[:3])
+
+	// 半开状态下探测成功，恢复
+	fail = nil
+	now = now.Add(time.Second)
+	a.NoError(invoke(echoMethod))
+	a.NoError(invoke(echoMethod))
+	a.Equal("echo.echo:half-open->closed", changes[len(changes)-1])
+}
+
+func TestHalfOpenProbes(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	fail := true
+	svc := libsvc.NewLocalService(
+		"echo",
+		echoMethod, echoMethod.Handler(func(ctx context.Context, _, _ *struct{}) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if fail {
+				return context.DeadlineExceeded
+			}
+			entered <- struct{}{}
+			<-release
+			return nil
+		}),
+	)
+	now := time.Now()
+	dec := libsvc.DecorateService(svc, New(
+		OptThreshold(1, 1),
+		func(bs *breakers) {
+			bs.now = func() time.Time { return now }
+		},
+	))
+
+	_, err := echoMethod.Invoke(ctx, dec, &struct{}{})
+	a.Equal(context.DeadlineExceeded, err)
+	_, err = echoMethod.Invoke(ctx, dec, &struct{}{})
+	a.Equal(ErrOpen, err)
+
+	// 被取消的探测调用释放名额，不改变状态
+	fail = false
+	now = now.Add(DefaultOpenTimeout)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = echoMethod.Invoke(canceled, dec, &struct{}{})
+	a.Equal(context.Canceled, err)
+
+	// 半开状态下只放行一个探测调用
+	done := make(chan error)
+	go func() {
+		_, err := echoMethod.Invoke(ctx, dec, &struct{}{})
+		done <- err
+	}()
+	<-entered
+	_, err = echoMethod.Invoke(ctx, dec, &struct{}{})
+	a.Equal(ErrOpen, err)
+	close(release)
+	a.NoError(<-done)
+
+	go func() { <-entered }()
+	_, err = echoMethod.Invoke(ctx, dec, &struct{}{})
+	a.NoError(err)
+}
+
+func TestPanicProbe(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	var fail error = context.DeadlineExceeded
+	svc := libsvc.NewLocalService(
+		"echo",
+		echoMethod, echoMethod.Handler(func(context.Context, *struct{}, *struct{}) error {
+			if fail == nil {
+				panic("oops")
+			}
+			return fail
+		}),
+	)
+	now := time.Now()
+	dec := libsvc.DecorateService(svc, New(
+		OptThreshold(1, 1),
+		func(bs *breakers) {
+			bs.now = func() time.Time { return now }
+		},
+	))
+
+	_, err := echoMethod.Invoke(ctx, dec, &struct{}{})
+	a.Equal(context.DeadlineExceeded, err)
+
+	// 探测调用 panic 计为失败，重新熔断
+	fail = nil
+	now = now.Add(DefaultOpenTimeout)
+	a.Panics(func() {
+		echoMethod.Invoke(ctx, dec, &struct{}{})
+	})
+	_, err = echoMethod.Invoke(ctx, dec, &struct{}{})
+	a.Equal(ErrOpen, err)
+
+	// 探测名额已经归还，熔断结束后可以再次探测
+	fail = errFatal
+	now = now.Add(DefaultOpenTimeout)
+	_, err = echoMethod.Invoke(ctx, dec, &struct{}{})
+	a.Equal(errFatal, err)
+	_, err = echoMethod.Invoke(ctx, dec, &struct{}{})
+	a.Equal(errFatal, err)
+}
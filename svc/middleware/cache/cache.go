@@ -0,0 +1,287 @@
+// cachemw 提供一个客户端缓存的 libsvc.ServiceMiddleware：按服务名 + 方法名 + 序列化后的入参（以及选定的 passthru）
+// 缓存出参，带有过期时间及 LRU 容量上限，并将同时进行的相同调用合并为一次（singleflight）
+package cachemw
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	retrymw "github.com/huangjunwen/platform-kit/svc/middleware/retry"
+)
+
+var (
+	// DefaultTTL 为默认缓存的过期时间
+	DefaultTTL = time.Minute
+	// DefaultSize 为默认最多缓存的条目数
+	DefaultSize = 1000
+)
+
+// Option 是创建缓存中间件时的选项
+type Option func(*cache)
+
+type cache struct {
+	match       libsvc.MethodMatcher
+	ttl         time.Duration
+	size        int
+	negativeTTL time.Duration
+	keys        []string
+	now         func() time.Time
+
+	mu sync.Mutex
+	// LRU 链表，最近使用的在前面，元素为 *entry
+	lru     *list.List
+	entries map[string]*list.Element
+	// 进行中的调用
+	calls map[string]*call
+}
+
+// entry 为一条缓存
+type entry struct {
+	key    string
+	data   []byte // 序列化后的出参，err 不为空时为空
+	err    error
+	expiry time.Time
+}
+
+// call 为进行中的调用，结果在 done 关闭前设置
+type call struct {
+	done chan struct{}
+	data []byte
+	err  error
+	// h 正常返回（没有 panic）时为 true
+	returned bool
+}
+
+// OptMatch 设置需要缓存的方法，默认为只读（libsvc.MethodMeta.ReadOnly）的方法
+func OptMatch(match libsvc.MethodMatcher) Option {
+	return func(c *cache) {
+		c.match = match
+	}
+}
+
+// OptMethods 只缓存 methods 中的方法
+func OptMethods(methods ...libsvc.Method) Option {
+	return OptMatch(libsvc.MatchMethods(methods...))
+}
+
+// OptTTL 设置缓存的过期时间，默认为 DefaultTTL
+func OptTTL(ttl time.Duration) Option {
+	return func(c *cache) {
+		c.ttl = ttl
+	}
+}
+
+// OptSize 设置最多缓存的条目数，超过时淘汰最久没有使用的，默认为 DefaultSize
+func OptSize(size int) Option {
+	return func(c *cache) {
+		if size < 1 {
+			size = 1
+		}
+		c.size = size
+	}
+}
+
+// OptNegative 设置错误的缓存时间（negative caching），默认为 0 即不缓存错误；
+// 暂时性的错误（见 retrymw.IsTransient）以及取消总是不缓存
+func OptNegative(ttl time.Duration) Option {
+	return func(c *cache) {
+		c.negativeTTL = ttl
+	}
+}
+
+// OptPassthruKeys 将 passthru 中的 keys 加入缓存的 key，用于出参依赖于这些上下文信息（例如租户，语言）的情况
+func OptPassthruKeys(keys ...string) Option {
+	return func(c *cache) {
+		c.keys = append([]string(nil), keys...)
+		sort.Strings(c.keys)
+	}
+}
+
+// New 创建一个缓存中间件，一般通过 libsvc.DecorateClient 安装在客户端，流式方法以及 notification 不经过缓存；缓存的是序列化（json）后的出参，
+// 命中时反序列化到调用者的出参中，因此调用者修改出参不会影响缓存；入参无法序列化时不缓存
+func New(opts ...Option) libsvc.ServiceMiddleware {
+	c := &cache{
+		match: libsvc.MatchMeta(func(meta libsvc.MethodMeta) bool {
+			return meta.ReadOnly
+		}),
+		ttl:     DefaultTTL,
+		size:    DefaultSize,
+		now:     time.Now,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		calls:   make(map[string]*call),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return func(h libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(ctx context.Context, method libsvc.Method, input, output interface{}) error {
+			// notification 没有出参
+			if libsvc.IsNotification(ctx) || libsvc.IsStreamMethod(method) || !c.match(method) {
+				return h(ctx, method, input, output)
+			}
+			key, ok := c.key(ctx, method, input)
+			if !ok {
+				return h(ctx, method, input, output)
+			}
+
+			var (
+				data []byte
+				err  error
+			)
+			if e := c.get(key); e != nil {
+				data, err = e.data, e.err
+			} else {
+				data, err = c.do(ctx, key, method, input, h)
+			}
+			if err != nil {
+				return err
+			}
+			return decode(data, output)
+		}
+	}
+}
+
+// key 返回缓存的 key
+func (c *cache) key(ctx context.Context, method libsvc.Method, input interface{}) (string, bool) {
+	in, err := json.Marshal(input)
+	if err != nil {
+		return "", false
+	}
+	b := &strings.Builder{}
+	b.WriteString(libsvc.ServiceName(ctx))
+	b.WriteByte(0)
+	b.WriteString(method.Name())
+	b.WriteByte(0)
+	b.Write(in)
+	if len(c.keys) != 0 {
+		passthru := libsvc.Passthru(ctx)
+		for _, k := range c.keys {
+			b.WriteByte(0)
+			b.WriteString(k)
+			if v, ok := passthru[k]; ok {
+				b.WriteByte('=')
+				b.WriteString(v)
+			}
+		}
+	}
+	return b.String(), true
+}
+
+// get 查找未过期的缓存，没有时返回 nil
+func (c *cache) get(key string) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem := c.entries[key]
+	if elem == nil {
+		return nil
+	}
+	e := elem.Value.(*entry)
+	if !c.now().Before(e.expiry) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return e
+}
+
+// do 调用 h 并缓存结果，同时进行的相同调用只有一个会真正调用 h，其它的等待其结果
+func (c *cache) do(ctx context.Context, key string, method libsvc.Method, input interface{}, h libsvc.ServiceHandler) ([]byte, error) {
+	c.mu.Lock()
+	if cl := c.calls[key]; cl != nil {
+		c.mu.Unlock()
+		select {
+		case <-cl.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// 发起调用的一方 panic 或者被取消了，自己再调用一次
+		if !cl.returned || (isCanceled(cl.err) && ctx.Err() == nil) {
+			return invoke(ctx, method, input, h)
+		}
+		return cl.data, cl.err
+	}
+	cl := &call{
+		done: make(chan struct{}),
+	}
+	c.calls[key] = cl
+	c.mu.Unlock()
+
+	// h panic 时也需要唤醒等待的调用
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		if cl.returned {
+			c.put(key, cl.data, cl.err)
+		}
+		c.mu.Unlock()
+		close(cl.done)
+	}()
+
+	cl.data, cl.err = invoke(ctx, method, input, h)
+	cl.returned = true
+	return cl.data, cl.err
+}
+
+// put 添加缓存，调用时需持有锁
+func (c *cache) put(key string, data []byte, err error) {
+	ttl := c.ttl
+	if err != nil {
+		if isCanceled(err) || retrymw.IsTransient(err) {
+			return
+		}
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	e := &entry{
+		key:    key,
+		data:   data,
+		err:    err,
+		expiry: c.now().Add(ttl),
+	}
+	if elem := c.entries[key]; elem != nil {
+		elem.Value = e
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		elem := c.lru.Back()
+		c.lru.Remove(elem)
+		delete(c.entries, elem.Value.(*entry).key)
+	}
+}
+
+// invoke 使用新生成的出参调用 h，成功时返回序列化后的出参
+func invoke(ctx context.Context, method libsvc.Method, input interface{}, h libsvc.ServiceHandler) ([]byte, error) {
+	out := method.GenOutput()
+	if err := h(ctx, method, input, out); err != nil {
+		return nil, err
+	}
+	return json.Marshal(out)
+}
+
+// decode 将序列化后的出参解码到 output 中，output 原有的内容会被清空
+func decode(data []byte, output interface{}) error {
+	v := reflect.ValueOf(output).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	return json.Unmarshal(data, output)
+}
+
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
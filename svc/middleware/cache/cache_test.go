@@ -0,0 +1,241 @@
+package cachemw
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/stretchr/testify/assert"
+)
+
+type getInput struct {
+	ID int `json:"id"`
+}
+
+type getOutput struct {
+	ID    int      `json:"id"`
+	Calls int      `json:"calls"`
+	Tags  []string `json:"tags"`
+}
+
+var (
+	getMethod   = libsvc.WithMethodMeta(libsvc.NewTypedMethod[getInput, getOutput]("get"), libsvc.MethodMeta{ReadOnly: true})
+	setMethod   = libsvc.NewTypedMethod[getInput, getOutput]("set")
+	errNotFound = &libsvc.Error{Code: 404, Message: "not found"}
+)
+
+// newService 返回的服务对 ID 为负数的入参返回 errNotFound，对 ID 为 0 的入参返回暂时性的错误
+func newService() (libsvc.Service, *int) {
+	mu := &sync.Mutex{}
+	calls := 0
+	handler := func(_ context.Context, input *getInput, output *getOutput) error {
+		mu.Lock()
+		calls++
+		n := calls
+		mu.Unlock()
+		switch {
+		case input.ID < 0:
+			return errNotFound
+		case input.ID == 0:
+			return libsvc.Unavailable(errors.New("conn closed"))
+		}
+		output.ID = input.ID
+		output.Calls = n
+		output.Tags = []string{"a"}
+		return nil
+	}
+	return libsvc.NewLocalService(
+		"cache.svc",
+		getMethod, getMethod.Handler(handler),
+		setMethod, setMethod.Handler(handler),
+	), &calls
+}
+
+func newCache(opts ...Option) (libsvc.ServiceMiddleware, *time.Time) {
+	now := time.Now()
+	mw := New(append(opts, func(c *cache) {
+		c.now = func() time.Time { return now }
+	})...)
+	return mw, &now
+}
+
+func TestCache(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	mw, now := newCache(OptTTL(time.Second), OptSize(2))
+	svc, calls := newService()
+	dec := libsvc.DecorateService(svc, mw)
+
+	// 命中缓存，修改出参不影响缓存
+	out, err := getMethod.Invoke(ctx, dec, &getInput{ID: 1})
+	a.NoError(err)
+	a.Equal(&getOutput{ID: 1, Calls: 1, Tags: []string{"a"}}, out)
+	out.Tags[0] = "x"
+	out = &getOutput{Tags: []string{"y", "z"}}
+	a.NoError(dec.Invoke(ctx, getMethod, &getInput{ID: 1}, out))
+	a.Equal(&getOutput{ID: 1, Calls: 1, Tags: []string{"a"}}, out)
+	a.Equal(1, *calls)
+
+	// 不匹配的方法不缓存
+	setMethod.Invoke(ctx, dec, &getInput{ID: 1})
+	setMethod.Invoke(ctx, dec, &getInput{ID: 1})
+	a.Equal(3, *calls)
+
+	// 淘汰最久没有使用的
+	getMethod.Invoke(ctx, dec, &getInput{ID: 2})
+	getMethod.Invoke(ctx, dec, &getInput{ID: 1})
+	getMethod.Invoke(ctx, dec, &getInput{ID: 3})
+	a.Equal(5, *calls)
+	getMethod.Invoke(ctx, dec, &getInput{ID: 1})
+	a.Equal(5, *calls)
+	getMethod.Invoke(ctx, dec, &getInput{ID: 2})
+	a.Equal(6, *calls)
+
+	// 过期
+	*now = now.Add(time.Second)
+	out, err = getMethod.Invoke(ctx, dec, &getInput{ID: 1})
+	a.NoError(err)
+	a.Equal(7, out.Calls)
+
+	// 默认不缓存错误
+	_, err = getMethod.Invoke(ctx, dec, &getInput{ID: -1})
+	a.Equal(errNotFound, err)
+	_, err = getMethod.Invoke(ctx, dec, &getInput{ID: -1})
+	a.Equal(errNotFound, err)
+	a.Equal(9, *calls)
+}
+
+func TestCacheNegative(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	mw, now := newCache(OptNegative(time.Second), OptMethods(getMethod))
+	svc, calls := newService()
+	dec := libsvc.DecorateService(svc, mw)
+
+	for i := 0; i < 2; i++ {
+		_, err := getMethod.Invoke(ctx, dec, &getInput{ID: -1})
+		a.Equal(errNotFound, err)
+	}
+	a.Equal(1, *calls)
+	*now = now.Add(time.Second)
+	getMethod.Invoke(ctx, dec, &getInput{ID: -1})
+	a.Equal(2, *calls)
+
+	// 暂时性的错误不缓存
+	for i := 0; i < 2; i++ {
+		_, err := getMethod.Invoke(ctx, dec, &getInput{ID: 0})
+		a.True(errors.Is(err, libsvc.ErrUnavailable))
+	}
+	a.Equal(4, *calls)
+}
+
+func TestCachePassthruKeys(t *testing.T) {
+	a := assert.New(t)
+	mw, _ := newCache(OptPassthruKeys("tenant"))
+	svc, calls := newService()
+	dec := libsvc.DecorateService(svc, mw)
+
+	ctx1 := libsvc.WithPassthru(context.Background(), map[string]string{"tenant": "t1", "other": "1"})
+	ctx2 := libsvc.WithPassthru(context.Background(), map[string]string{"tenant": "t1", "other": "2"})
+	ctx3 := libsvc.WithPassthru(context.Background(), map[string]string{"tenant": "t2"})
+	getMethod.Invoke(ctx1, dec, &getInput{ID: 1})
+	getMethod.Invoke(ctx2, dec, &getInput{ID: 1})
+	a.Equal(1, *calls)
+	getMethod.Invoke(ctx3, dec, &getInput{ID: 1})
+	getMethod.Invoke(context.Background(), dec, &getInput{ID: 1})
+	a.Equal(3, *calls)
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	calls := 0
+	svc := libsvc.NewLocalService("slow.svc", getMethod, getMethod.Handler(func(_ context.Context, input *getInput, output *getOutput) error {
+		calls++
+		<-release
+		output.ID = input.ID
+		return nil
+	}))
+	dec := libsvc.DecorateService(svc, New())
+
+	const n = 10
+	wg := &sync.WaitGroup{}
+	outs := make([]*getOutput, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outs[i], _ = getMethod.Invoke(ctx, dec, &getInput{ID: 1})
+		}(i)
+	}
+
+	// 等待所有调用都在进行中
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	a.Equal(1, calls)
+	for _, out := range outs {
+		a.Equal(&getOutput{ID: 1}, out)
+	}
+	a.False(outs[0] == outs[1])
+}
+
+func TestCacheNotification(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	svc, calls := newService()
+	dec := libsvc.DecorateService(svc, New())
+
+	// notification 不经过缓存
+	a.NoError(getMethod.Notify(ctx, dec, &getInput{ID: 42}))
+	out, err := getMethod.Invoke(ctx, dec, &getInput{ID: 42})
+	a.NoError(err)
+	a.Equal(42, out.ID)
+	a.Equal(2, *calls)
+}
+
+func TestCachePanic(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	calls := 0
+	svc := libsvc.NewLocalService("panic.svc", getMethod, getMethod.Handler(func(_ context.Context, input *getInput, output *getOutput) error {
+		calls++
+		if calls == 1 {
+			close(entered)
+			<-release
+			panic("oops")
+		}
+		output.ID = input.ID
+		return nil
+	}))
+	dec := libsvc.DecorateService(svc, New())
+
+	leaderErr := make(chan error, 1)
+	go func() {
+		leaderErr <- libsvc.Recover(func() error {
+			_, err := getMethod.Invoke(ctx, dec, &getInput{ID: 1})
+			return err
+		})
+	}()
+	<-entered
+
+	// 等待中的调用在发起调用的一方 panic 后自己再调用一次
+	waiterOut := make(chan *getOutput, 1)
+	go func() {
+		out, _ := getMethod.Invoke(ctx, dec, &getInput{ID: 1})
+		waiterOut <- out
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	a.True(errors.Is(<-leaderErr, libsvc.ErrInternal))
+	a.Equal(&getOutput{ID: 1}, <-waiterOut)
+	a.Equal(2, calls)
+}
@@ -0,0 +1,255 @@
+// limitmw 提供一个服务端限制并发的 libsvc.ServiceMiddleware（bulkhead）：按服务以及按方法限制同时处理的调用数，
+// 超过限制的调用在一个有界的队列中等待，队列满或等待超时则以 libsvc.ErrOverloaded 拒绝（load shedding）；
+// 服务级别的限制还可以根据延迟自适应地调整（AIMD）
+package limitmw
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/rs/zerolog"
+)
+
+var (
+	// DefaultQueueTimeout 为默认在队列中等待的最长时间
+	DefaultQueueTimeout = 100 * time.Millisecond
+	// DefaultBackoffRatio 为默认自适应限制在过载时乘以的比例
+	DefaultBackoffRatio = 0.9
+)
+
+var (
+	// errPanic 表示处理器 panic 了，仅用于内部记录调用的结果
+	errPanic = errors.New("Handler panicked")
+)
+
+// Option 是创建限流中间件时的选项
+type Option func(*limiter)
+
+type limiter struct {
+	svcLimit     int
+	methodLimits map[string]int
+	queueSize    int
+	queueTimeout time.Duration
+	adaptive     *adaptive
+	logger       zerolog.Logger
+
+	mu sync.Mutex
+	// svc name 或 svc name + "/" + method name -> bulkhead
+	bulkheads map[string]*bulkhead
+}
+
+// adaptive 为 AIMD 自适应限制的参数：延迟不超过 latency 时限制加一，超过时（或超时，panic）限制乘以 backoffRatio
+type adaptive struct {
+	min          int
+	max          int
+	latency      time.Duration
+	backoffRatio float64
+}
+
+// bulkhead 限制同时处理的调用数
+type bulkhead struct {
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	// 等待中的调用：chan struct{}，获得许可时关闭
+	waiters  list.List
+	adaptive *adaptive
+}
+
+// OptServiceLimit 设置每个服务同时处理的调用数上限，默认（<= 0）不限制
+func OptServiceLimit(n int) Option {
+	return func(l *limiter) {
+		l.svcLimit = n
+	}
+}
+
+// OptMethodLimit 设置 methods 中每个方法同时处理的调用数上限，各个方法独立计算
+func OptMethodLimit(n int, methods ...libsvc.Method) Option {
+	return func(l *limiter) {
+		for _, method := range methods {
+			l.methodLimits[method.Name()] = n
+		}
+	}
+}
+
+// OptQueue 设置等待队列：超过限制的调用最多 size 个在队列中等待，最长等待 timeout；默认不等待
+func OptQueue(size int, timeout time.Duration) Option {
+	return func(l *limiter) {
+		l.queueSize = size
+		l.queueTimeout = timeout
+	}
+}
+
+// OptAdaptive 使服务级别的限制根据延迟在 [min, max] 间自适应地调整：延迟不超过 latency 的成功调用使限制加一，
+// 延迟超过 latency 或超时的调用使限制乘以 DefaultBackoffRatio；初始值为 OptServiceLimit 所设置的值（默认为 max）
+func OptAdaptive(min, max int, latency time.Duration) Option {
+	return func(l *limiter) {
+		if min < 1 {
+			min = 1
+		}
+		if max < min {
+			max = min
+		}
+		l.adaptive = &adaptive{
+			min:          min,
+			max:          max,
+			latency:      latency,
+			backoffRatio: DefaultBackoffRatio,
+		}
+	}
+}
+
+// OptLogger 设置 logger，拒绝调用时会记录日志
+func OptLogger(logger *zerolog.Logger) Option {
+	return func(l *limiter) {
+		l.logger = logger.With().Str("comp", "svc.limit").Logger()
+	}
+}
+
+// New 创建一个限流中间件，一般通过 libsvc.DecorateServer 安装；服务名由 libsvc.ServiceName 获得
+func New(opts ...Option) libsvc.ServiceMiddleware {
+	l := &limiter{
+		methodLimits: make(map[string]int),
+		queueTimeout: DefaultQueueTimeout,
+		logger:       zerolog.Nop(),
+		bulkheads:    make(map[string]*bulkhead),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if a := l.adaptive; a != nil {
+		if l.svcLimit <= 0 || l.svcLimit > a.max {
+			l.svcLimit = a.max
+		}
+		if l.svcLimit < a.min {
+			l.svcLimit = a.min
+		}
+	}
+
+	return func(h libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(ctx context.Context, method libsvc.Method, input, output interface{}) error {
+			svcName := libsvc.ServiceName(ctx)
+			bulkheads := make([]*bulkhead, 0, 2)
+			if l.svcLimit > 0 {
+				bulkheads = append(bulkheads, l.get(svcName, l.svcLimit, l.adaptive))
+			}
+			if n := l.methodLimits[method.Name()]; n > 0 {
+				bulkheads = append(bulkheads, l.get(svcName+"/"+method.Name(), n, nil))
+			}
+
+			for i, b := range bulkheads {
+				if err := b.acquire(ctx, l.queueSize, l.queueTimeout); err != nil {
+					for _, acquired := range bulkheads[:i] {
+						acquired.release(0, nil)
+					}
+					l.logger.Debug().
+						Str("svc", svcName).
+						Str("method", method.Name()).
+						Err(err).
+						Msg("")
+					return err
+				}
+			}
+
+			// 处理器 panic 时也要归还许可，并且计为失败
+			start := time.Now()
+			err := errPanic
+			defer func() {
+				latency := time.Since(start)
+				for _, b := range bulkheads {
+					b.release(latency, err)
+				}
+			}()
+			err = h(ctx, method, input, output)
+			return err
+		}
+	}
+}
+
+func (l *limiter) get(key string, limit int, a *adaptive) *bulkhead {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bulkheads[key]
+	if b == nil {
+		b = &bulkhead{
+			limit:    float64(limit),
+			adaptive: a,
+		}
+		l.bulkheads[key] = b
+	}
+	return b
+}
+
+// acquire 获取许可，没有许可时最多 queueSize 个调用等待，最长等待 timeout
+func (b *bulkhead) acquire(ctx context.Context, queueSize int, timeout time.Duration) error {
+	b.mu.Lock()
+	if b.inflight < int(b.limit) && b.waiters.Len() == 0 {
+		b.inflight++
+		b.mu.Unlock()
+		return nil
+	}
+	if b.waiters.Len() >= queueSize {
+		b.mu.Unlock()
+		return libsvc.Overloaded("Service overloaded: too many concurrent calls")
+	}
+	ch := make(chan struct{})
+	elem := b.waiters.PushBack(ch)
+	b.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	err := error(nil)
+	select {
+	case <-ch:
+		return nil
+	case <-timer.C:
+		err = libsvc.Overloaded("Service overloaded: queue timeout")
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	b.mu.Lock()
+	select {
+	case <-ch:
+		// 已经获得许可，归还
+		b.mu.Unlock()
+		b.release(0, nil)
+	default:
+		b.waiters.Remove(elem)
+		b.mu.Unlock()
+	}
+	return err
+}
+
+// release 归还许可；若 latency > 0 则以该次调用的结果调整自适应限制
+func (b *bulkhead) release(latency time.Duration, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if a := b.adaptive; a != nil && latency > 0 {
+		if latency > a.latency || errors.Is(err, context.DeadlineExceeded) || err == errPanic {
+			b.limit *= a.backoffRatio
+			if b.limit < float64(a.min) {
+				b.limit = float64(a.min)
+			}
+		} else if err == nil && b.inflight*2 >= int(b.limit) {
+			// 只有在限制被较充分使用时才增加，避免空闲时限制无限增长
+			b.limit++
+			if b.limit > float64(a.max) {
+				b.limit = float64(a.max)
+			}
+		}
+	}
+
+	b.inflight--
+	for b.inflight < int(b.limit) && b.waiters.Len() != 0 {
+		ch := b.waiters.Remove(b.waiters.Front()).(chan struct{})
+		b.inflight++
+		close(ch)
+	}
+}
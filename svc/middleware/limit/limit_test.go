@@ -0,0 +1,212 @@
+package limitmw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	slowMethod  = libsvc.NewTypedMethod[struct{}, struct{}]("slow")
+	fastMethod  = libsvc.NewTypedMethod[struct{}, struct{}]("fast")
+	watchMethod = libsvc.NewTypedStreamMethod[struct{}, struct{}]("watch")
+)
+
+// newBlockingService 返回的服务在 slow 方法中阻塞直到 release 关闭，进入时向 entered 发送
+func newBlockingService() (svc libsvc.Service, entered chan struct{}, release chan struct{}) {
+	entered = make(chan struct{}, 16)
+	release = make(chan struct{})
+	svc = libsvc.NewLocalService(
+		"blocking",
+		slowMethod, slowMethod.Handler(func(context.Context, *struct{}, *struct{}) error {
+			entered <- struct{}{}
+			<-release
+			return nil
+		}),
+		fastMethod, fastMethod.Handler(func(context.Context, *struct{}, *struct{}) error {
+			return nil
+		}),
+	)
+	return
+}
+
+func TestMethodLimit(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	svc, entered, release := newBlockingService()
+	dec := libsvc.DecorateService(svc, New(OptMethodLimit(1, slowMethod)))
+
+	done := make(chan error)
+	go func() {
+		_, err := slowMethod.Invoke(ctx, dec, &struct{}{})
+		done <- err
+	}()
+	<-entered
+
+	// 超过限制且没有队列，马上拒绝
+	_, err := slowMethod.Invoke(ctx, dec, &struct{}{})
+	a.True(errors.Is(err, libsvc.ErrOverloaded))
+	a.True(libsvc.IsTemporary(err))
+
+	// 其它方法不受影响
+	_, err = fastMethod.Invoke(ctx, dec, &struct{}{})
+	a.NoError(err)
+
+	close(release)
+	a.NoError(<-done)
+	_, err = slowMethod.Invoke(ctx, dec, &struct{}{})
+	a.NoError(err)
+}
+
+func TestQueue(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	svc, entered, release := newBlockingService()
+	dec := libsvc.DecorateService(svc, New(
+		OptServiceLimit(1),
+		OptQueue(1, 20*time.Millisecond),
+	))
+
+	done := make(chan error, 2)
+	invoke := func() {
+		_, err := slowMethod.Invoke(ctx, dec, &struct{}{})
+		done <- err
+	}
+	go invoke()
+	<-entered
+
+	// 在队列中等待超时
+	start := time.Now()
+	_, err := fastMethod.Invoke(ctx, dec, &struct{}{})
+	a.True(errors.Is(err, libsvc.ErrOverloaded))
+	a.True(time.Since(start) >= 20*time.Millisecond)
+
+	// ctx 结束时不再等待
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = fastMethod.Invoke(cctx, dec, &struct{}{})
+	a.Equal(context.Canceled, err)
+
+	// 队列满时马上拒绝；队列中的调用在许可归还后继续
+	go invoke()
+	time.Sleep(5 * time.Millisecond)
+	_, err = fastMethod.Invoke(ctx, dec, &struct{}{})
+	a.True(errors.Is(err, libsvc.ErrOverloaded))
+	close(release)
+	a.NoError(<-done)
+	a.NoError(<-done)
+}
+
+func TestAdaptive(t *testing.T) {
+	a := assert.New(t)
+	b := &bulkhead{
+		limit: 4,
+		adaptive: &adaptive{
+			min:          2,
+			max:          5,
+			latency:      10 * time.Millisecond,
+			backoffRatio: 0.5,
+		},
+	}
+	ctx := context.Background()
+	acquire := func(n int) {
+		for i := 0; i < n; i++ {
+			a.NoError(b.acquire(ctx, 0, 0))
+		}
+	}
+
+	// 限制被较充分使用时，延迟低的成功调用使限制增加，但不超过 max
+	acquire(4)
+	b.release(time.Millisecond, nil)
+	b.release(time.Millisecond, nil)
+	a.Equal(5.0, b.limit)
+	b.release(time.Millisecond, nil)
+	b.release(time.Millisecond, nil)
+	a.Equal(5.0, b.limit)
+
+	// 空闲时不增加
+	acquire(1)
+	b.release(time.Millisecond, nil)
+	a.Equal(5.0, b.limit)
+
+	// 延迟高或超时使限制减少，但不低于 min
+	acquire(2)
+	b.release(20*time.Millisecond, nil)
+	a.Equal(2.5, b.limit)
+	b.release(time.Millisecond, fmt.Errorf("call: %w", context.DeadlineExceeded))
+	a.Equal(2.0, b.limit)
+	acquire(1)
+	b.limit = 4
+	b.release(time.Millisecond, errPanic)
+	a.Equal(2.0, b.limit, "Expect backoff since handler panicked")
+	acquire(2)
+	a.True(errors.Is(b.acquire(ctx, 0, 0), libsvc.ErrOverloaded))
+}
+
+func TestStreamLimit(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	svc := libsvc.NewLocalService(
+		"watching",
+		watchMethod, watchMethod.Handler(func(ctx context.Context, _ *struct{}, send func(*struct{}) error) error {
+			if err := send(&struct{}{}); err != nil {
+				return err
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	)
+	dec := libsvc.DecorateService(svc, New(OptMethodLimit(1, watchMethod)))
+
+	// 流结束前一直占用许可
+	stream, err := watchMethod.Invoke(ctx, dec, &struct{}{})
+	a.NoError(err)
+	_, err = stream.Recv()
+	a.NoError(err)
+	_, err = watchMethod.Invoke(ctx, dec, &struct{}{})
+	a.True(errors.Is(err, libsvc.ErrOverloaded))
+
+	// 流关闭后归还许可
+	stream.Close()
+	a.Eventually(func() bool {
+		stream, err := watchMethod.Invoke(ctx, dec, &struct{}{})
+		if err != nil {
+			return false
+		}
+		stream.Close()
+		return true
+	}, time.Second, time.Millisecond)
+}
+
+func TestPanic(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	svc := libsvc.NewLocalService(
+		"panicking",
+		slowMethod, slowMethod.Handler(func(context.Context, *struct{}, *struct{}) error {
+			panic("oops")
+		}),
+		fastMethod, fastMethod.Handler(func(context.Context, *struct{}, *struct{}) error {
+			return nil
+		}),
+	)
+	dec := libsvc.DecorateService(svc, New(OptServiceLimit(1)))
+
+	// panic 穿过中间件，但许可已经归还
+	for i := 0; i < 3; i++ {
+		a.Panics(func() {
+			slowMethod.Invoke(ctx, dec, &struct{}{})
+		})
+	}
+	_, err := fastMethod.Invoke(ctx, dec, &struct{}{})
+	a.NoError(err)
+}
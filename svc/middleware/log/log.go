@@ -0,0 +1,171 @@
+// logmw 提供一个使用 zerolog 记录服务调用的 libsvc.ServiceMiddleware（类似 zlogutil 之于 HTTP），
+// logger 从 zerolog.Ctx(ctx) 中获得
+package logmw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	retrymw "github.com/huangjunwen/platform-kit/svc/middleware/retry"
+	"github.com/rs/zerolog"
+)
+
+var (
+	// DefaultRedactFields 为默认需要隐去的出入参字段以及元数据（不区分大小写）
+	DefaultRedactFields = []string{"password", "secret", "token", "authorization"}
+)
+
+const (
+	redacted = "***"
+)
+
+// Option 是创建日志中间件时的选项
+type Option func(*logger)
+
+type logger struct {
+	comp string
+	// 出入参序列化后的大小上限，< 0 时不记录出入参
+	maxBodySize int
+	redact      map[string]bool
+	// 返回调用的元数据
+	metadata func(ctx context.Context) map[string]string
+}
+
+// OptBody 使日志中包括 json 序列化后的出入参（出错时不包括出参），超过 maxSize 字节的会被截断
+func OptBody(maxSize int) Option {
+	return func(l *logger) {
+		l.maxBodySize = maxSize
+	}
+}
+
+// OptRedact 添加需要隐去的出入参字段（不区分大小写，任意层级）以及元数据，默认为 DefaultRedactFields
+func OptRedact(fields ...string) Option {
+	return func(l *logger) {
+		for _, field := range fields {
+			l.redact[strings.ToLower(field)] = true
+		}
+	}
+}
+
+// NewClient 创建一个记录客户端调用的日志中间件（comp 为 svc.client），一般通过 libsvc.DecorateClient 安装；
+// 日志中的 passthru 为发出的元数据
+func NewClient(opts ...Option) libsvc.ServiceMiddleware {
+	return newLogger("svc.client", libsvc.Passthru, opts)
+}
+
+// NewServer 创建一个记录服务端调用的日志中间件（comp 为 svc.server），一般通过 libsvc.DecorateServer 安装；
+// 日志中的 passthru 为收到的元数据
+func NewServer(opts ...Option) libsvc.ServiceMiddleware {
+	return newLogger("svc.server", libsvc.IncomingMetadata, opts)
+}
+
+func newLogger(comp string, metadata func(context.Context) map[string]string, opts []Option) libsvc.ServiceMiddleware {
+	l := &logger{
+		comp:        comp,
+		maxBodySize: -1,
+		redact:      make(map[string]bool),
+		metadata:    metadata,
+	}
+	OptRedact(DefaultRedactFields...)(l)
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return func(h libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(ctx context.Context, method libsvc.Method, input, output interface{}) error {
+			start := time.Now()
+			err := h(ctx, method, input, output)
+			l.log(ctx, method, input, output, err, time.Since(start))
+			return err
+		}
+	}
+}
+
+func (l *logger) log(ctx context.Context, method libsvc.Method, input, output interface{}, err error, dur time.Duration) {
+	var (
+		ev *zerolog.Event
+	)
+	logger := zerolog.Ctx(ctx)
+	if err != nil {
+		ev = logger.Error().Err(err).Int("code", libsvc.AsError(err).Code)
+	} else {
+		ev = logger.Info()
+	}
+	if !ev.Enabled() {
+		return
+	}
+
+	ev = ev.Str("comp", l.comp).
+		Str("svc", libsvc.ServiceName(ctx)).
+		Str("method", method.Name()).
+		Str("dur", dur.String())
+	if attempt := retrymw.Attempt(ctx); attempt > 1 {
+		ev = ev.Int("attempt", attempt)
+	}
+	if libsvc.IsNotification(ctx) {
+		ev = ev.Bool("notification", true)
+	}
+	if md := l.metadata(ctx); len(md) != 0 {
+		dict := zerolog.Dict()
+		for k, v := range md {
+			if l.redact[strings.ToLower(k)] {
+				v = redacted
+			}
+			dict = dict.Str(k, v)
+		}
+		ev = ev.Dict("passthru", dict)
+	}
+	if l.maxBodySize >= 0 {
+		ev = l.body(ev, "input", input)
+		// 流式方法的出参是 *libsvc.StreamOutput，没有内容
+		if err == nil && !libsvc.IsStreamMethod(method) {
+			ev = l.body(ev, "output", output)
+		}
+	}
+	ev.Msg("")
+}
+
+// body 将出入参 json 序列化（隐去敏感字段，截断过长的）后添加到日志中
+func (l *logger) body(ev *zerolog.Event, key string, v interface{}) *zerolog.Event {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ev.Str(key, "!"+err.Error())
+	}
+	if len(l.redact) != 0 {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		decoded := interface{}(nil)
+		if err := dec.Decode(&decoded); err == nil {
+			if data2, err := json.Marshal(l.redactValue(decoded)); err == nil {
+				data = data2
+			}
+		}
+	}
+	if len(data) > l.maxBodySize {
+		// 截断后不再是合法的 json，只能作为字符串
+		return ev.Str(key, string(data[:l.maxBodySize])+"...")
+	}
+	return ev.RawJSON(key, data)
+}
+
+func (l *logger) redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			if l.redact[strings.ToLower(k)] {
+				val[k] = redacted
+			} else {
+				val[k] = l.redactValue(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = l.redactValue(item)
+		}
+	}
+	return v
+}
@@ -0,0 +1,109 @@
+package logmw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type loginInput struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Extra    struct {
+		Token string `json:"token"`
+		ID    int64  `json:"id"`
+	} `json:"extra"`
+}
+
+type loginOutput struct {
+	Greeting string `json:"greeting"`
+}
+
+var (
+	loginMethod = libsvc.NewTypedMethod[loginInput, loginOutput]("login")
+	errDenied   = errors.New("denied")
+)
+
+func TestLog(t *testing.T) {
+	a := assert.New(t)
+
+	svc := libsvc.NewLocalService("auth", loginMethod, loginMethod.Handler(func(ctx context.Context, input *loginInput, output *loginOutput) error {
+		if input.User == "" {
+			return errDenied
+		}
+		output.Greeting = "hello " + input.User + strings.Repeat("!", 100)
+		return nil
+	}))
+
+	buf := &bytes.Buffer{}
+	ctx := zerolog.New(buf).WithContext(context.Background())
+	ctx = libsvc.WithPassthru(ctx, map[string]string{"tenant": "t1"})
+
+	// 客户端：默认不记录出入参
+	dec := libsvc.DecorateService(svc, NewClient())
+	_, err := loginMethod.Invoke(ctx, dec, &loginInput{User: "jack"})
+	a.NoError(err)
+	entry := map[string]interface{}{}
+	a.NoError(json.Unmarshal(buf.Bytes(), &entry))
+	a.Equal("info", entry["level"])
+	a.Equal("svc.client", entry["comp"])
+	a.Equal("auth", entry["svc"])
+	a.Equal("login", entry["method"])
+	a.Equal(map[string]interface{}{"tenant": "t1"}, entry["passthru"])
+	a.NotContains(entry, "input")
+
+	// 隐去敏感字段，截断过长的出参
+	buf.Reset()
+	dec = libsvc.DecorateService(svc, NewClient(OptBody(100), OptRedact("user")))
+	input := &loginInput{User: "jack", Password: "123456"}
+	input.Extra.Token = "abc"
+	input.Extra.ID = 1<<62 + 1
+	_, err = loginMethod.Invoke(ctx, dec, input)
+	a.NoError(err)
+	entry = map[string]interface{}{}
+	a.NoError(json.Unmarshal(buf.Bytes(), &entry))
+	a.Equal(map[string]interface{}{
+		"user":     "***",
+		"password": "***",
+		"extra": map[string]interface{}{
+			"token": "***",
+			"id":    float64(1<<62 + 1),
+		},
+	}, entry["input"])
+	a.Contains(buf.String(), `"id":4611686018427387905`)
+	a.Equal(`{"greeting":"hello jack`+strings.Repeat("!", 77)+"...", entry["output"])
+	a.Equal("jack", input.User)
+
+	// 出错时记录错误代码，不记录出参
+	buf.Reset()
+	_, err = loginMethod.Invoke(ctx, dec, &loginInput{})
+	a.Equal(errDenied, err)
+	entry = map[string]interface{}{}
+	a.NoError(json.Unmarshal(buf.Bytes(), &entry))
+	a.Equal("error", entry["level"])
+	a.Equal("denied", entry["error"])
+	a.Equal(float64(libsvc.CodeUnknown), entry["code"])
+	a.NotContains(entry, "output")
+
+	// 服务端记录收到的元数据
+	buf.Reset()
+	sctx := libsvc.WithIncomingMetadata(zerolog.New(buf).WithContext(context.Background()), map[string]string{"tenant": "t2"})
+	_, err = loginMethod.Invoke(sctx, libsvc.DecorateService(svc, NewServer()), &loginInput{User: "jack"})
+	a.NoError(err)
+	a.Contains(buf.String(), `"comp":"svc.server"`)
+	a.Contains(buf.String(), `"passthru":{"tenant":"t2"}`)
+
+	// 隐去敏感的元数据
+	buf.Reset()
+	sctx = libsvc.WithIncomingMetadata(zerolog.New(buf).WithContext(context.Background()), map[string]string{"Authorization": "jwt"})
+	_, err = loginMethod.Invoke(sctx, libsvc.DecorateService(svc, NewServer()), &loginInput{User: "jack"})
+	a.NoError(err)
+	a.Contains(buf.String(), `"passthru":{"Authorization":"***"}`)
+}
@@ -0,0 +1,84 @@
+// metricsmw 提供一个记录服务调用指标的 libsvc.ServiceMiddleware：按服务、方法以及调用方（client/server）记录
+// 调用次数、按错误代码的错误次数、处理中的调用数以及延迟分布，指标注册到 metricsutil.Registry 中
+package metricsmw
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	metricsutil "github.com/huangjunwen/platform-kit/util/metrics"
+)
+
+const (
+	sideClient = "client"
+	sideServer = "server"
+)
+
+// Option 是创建指标中间件时的选项
+type Option func(*collector)
+
+type collector struct {
+	registry *metricsutil.Registry
+	buckets  []float64
+}
+
+// OptRegistry 设置指标注册到的注册表，默认为 metricsutil.DefaultRegistry
+func OptRegistry(registry *metricsutil.Registry) Option {
+	return func(c *collector) {
+		c.registry = registry
+	}
+}
+
+// OptBuckets 设置延迟分布（秒）的桶，默认为 metricsutil.DefaultBuckets；指标已在注册表中注册时不起作用
+func OptBuckets(buckets []float64) Option {
+	return func(c *collector) {
+		c.buckets = buckets
+	}
+}
+
+// NewClient 创建一个记录客户端调用指标的中间件，一般通过 libsvc.DecorateClient 安装
+func NewClient(opts ...Option) libsvc.ServiceMiddleware {
+	return newCollector(sideClient, opts)
+}
+
+// NewServer 创建一个记录服务端调用指标的中间件，一般通过 libsvc.DecorateServer 安装
+func NewServer(opts ...Option) libsvc.ServiceMiddleware {
+	return newCollector(sideServer, opts)
+}
+
+func newCollector(side string, opts []Option) libsvc.ServiceMiddleware {
+	c := &collector{
+		registry: metricsutil.DefaultRegistry,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	requests := c.registry.Counter("svc_requests_total", "Total number of service calls.", "side", "svc", "method")
+	errs := c.registry.Counter("svc_errors_total", "Total number of failed service calls by error code.", "side", "svc", "method", "code")
+	inflight := c.registry.Gauge("svc_inflight_requests", "Number of service calls in progress.", "side", "svc", "method")
+	duration := c.registry.Histogram("svc_request_duration_seconds", "Latency of service calls.", c.buckets, "side", "svc", "method")
+
+	return func(h libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(ctx context.Context, method libsvc.Method, input, output interface{}) error {
+			svcName := libsvc.ServiceName(ctx)
+			methodName := method.Name()
+			g := inflight.With(side, svcName, methodName)
+
+			g.Inc()
+			// 处理器 panic 时也要减回来
+			defer g.Dec()
+			start := time.Now()
+			err := h(ctx, method, input, output)
+			duration.With(side, svcName, methodName).Observe(time.Since(start).Seconds())
+
+			requests.With(side, svcName, methodName).Inc()
+			if err != nil {
+				errs.With(side, svcName, methodName, strconv.Itoa(libsvc.AsError(err).Code)).Inc()
+			}
+			return err
+		}
+	}
+}
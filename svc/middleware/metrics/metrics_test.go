@@ -0,0 +1,73 @@
+package metricsmw
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	metricsutil "github.com/huangjunwen/platform-kit/util/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	echoMethod = libsvc.NewTypedMethod[struct{}, struct{}]("echo")
+)
+
+func TestMetrics(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	registry := metricsutil.NewRegistry()
+
+	fail := false
+	svc := libsvc.NewLocalService("echo", echoMethod, echoMethod.Handler(func(context.Context, *struct{}, *struct{}) error {
+		if fail {
+			return libsvc.ErrInvalidParams
+		}
+		return nil
+	}))
+	client := libsvc.DecorateService(svc, NewClient(OptRegistry(registry)))
+	server := libsvc.DecorateService(svc, NewServer(OptRegistry(registry), OptBuckets([]float64{1})))
+
+	_, err := echoMethod.Invoke(ctx, client, &struct{}{})
+	a.NoError(err)
+	fail = true
+	_, err = echoMethod.Invoke(ctx, client, &struct{}{})
+	a.Error(err)
+	_, err = echoMethod.Invoke(ctx, server, &struct{}{})
+	a.Error(err)
+
+	buf := &bytes.Buffer{}
+	a.NoError(registry.WriteText(buf))
+	text := buf.String()
+	a.Contains(text, `svc_requests_total{side="client",svc="echo",method="echo"} 2`)
+	a.Contains(text, `svc_requests_total{side="server",svc="echo",method="echo"} 1`)
+	a.Contains(text, `svc_errors_total{side="client",svc="echo",method="echo",code="-32602"} 1`)
+	a.Contains(text, `svc_inflight_requests{side="client",svc="echo",method="echo"} 0`)
+	a.Contains(text, `svc_request_duration_seconds_count{side="client",svc="echo",method="echo"} 2`)
+
+	// 指标已注册时 OptBuckets 不起作用
+	a.Contains(text, `svc_request_duration_seconds_bucket{side="server",svc="echo",method="echo",le="10"} 1`)
+}
+
+func TestMetricsPanic(t *testing.T) {
+	a := assert.New(t)
+	registry := metricsutil.NewRegistry()
+
+	svc := libsvc.NewLocalService("echo", echoMethod, echoMethod.Handler(func(context.Context, *struct{}, *struct{}) error {
+		return nil
+	}))
+	dec := libsvc.DecorateService(svc, NewServer(OptRegistry(registry)), func(libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(context.Context, libsvc.Method, interface{}, interface{}) error {
+			panic("oops")
+		}
+	})
+	a.Panics(func() {
+		echoMethod.Invoke(context.Background(), dec, &struct{}{})
+	})
+
+	// panic 时处理中的调用数也会减回来
+	buf := &bytes.Buffer{}
+	a.NoError(registry.WriteText(buf))
+	a.Contains(buf.String(), `svc_inflight_requests{side="server",svc="echo",method="echo"} 0`)
+}
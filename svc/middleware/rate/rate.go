@@ -0,0 +1,259 @@
+// ratemw 提供一个客户端限速的 libsvc.ServiceMiddleware：使用令牌桶，可以按服务、按方法以及按 passthru 中的某个 key
+// （例如租户 ID）限速；超过速率时等待（受 ctx 限制）或马上以 ErrLimited 拒绝
+package ratemw
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/rs/zerolog"
+)
+
+var (
+	// ErrLimited 在超过速率而拒绝调用（或 ctx 的期限不足以等待）时返回
+	ErrLimited = errors.New("Rate limit exceeded")
+)
+
+// forever 表示令牌永远不可用（rate <= 0）
+const forever = time.Duration(1<<63 - 1)
+
+// sweepInterval 为清理空闲令牌桶的最小间隔
+const sweepInterval = time.Minute
+
+// Option 是创建限速中间件时的选项
+type Option func(*limiter)
+
+type limiter struct {
+	rules  []*rule
+	reject bool
+	logger zerolog.Logger
+	now    func() time.Time
+}
+
+// rule 为一条限速规则，调用需要满足所有适用的规则
+type rule struct {
+	rate  float64
+	burst int
+	// key 返回调用所使用的令牌桶，返回 false 表示该规则不适用
+	key func(ctx context.Context, svcName string, method libsvc.Method) (string, bool)
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// 上次清理的时间
+	swept time.Time
+}
+
+// bucket 为令牌桶
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// OptServiceRate 限制调用每个服务的速率为每秒 rate 次，最多允许 burst 次突发；
+// 若指定了 svcNames 则只作用于这些服务，否则作用于所有服务（每个服务单独计算）
+func OptServiceRate(rate float64, burst int, svcNames ...string) Option {
+	set := stringSet(svcNames)
+	return OptKeyRate(rate, burst, func(ctx context.Context, svcName string, method libsvc.Method) (string, bool) {
+		return svcName, set == nil || set[svcName]
+	})
+}
+
+// OptMethodRate 限制调用 methods 中每个方法的速率为每秒 rate 次，最多允许 burst 次突发，每个服务的每个方法单独计算
+func OptMethodRate(rate float64, burst int, methods ...libsvc.Method) Option {
+	set := make(map[libsvc.Method]bool, len(methods))
+	for _, method := range methods {
+		set[method] = true
+	}
+	return OptKeyRate(rate, burst, func(ctx context.Context, svcName string, method libsvc.Method) (string, bool) {
+		return svcName + "/" + method.Name(), set[method]
+	})
+}
+
+// OptPassthruRate 按 passthru 中 name 的值限速：每个服务的每个值单独计算，没有该值的调用不受此限制
+func OptPassthruRate(rate float64, burst int, name string) Option {
+	return OptKeyRate(rate, burst, func(ctx context.Context, svcName string, method libsvc.Method) (string, bool) {
+		v := libsvc.Passthru(ctx)[name]
+		return svcName + "/" + v, v != ""
+	})
+}
+
+// OptKeyRate 添加一条自定义的限速规则：key 返回调用所使用的令牌桶，返回 false 表示该规则不适用
+func OptKeyRate(rate float64, burst int, key func(ctx context.Context, svcName string, method libsvc.Method) (string, bool)) Option {
+	if burst < 1 {
+		burst = 1
+	}
+	return func(l *limiter) {
+		l.rules = append(l.rules, &rule{
+			rate:    rate,
+			burst:   burst,
+			key:     key,
+			buckets: make(map[string]*bucket),
+		})
+	}
+}
+
+// OptReject 使超过速率的调用马上以 ErrLimited 拒绝；默认为等待
+func OptReject() Option {
+	return func(l *limiter) {
+		l.reject = true
+	}
+}
+
+// OptLogger 设置 logger，拒绝调用时会记录日志
+func OptLogger(logger *zerolog.Logger) Option {
+	return func(l *limiter) {
+		l.logger = logger.With().Str("comp", "svc.rate").Logger()
+	}
+}
+
+// New 创建一个限速中间件，一般通过 libsvc.DecorateClient 安装；服务名由 libsvc.ServiceName 获得
+func New(opts ...Option) libsvc.ServiceMiddleware {
+	l := &limiter{
+		logger: zerolog.Nop(),
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return func(h libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(ctx context.Context, method libsvc.Method, input, output interface{}) error {
+			if err := l.wait(ctx, libsvc.ServiceName(ctx), method); err != nil {
+				return err
+			}
+			return h(ctx, method, input, output)
+		}
+	}
+}
+
+// wait 从所有适用的令牌桶中预留令牌，并等待到令牌可用
+func (l *limiter) wait(ctx context.Context, svcName string, method libsvc.Method) error {
+	now := l.now()
+	type reservation struct {
+		rule *rule
+		key  string
+	}
+	reserved := make([]reservation, 0, len(l.rules))
+	delay := time.Duration(0)
+	for _, r := range l.rules {
+		key, ok := r.key(ctx, svcName, method)
+		if !ok {
+			continue
+		}
+		if d := r.reserve(key, now); d > delay {
+			delay = d
+		}
+		reserved = append(reserved, reservation{rule: r, key: key})
+	}
+	if delay <= 0 {
+		return nil
+	}
+
+	cancel := func(err error) error {
+		for _, res := range reserved {
+			res.rule.cancel(res.key)
+		}
+		l.logger.Debug().
+			Str("svc", svcName).
+			Str("method", method.Name()).
+			Dur("delay", delay).
+			Err(err).
+			Msg("")
+		return err
+	}
+	if l.reject || delay == forever {
+		return cancel(ErrLimited)
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		return cancel(ErrLimited)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return cancel(ctx.Err())
+	}
+}
+
+// reserve 从令牌桶中取出一个令牌（可以为负，即预支），返回需要等待的时间
+func (r *rule) reserve(key string, now time.Time) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.swept) >= sweepInterval {
+		r.sweep(now)
+	}
+	b := r.buckets[key]
+	if b == nil {
+		b = &bucket{
+			tokens: float64(r.burst),
+			last:   now,
+		}
+		r.buckets[key] = b
+	}
+	r.refill(b, now)
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	if r.rate <= 0 {
+		return forever
+	}
+	return time.Duration(-b.tokens / r.rate * float64(time.Second))
+}
+
+// refill 按流逝的时间补充令牌
+func (r *rule) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * r.rate
+		if b.tokens > float64(r.burst) {
+			b.tokens = float64(r.burst)
+		}
+		b.last = now
+	}
+}
+
+// sweep 删除已经满了的令牌桶：跟新建的没有区别，以免 key 很多（例如按租户限速）时令牌桶无限增长
+func (r *rule) sweep(now time.Time) {
+	for key, b := range r.buckets {
+		r.refill(b, now)
+		if b.tokens >= float64(r.burst) {
+			delete(r.buckets, key)
+		}
+	}
+	r.swept = now
+}
+
+// cancel 归还预留的令牌
+func (r *rule) cancel(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := r.buckets[key]
+	if b == nil {
+		// 已经满了而被清理
+		return
+	}
+	b.tokens++
+	if b.tokens > float64(r.burst) {
+		b.tokens = float64(r.burst)
+	}
+}
+
+func stringSet(strs []string) map[string]bool {
+	if len(strs) == 0 {
+		return nil
+	}
+	ret := make(map[string]bool, len(strs))
+	for _, s := range strs {
+		ret[s] = true
+	}
+	return ret
+}
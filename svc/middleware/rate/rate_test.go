@@ -0,0 +1,131 @@
+package ratemw
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	quotaMethod = libsvc.NewTypedMethod[struct{}, struct{}]("quota")
+	freeMethod  = libsvc.NewTypedMethod[struct{}, struct{}]("free")
+)
+
+func newService(name string) libsvc.Service {
+	handler := func(context.Context, *struct{}, *struct{}) error {
+		return nil
+	}
+	return libsvc.NewLocalService(
+		name,
+		quotaMethod, quotaMethod.Handler(handler),
+		freeMethod, freeMethod.Handler(handler),
+	)
+}
+
+func TestReject(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	mw := New(
+		OptServiceRate(1, 2, "svc.a"),
+		OptMethodRate(1, 1, quotaMethod),
+		OptPassthruRate(1, 1, "tenant"),
+		OptReject(),
+		func(l *limiter) {
+			l.now = func() time.Time { return now }
+		},
+	)
+	svcA := libsvc.DecorateService(newService("svc.a"), mw)
+	svcB := libsvc.DecorateService(newService("svc.b"), mw)
+	invoke := func(ctx context.Context, svc libsvc.Service, m *libsvc.TypedMethod[struct{}, struct{}]) error {
+		_, err := m.Invoke(ctx, svc, &struct{}{})
+		return err
+	}
+
+	// 按方法限速
+	a.NoError(invoke(ctx, svcA, quotaMethod))
+	a.Equal(ErrLimited, invoke(ctx, svcA, quotaMethod))
+	a.NoError(invoke(ctx, svcB, quotaMethod))
+
+	// 按服务限速，被拒绝的调用不消耗令牌
+	a.NoError(invoke(ctx, svcA, freeMethod))
+	a.Equal(ErrLimited, invoke(ctx, svcA, freeMethod))
+	for i := 0; i < 3; i++ {
+		a.NoError(invoke(ctx, svcB, freeMethod))
+	}
+
+	// 按 passthru 中的值限速
+	now = now.Add(time.Second)
+	t1 := libsvc.WithPassthru(ctx, map[string]string{"tenant": "t1"})
+	t2 := libsvc.WithPassthru(ctx, map[string]string{"tenant": "t2"})
+	a.NoError(invoke(t1, svcB, freeMethod))
+	a.Equal(ErrLimited, invoke(t1, svcB, freeMethod))
+	a.NoError(invoke(t2, svcB, freeMethod))
+
+	// 令牌随时间恢复
+	now = now.Add(time.Second)
+	a.NoError(invoke(ctx, svcA, quotaMethod))
+	a.NoError(invoke(t1, svcB, freeMethod))
+}
+
+func TestWait(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	svc := libsvc.DecorateService(newService("svc"), New(OptServiceRate(50, 1)))
+	_, err := quotaMethod.Invoke(ctx, svc, &struct{}{})
+	a.NoError(err)
+
+	// 等待令牌
+	start := time.Now()
+	_, err = quotaMethod.Invoke(ctx, svc, &struct{}{})
+	a.NoError(err)
+	a.True(time.Since(start) >= 15*time.Millisecond)
+
+	// ctx 的期限不足以等待时马上拒绝
+	dctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	_, err = quotaMethod.Invoke(dctx, svc, &struct{}{})
+	a.Equal(ErrLimited, err)
+
+	// 不限速的服务
+	svc = libsvc.DecorateService(newService("svc"), New(OptServiceRate(0, 1, "other")))
+	for i := 0; i < 3; i++ {
+		_, err = quotaMethod.Invoke(ctx, svc, &struct{}{})
+		a.NoError(err)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	a := assert.New(t)
+
+	now := time.Now()
+	r := &rule{
+		rate:    1,
+		burst:   2,
+		buckets: make(map[string]*bucket),
+		swept:   now,
+	}
+	r.reserve("a", now)
+	r.reserve("b", now)
+	r.reserve("b", now)
+	a.Len(r.buckets, 2)
+
+	// 清理时只删除已经满了的令牌桶
+	now = now.Add(sweepInterval - time.Second)
+	r.reserve("c", now)
+	a.Len(r.buckets, 3)
+	now = now.Add(time.Second)
+	a.Equal(time.Duration(0), r.reserve("c", now))
+	a.Len(r.buckets, 1)
+
+	// 被清理的令牌桶重新开始
+	a.Equal(time.Duration(0), r.reserve("a", now))
+	a.Equal(time.Duration(0), r.reserve("a", now))
+	a.Equal(time.Second, r.reserve("a", now))
+	r.cancel("b")
+}
@@ -0,0 +1,54 @@
+// recovermw 提供一个捕获 panic 的 libsvc.ServiceMiddleware：处理器（或 localService 的类型检查）panic 时记录日志（包括调用栈），
+// 并返回 libsvc.ErrInternal
+package recovermw
+
+import (
+	"context"
+	"errors"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/rs/zerolog"
+)
+
+// Option 是创建 recover 中间件时的选项
+type Option func(*recoverer)
+
+type recoverer struct {
+	logger *zerolog.Logger
+}
+
+// OptLogger 设置 logger，默认使用 libsvc.PanicLogger(ctx)
+func OptLogger(logger *zerolog.Logger) Option {
+	return func(r *recoverer) {
+		l := logger.With().Str("comp", "svc.recover").Logger()
+		r.logger = &l
+	}
+}
+
+// New 创建一个 recover 中间件，一般通过 libsvc.DecorateServer 安装在最外层；
+// NOTE: 通过 libsvc.NewRPCServer 注册的服务已经内置了同样的保护
+func New(opts ...Option) libsvc.ServiceMiddleware {
+	r := &recoverer{}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return func(h libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(ctx context.Context, method libsvc.Method, input, output interface{}) error {
+			err := libsvc.Recover(func() error {
+				return h(ctx, method, input, output)
+			})
+			pe := (*libsvc.PanicError)(nil)
+			if !errors.As(err, &pe) {
+				return err
+			}
+
+			logger := r.logger
+			if logger == nil {
+				logger = libsvc.PanicLogger(ctx)
+			}
+			libsvc.LogPanic(logger, libsvc.ServiceName(ctx), method.Name(), pe)
+			return libsvc.ErrInternal
+		}
+	}
+}
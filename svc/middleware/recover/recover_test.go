@@ -0,0 +1,73 @@
+package recovermw
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	panicMethod = libsvc.NewTypedMethod[struct{}, struct{}]("panic")
+	errOops     = errors.New("oops")
+)
+
+func TestRecover(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	fail := false
+	svc := libsvc.NewLocalService("panic", panicMethod, panicMethod.Handler(func(context.Context, *struct{}, *struct{}) error {
+		if fail {
+			return errOops
+		}
+		var m map[string]int
+		m["x"] = 1
+		return nil
+	}))
+
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf)
+	dec := libsvc.DecorateService(svc, New(OptLogger(&logger)))
+
+	// 处理器 panic
+	_, err := panicMethod.Invoke(ctx, dec, &struct{}{})
+	a.Equal(libsvc.ErrInternal, err)
+	a.Contains(buf.String(), `"comp":"svc.recover"`)
+	a.Contains(buf.String(), `"svc":"panic"`)
+	a.Contains(buf.String(), `"panic":"assignment to entry in nil map"`)
+	a.Contains(buf.String(), `"stack":`)
+
+	// localService 的类型检查 panic
+	buf.Reset()
+	err = dec.Invoke(ctx, panicMethod, &struct{ X int }{}, &struct{}{})
+	a.Equal(libsvc.ErrInternal, err)
+	a.Contains(buf.String(), `"method":"panic"`)
+
+	// 普通错误原样返回
+	fail = true
+	_, err = panicMethod.Invoke(ctx, dec, &struct{}{})
+	a.Equal(errOops, err)
+
+	// 默认使用 ctx 中的 logger
+	fail = false
+	buf.Reset()
+	_, err = panicMethod.Invoke(logger.WithContext(ctx), libsvc.DecorateService(svc, New()), &struct{}{})
+	a.Equal(libsvc.ErrInternal, err)
+	a.NotContains(buf.String(), `"comp"`)
+	a.Contains(buf.String(), `"panic"`)
+
+	// ctx 中没有 logger 时使用全局的 log.Logger，panic 不会被吞掉
+	buf.Reset()
+	global := log.Logger
+	defer func() { log.Logger = global }()
+	log.Logger = logger
+	_, err = panicMethod.Invoke(ctx, libsvc.DecorateService(svc, New()), &struct{}{})
+	a.Equal(libsvc.ErrInternal, err)
+	a.Contains(buf.String(), `"stack":`)
+}
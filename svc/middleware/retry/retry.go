@@ -0,0 +1,178 @@
+// retrymw 提供一个重试的 libsvc.ServiceMiddleware：对幂等的方法，在遇到暂时性的错误时以指数退避（带随机抖动）重试
+package retrymw
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/rs/zerolog"
+)
+
+var (
+	// DefaultMaxAttempts 为默认最多尝试的次数（包括第一次）
+	DefaultMaxAttempts = 3
+	// DefaultBaseBackoff 为默认第一次重试前等待时间的上限，之后每次加倍
+	DefaultBaseBackoff = 50 * time.Millisecond
+	// DefaultMaxBackoff 为默认重试前等待时间的上限
+	DefaultMaxBackoff = 2 * time.Second
+)
+
+// Option 是创建重试中间件时的选项
+type Option func(*retrier)
+
+type retrier struct {
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	idempotent  func(libsvc.Method) bool
+	transient   func(error) bool
+	logger      zerolog.Logger
+}
+
+type attemptKeyType struct{}
+
+var attemptKey = attemptKeyType{}
+
+// OptMaxAttempts 设置最多尝试的次数（包括第一次），默认为 DefaultMaxAttempts
+func OptMaxAttempts(n int) Option {
+	return func(r *retrier) {
+		if n < 1 {
+			n = 1
+		}
+		r.maxAttempts = n
+	}
+}
+
+// OptBackoff 设置退避的时间：第 n 次重试前随机等待 [0, min(max, base*2^(n-1))) 的时间
+func OptBackoff(base, max time.Duration) Option {
+	return func(r *retrier) {
+		r.baseBackoff = base
+		r.maxBackoff = max
+	}
+}
+
+// OptIdempotent 设置判断方法是否幂等的函数，只有幂等的方法才会重试；默认为 IsIdempotent
+func OptIdempotent(idempotent func(libsvc.Method) bool) Option {
+	return func(r *retrier) {
+		r.idempotent = idempotent
+	}
+}
+
+// OptIdempotentMethods 将 methods 标记为幂等，只有这些方法才会重试
+func OptIdempotentMethods(methods ...libsvc.Method) Option {
+	set := make(map[libsvc.Method]bool, len(methods))
+	for _, method := range methods {
+		set[method] = true
+	}
+	return OptIdempotent(func(method libsvc.Method) bool {
+		return set[method]
+	})
+}
+
+// OptTransient 设置判断错误是否是暂时性的函数，只有暂时性的错误才会重试；默认为 IsTransient
+func OptTransient(transient func(error) bool) Option {
+	return func(r *retrier) {
+		r.transient = transient
+	}
+}
+
+// OptLogger 设置 logger，每次重试都会记录日志（包括尝试的次数）
+func OptLogger(logger *zerolog.Logger) Option {
+	return func(r *retrier) {
+		r.logger = logger.With().Str("comp", "svc.retry").Logger()
+	}
+}
+
+// IsTransient 判断错误是否是暂时性的：传输层的错误（libsvc.ErrUnavailable）、超时以及其它 libsvc.IsTemporary 的错误
+func IsTransient(err error) bool {
+	return errors.Is(err, libsvc.ErrUnavailable) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		libsvc.IsTemporary(err)
+}
+
+// IsIdempotent 根据方法的元数据（见 libsvc.MethodMeta）判断方法是否幂等
+func IsIdempotent(method libsvc.Method) bool {
+	return libsvc.MethodMetaOf(method).IsIdempotent()
+}
+
+// Attempt 返回当前是第几次尝试（从 1 开始），可以在内层的中间件中使用（例如记录日志）；不经过重试中间件时返回 0
+func Attempt(ctx context.Context) int {
+	n, _ := ctx.Value(attemptKey).(int)
+	return n
+}
+
+// New 创建一个重试中间件：每次尝试都使用 method.GenOutput() 生成新的出参，成功时才复制到调用者的出参中，
+// 以免失败的尝试中部分解码的数据泄漏；若 ctx 的剩余时间不足以等待下一次重试则马上返回最后的错误
+func New(opts ...Option) libsvc.ServiceMiddleware {
+	r := &retrier{
+		maxAttempts: DefaultMaxAttempts,
+		baseBackoff: DefaultBaseBackoff,
+		maxBackoff:  DefaultMaxBackoff,
+		idempotent:  IsIdempotent,
+		transient:   IsTransient,
+		logger:      zerolog.Nop(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return func(h libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(ctx context.Context, method libsvc.Method, input, output interface{}) error {
+			// 流式方法的出参已经发出，无法重试
+			if r.maxAttempts <= 1 || libsvc.IsStreamMethod(method) || !r.idempotent(method) {
+				return h(context.WithValue(ctx, attemptKey, 1), method, input, output)
+			}
+
+			for attempt := 1; ; attempt++ {
+				out := method.GenOutput()
+				err := h(context.WithValue(ctx, attemptKey, attempt), method, input, out)
+				if err == nil {
+					reflect.ValueOf(output).Elem().Set(reflect.ValueOf(out).Elem())
+					return nil
+				}
+				if attempt >= r.maxAttempts || !r.transient(err) || ctx.Err() != nil {
+					return err
+				}
+
+				// 等待
+				backoff := r.backoff(attempt)
+				if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+					return err
+				}
+				r.logger.Warn().
+					Str("method", method.Name()).
+					Int("attempt", attempt).
+					Str("backoff", backoff.String()).
+					Err(err).
+					Msg("")
+
+				timer := time.NewTimer(backoff)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return err
+				}
+			}
+		}
+	}
+}
+
+// backoff 返回第 attempt 次尝试失败后的等待时间
+func (r *retrier) backoff(attempt int) time.Duration {
+	ceil := r.baseBackoff
+	for i := 1; i < attempt && ceil < r.maxBackoff; i++ {
+		ceil *= 2
+	}
+	if ceil > r.maxBackoff {
+		ceil = r.maxBackoff
+	}
+	if ceil <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceil)))
+}
@@ -0,0 +1,121 @@
+package retrymw
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type output struct {
+	Values   []int
+	Attempts int
+}
+
+var (
+	flakyMethod = libsvc.NewTypedMethod[struct{}, output]("flaky")
+	otherMethod = libsvc.NewTypedMethod[struct{}, output]("other")
+	readMethod  = libsvc.WithMethodMeta(libsvc.NewTypedMethod[struct{}, output]("read"), libsvc.MethodMeta{ReadOnly: true})
+	errFatal    = errors.New("fatal")
+)
+
+// newFlakyService 返回的服务前 failures 次调用都会返回 err，并且在出参中留下部分数据
+func newFlakyService(failures int, err error) (libsvc.Service, *int) {
+	calls := 0
+	handler := func(ctx context.Context, _ *struct{}, out *output) error {
+		calls++
+		out.Values = append(out.Values, calls)
+		out.Attempts = Attempt(ctx)
+		if calls <= failures {
+			return err
+		}
+		return nil
+	}
+	return libsvc.NewLocalService(
+		"flaky",
+		flakyMethod, flakyMethod.Handler(handler),
+		otherMethod, otherMethod.Handler(handler),
+		readMethod, readMethod.Handler(handler),
+	), &calls
+}
+
+func TestRetry(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf)
+	mw := New(
+		OptMaxAttempts(3),
+		OptBackoff(time.Millisecond, 2*time.Millisecond),
+		OptIdempotentMethods(flakyMethod),
+		OptLogger(&logger),
+	)
+
+	// 暂时性的错误会重试，出参不会留下失败时的数据
+	svc, calls := newFlakyService(2, libsvc.Unavailable(errors.New("conn closed")))
+	out, err := flakyMethod.Invoke(ctx, libsvc.DecorateService(svc, mw), &struct{}{})
+	a.NoError(err)
+	a.Equal(3, *calls)
+	a.Equal([]int{3}, out.Values)
+	a.Equal(3, out.Attempts)
+	a.Contains(buf.String(), `"attempt":2`)
+
+	// 超过最多尝试次数
+	svc, calls = newFlakyService(5, context.DeadlineExceeded)
+	_, err = flakyMethod.Invoke(ctx, libsvc.DecorateService(svc, mw), &struct{}{})
+	a.Equal(context.DeadlineExceeded, err)
+	a.Equal(3, *calls)
+
+	// 非暂时性的错误不重试
+	svc, calls = newFlakyService(1, errFatal)
+	_, err = flakyMethod.Invoke(ctx, libsvc.DecorateService(svc, mw), &struct{}{})
+	a.Equal(errFatal, err)
+	a.Equal(1, *calls)
+
+	// 非幂等的方法不重试
+	svc, calls = newFlakyService(1, &libsvc.Error{Code: 1, Temporary: true})
+	out, err = otherMethod.Invoke(ctx, libsvc.DecorateService(svc, mw), &struct{}{})
+	a.Error(err)
+	a.Equal(1, *calls)
+
+	// ctx 剩余时间不足以等待下一次重试
+	svc, calls = newFlakyService(1, libsvc.Unavailable(errors.New("conn closed")))
+	slow := New(OptIdempotentMethods(flakyMethod), OptBackoff(time.Hour, time.Hour))
+	dctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	_, err = flakyMethod.Invoke(dctx, libsvc.DecorateService(svc, slow), &struct{}{})
+	a.True(errors.Is(err, libsvc.ErrUnavailable))
+	a.Equal(1, *calls)
+}
+
+func TestRetryMethodMeta(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	mw := New(OptBackoff(time.Millisecond, 2*time.Millisecond))
+
+	// 默认根据方法的元数据判断是否幂等
+	svc, calls := newFlakyService(1, libsvc.Unavailable(errors.New("conn closed")))
+	_, err := readMethod.Invoke(ctx, libsvc.DecorateService(svc, mw), &struct{}{})
+	a.NoError(err)
+	a.Equal(2, *calls)
+
+	svc, calls = newFlakyService(1, libsvc.Unavailable(errors.New("conn closed")))
+	_, err = otherMethod.Invoke(ctx, libsvc.DecorateService(svc, mw), &struct{}{})
+	a.Error(err)
+	a.Equal(1, *calls)
+}
+
+func TestIsTransient(t *testing.T) {
+	a := assert.New(t)
+	a.True(IsTransient(libsvc.Unavailable(errors.New("x"))))
+	a.True(IsTransient(context.DeadlineExceeded))
+	a.True(IsTransient(&libsvc.Error{Temporary: true}))
+	a.False(IsTransient(errFatal))
+	a.False(IsTransient(context.Canceled))
+	a.False(IsTransient(libsvc.ErrMethodNotFound))
+}
@@ -0,0 +1,55 @@
+// timeoutmw 提供一个超时的 libsvc.ServiceMiddleware：按方法元数据中的默认超时（见 libsvc.MethodMeta）限制调用的时间
+package timeoutmw
+
+import (
+	"context"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+)
+
+// Option 是创建超时中间件时的选项
+type Option func(*timeouter)
+
+type timeouter struct {
+	defaultTimeout time.Duration
+}
+
+// OptDefault 设置元数据中没有默认超时的方法所使用的超时，默认为 0 即不限制
+func OptDefault(timeout time.Duration) Option {
+	return func(t *timeouter) {
+		t.defaultTimeout = timeout
+	}
+}
+
+// Timeout 返回方法的超时：元数据中的优先，其次是 def，0 表示不限制
+func Timeout(method libsvc.Method, def time.Duration) time.Duration {
+	if timeout := libsvc.MethodMetaOf(method).Timeout; timeout > 0 {
+		return timeout
+	}
+	return def
+}
+
+// New 创建一个超时中间件：若 ctx 没有截止时间或者截止时间晚于方法的超时，则使用方法的超时；
+// 一般安装在客户端，这样 RPC 客户端会将超时传给服务端
+func New(opts ...Option) libsvc.ServiceMiddleware {
+	t := &timeouter{}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return func(h libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(ctx context.Context, method libsvc.Method, input, output interface{}) error {
+			timeout := Timeout(method, t.defaultTimeout)
+			if timeout <= 0 {
+				return h(ctx, method, input, output)
+			}
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+				return h(ctx, method, input, output)
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return h(ctx, method, input, output)
+		}
+	}
+}
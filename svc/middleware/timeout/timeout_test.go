@@ -0,0 +1,70 @@
+package timeoutmw
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	fastMethod = libsvc.WithMethodMeta(libsvc.NewTypedMethod[struct{}, time.Duration]("fast"), libsvc.MethodMeta{
+		Timeout: 10 * time.Millisecond,
+	})
+	plainMethod = libsvc.NewTypedMethod[struct{}, time.Duration]("plain")
+)
+
+func TestTimeout(t *testing.T) {
+	a := assert.New(t)
+
+	// 出参为处理器看到的剩余时间，没有截止时间时为 -1
+	handler := func(ctx context.Context, _ *struct{}, out *time.Duration) error {
+		*out = -1
+		if deadline, ok := ctx.Deadline(); ok {
+			*out = time.Until(deadline)
+		}
+		return nil
+	}
+	svc := libsvc.NewLocalService(
+		"timeout",
+		fastMethod, fastMethod.Handler(handler),
+		plainMethod, plainMethod.Handler(handler),
+	)
+
+	{
+		dec := libsvc.DecorateService(svc, New())
+
+		// 使用元数据中的超时
+		out, err := fastMethod.Invoke(context.Background(), dec, &struct{}{})
+		a.NoError(err)
+		a.True(*out > 0 && *out <= 10*time.Millisecond)
+
+		// 更早的截止时间不受影响
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		out, err = fastMethod.Invoke(ctx, dec, &struct{}{})
+		cancel()
+		a.NoError(err)
+		a.True(*out <= time.Millisecond)
+
+		// 没有元数据时不限制
+		out, err = plainMethod.Invoke(context.Background(), dec, &struct{}{})
+		a.NoError(err)
+		a.Equal(time.Duration(-1), *out)
+	}
+
+	{
+		dec := libsvc.DecorateService(svc, New(OptDefault(time.Hour)))
+
+		// 元数据优先
+		out, err := fastMethod.Invoke(context.Background(), dec, &struct{}{})
+		a.NoError(err)
+		a.True(*out <= 10*time.Millisecond)
+
+		// 使用默认超时
+		out, err = plainMethod.Invoke(context.Background(), dec, &struct{}{})
+		a.NoError(err)
+		a.True(*out > time.Minute && *out <= time.Hour)
+	}
+}
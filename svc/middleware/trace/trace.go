@@ -0,0 +1,97 @@
+// tracemw 提供分布式追踪的 libsvc.ServiceMiddleware：在客户端跟服务端为每次调用创建一个 Span，
+// 并通过元数据（jsonrpc 中的 ctx 字段）传播 W3C traceparent/tracestate
+package tracemw
+
+import (
+	"context"
+	"strconv"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	traceutil "github.com/huangjunwen/platform-kit/util/trace"
+)
+
+var (
+	// TraceparentKey 为 W3C traceparent 的元数据 key，每一跳都会替换为自己的 Span
+	TraceparentKey = libsvc.NewMetadataKey("traceparent", libsvc.StringCodec, libsvc.PropagateNextHop)
+	// TracestateKey 为 W3C tracestate 的元数据 key
+	TracestateKey = libsvc.NewMetadataKey("tracestate", libsvc.StringCodec, libsvc.PropagateNextHop)
+)
+
+// Option 是创建追踪中间件时的选项
+type Option func(*tracer)
+
+type tracer struct {
+	tracer *traceutil.Tracer
+}
+
+// OptTracer 设置所使用的 Tracer，默认为 traceutil.DefaultTracer
+func OptTracer(t *traceutil.Tracer) Option {
+	return func(tr *tracer) {
+		tr.tracer = t
+	}
+}
+
+// NewClient 创建一个客户端追踪中间件，一般通过 libsvc.DecorateClient 安装：父 Span 为 ctx 中的 Span（例如 HTTP 请求的 Span），
+// 并将新 Span 的 traceparent 传到下一跳
+func NewClient(opts ...Option) libsvc.ServiceMiddleware {
+	tr := newTracer(opts)
+	return func(h libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(ctx context.Context, method libsvc.Method, input, output interface{}) error {
+			ctx, span := tr.start(ctx, method, traceutil.SpanKindClient, traceutil.SpanContext{})
+			sc := span.SpanContext
+			ctx = TraceparentKey.With(ctx, sc.Traceparent())
+			if sc.TraceState != "" {
+				ctx = TracestateKey.With(ctx, sc.TraceState)
+			}
+			return tr.end(span, h(ctx, method, input, output))
+		}
+	}
+}
+
+// NewServer 创建一个服务端追踪中间件，一般通过 libsvc.DecorateServer 安装：父 Span 来自上一跳传来的 traceparent，
+// 处理器中发起的调用都会成为新 Span 的子 Span
+func NewServer(opts ...Option) libsvc.ServiceMiddleware {
+	tr := newTracer(opts)
+	return func(h libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(ctx context.Context, method libsvc.Method, input, output interface{}) error {
+			remote := traceutil.SpanContext{}
+			if traceparent, ok := TraceparentKey.Get(ctx); ok {
+				tracestate, _ := TracestateKey.Get(ctx)
+				remote, _ = traceutil.ParseTraceparent(traceparent, tracestate)
+			}
+			ctx, span := tr.start(ctx, method, traceutil.SpanKindServer, remote)
+			return tr.end(span, h(ctx, method, input, output))
+		}
+	}
+}
+
+func newTracer(opts []Option) *tracer {
+	tr := &tracer{
+		tracer: traceutil.DefaultTracer,
+	}
+	for _, opt := range opts {
+		opt(tr)
+	}
+	return tr
+}
+
+func (tr *tracer) start(ctx context.Context, method libsvc.Method, kind traceutil.SpanKind, remote traceutil.SpanContext) (context.Context, *traceutil.Span) {
+	svcName := libsvc.ServiceName(ctx)
+	ctx, span := tr.tracer.Start(ctx, svcName+"/"+method.Name(), kind, remote)
+	span.SetAttribute("rpc.system", "libsvc")
+	span.SetAttribute("rpc.service", svcName)
+	span.SetAttribute("rpc.method", method.Name())
+	if libsvc.IsNotification(ctx) {
+		span.SetAttribute("rpc.notification", "true")
+	}
+	return ctx, span
+}
+
+func (tr *tracer) end(span *traceutil.Span, err error) error {
+	if err != nil {
+		span.SetAttribute("rpc.error_code", strconv.Itoa(libsvc.AsError(err).Code))
+		span.SetError(err)
+	}
+	span.End()
+	return err
+}
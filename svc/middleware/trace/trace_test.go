@@ -0,0 +1,97 @@
+package tracemw
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	traceutil "github.com/huangjunwen/platform-kit/util/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mu    sync.Mutex
+	spans []*traceutil.Span
+}
+
+func (r *recorder) Export(span *traceutil.Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+var (
+	frontMethod = libsvc.NewTypedMethod[struct{}, struct{}]("front")
+	backMethod  = libsvc.NewTypedMethod[struct{}, struct{}]("back")
+	errBack     = errors.New("back")
+)
+
+func TestTrace(t *testing.T) {
+	a := assert.New(t)
+	rec := &recorder{}
+	tracer := traceutil.NewTracer(rec)
+	client := NewClient(OptTracer(tracer))
+	server := NewServer(OptTracer(tracer))
+
+	// front 服务调用 back 服务
+	backSvc := libsvc.NewLocalService("back", backMethod, backMethod.Handler(func(ctx context.Context, _ *struct{}, _ *struct{}) error {
+		// 收到的 traceparent 跟服务端的 Span 属于同一个 trace
+		traceparent, ok := TraceparentKey.Get(ctx)
+		a.True(ok)
+		a.Equal(traceutil.SpanFromContext(ctx).SpanContext.TraceID.String(), traceparent[3:35])
+		return errBack
+	}))
+	back := libsvc.DecorateService(backSvc, server)
+	frontSvc := libsvc.NewLocalService("front", frontMethod, frontMethod.Handler(func(ctx context.Context, _ *struct{}, _ *struct{}) error {
+		_, err := backMethod.Invoke(ctx, libsvc.DecorateService(back, client), &struct{}{})
+		return err
+	}))
+	front := libsvc.DecorateService(frontSvc, server)
+
+	ctx, root := tracer.Start(context.Background(), "root", traceutil.SpanKindInternal, traceutil.SpanContext{})
+	ctx = libsvc.WithPassthru(ctx, map[string]string{"x": "y"})
+	_, err := frontMethod.Invoke(ctx, libsvc.DecorateService(front, client), &struct{}{})
+	a.Equal(errBack, err)
+	root.End()
+
+	// back server, back client, front server, front client, root
+	a.Len(rec.spans, 5)
+	names := []string{}
+	for i, span := range rec.spans {
+		names = append(names, span.Name)
+		a.Equal(root.SpanContext.TraceID, span.SpanContext.TraceID)
+		if i != len(rec.spans)-1 {
+			a.Equal(rec.spans[i+1].SpanContext.SpanID, span.ParentSpanID)
+		}
+	}
+	a.Equal([]string{"back/back", "back/back", "front/front", "front/front", "root"}, names)
+	a.Equal(traceutil.SpanKindServer, rec.spans[0].Kind)
+	a.Equal(traceutil.SpanKindClient, rec.spans[1].Kind)
+	a.True(rec.spans[0].Error)
+	a.Equal("-1", rec.spans[0].Attributes["rpc.error_code"])
+	a.Equal("front", rec.spans[2].Attributes["rpc.service"])
+}
+
+func TestServerRemoteParent(t *testing.T) {
+	a := assert.New(t)
+	rec := &recorder{}
+
+	svc := libsvc.NewLocalService("back", backMethod, backMethod.Handler(func(context.Context, *struct{}, *struct{}) error {
+		return nil
+	}))
+	ctx := libsvc.WithIncomingMetadata(context.Background(), map[string]string{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"tracestate":  "k=v",
+	})
+	_, err := backMethod.Invoke(ctx, libsvc.DecorateService(svc, NewServer(OptTracer(traceutil.NewTracer(rec)))), &struct{}{})
+	a.NoError(err)
+	a.Len(rec.spans, 1)
+	a.Equal("4bf92f3577b34da6a3ce929d0e0e4736", rec.spans[0].SpanContext.TraceID.String())
+	a.Equal("00f067aa0ba902b7", rec.spans[0].ParentSpanID.String())
+	a.Equal("k=v", rec.spans[0].SpanContext.TraceState)
+
+	// traceparent 只传到下一跳
+	a.Nil(libsvc.OutgoingMetadata(ctx))
+}
@@ -0,0 +1,371 @@
+// validatemw 提供声明式的入参校验：入参结构体的字段通过 validate tag 声明约束，例如：
+//
+//	type Input struct {
+//	  Name  string   `json:"name" validate:"required,max=32"`
+//	  Age   int      `json:"age" validate:"min=0,max=150"`
+//	  Kind  string   `json:"kind" validate:"enum=a|b|c"`
+//	  Tags  []string `json:"tags" validate:"max=10"`
+//	  Code  string   `json:"code" validate:"omitempty,regex=^[a-z]+$"`
+//	  Inner *Inner   `json:"inner" validate:"required"`
+//	}
+//
+// 支持的规则：
+//   - required：不能为零值（nil、空字符串、0 等）
+//   - omitempty：为零值时跳过其它规则
+//   - min=n, max=n：数字的取值范围；字符串（按字符计）、slice、map 的长度范围
+//   - len=n：字符串（按字符计）、slice、map 的长度
+//   - enum=a|b|c：取值（按 fmt.Sprint 比较）必须是其中之一
+//   - regex=re：字符串必须匹配正则表达式；由于正则表达式中可能有逗号，它必须是最后一个规则
+//
+// 嵌套的结构体（包括指针、slice 以及 map 中的）会递归地校验；实现了 Validator 接口的类型在通过 tag 的校验后还会调用其 Validate 方法。
+// New 返回的中间件在处理器执行前校验入参，失败时返回 libsvc.ErrInvalidParams，其 Details 为各个出错的字段（jsonrpc 中的 error.data），例如：
+//
+//	[{"path": "/name", "message": "is required"}]
+package validatemw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/huangjunwen/platform-kit/svc/jsonschema"
+)
+
+// Validator 可以由入参（或其中的字段）的类型实现以进行自定义的校验，返回的错误作为该字段的错误信息；
+// 返回 jsonschema.ValidationErrors 时其中的路径相对于该字段
+type Validator interface {
+	Validate() error
+}
+
+var (
+	// ErrBadRule 在 validate tag 不正确时 panic
+	ErrBadRule = errors.New("Bad validate rule")
+)
+
+type fieldRules struct {
+	index     []int
+	name      string
+	required  bool
+	omitempty bool
+	min       *float64
+	max       *float64
+	length    *int
+	enum      []string
+	regex     *regexp.Regexp
+}
+
+type validator struct {
+	errs jsonschema.ValidationErrors
+}
+
+var (
+	// reflect.Type -> []*fieldRules
+	structRules sync.Map
+
+	validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+)
+
+// New 创建一个校验入参的中间件，一般通过 libsvc.DecorateServer 安装
+func New() libsvc.ServiceMiddleware {
+	return func(h libsvc.ServiceHandler) libsvc.ServiceHandler {
+		return func(ctx context.Context, method libsvc.Method, input, output interface{}) error {
+			if err := Validate(input); err != nil {
+				return err
+			}
+			return h(ctx, method, input, output)
+		}
+	}
+}
+
+// Validate 校验 v（一般为结构体指针），失败时返回 Code 为 libsvc.CodeInvalidParams 的 *libsvc.Error，
+// 其 Details 为 jsonschema.ValidationErrors
+func Validate(v interface{}) error {
+	vd := &validator{}
+	vd.validate(reflect.ValueOf(v), "")
+	if len(vd.errs) == 0 {
+		return nil
+	}
+	return &libsvc.Error{
+		Code:    libsvc.CodeInvalidParams,
+		Message: libsvc.ErrInvalidParams.Error(),
+		Details: vd.errs,
+	}
+}
+
+func (vd *validator) addError(path string, format string, args ...interface{}) {
+	vd.errs = append(vd.errs, &jsonschema.ValidationError{
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// validate 递归地校验 v 中的结构体
+func (vd *validator) validate(v reflect.Value, path string) {
+	if !v.IsValid() {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			vd.validate(v.Elem(), path)
+		}
+		return
+
+	case reflect.Struct:
+		for _, rules := range rulesOf(v.Type()) {
+			fv, err := v.FieldByIndexErr(rules.index)
+			if err != nil {
+				// 嵌入的结构体指针为 nil
+				continue
+			}
+			vd.validateField(fv, rules, path+"/"+escapePointer(rules.name))
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			vd.validate(v.Index(i), fmt.Sprintf("%s/%d", path, i))
+		}
+
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			vd.validate(iter.Value(), path+"/"+escapePointer(fmt.Sprint(iter.Key().Interface())))
+		}
+	}
+
+	vd.custom(v, path)
+}
+
+// custom 调用 Validator 接口
+func (vd *validator) custom(v reflect.Value, path string) {
+	var val Validator
+	switch {
+	case v.Type().Implements(validatorType):
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return
+		}
+		val = v.Interface().(Validator)
+	case v.CanAddr() && v.Addr().Type().Implements(validatorType):
+		val = v.Addr().Interface().(Validator)
+	default:
+		return
+	}
+
+	err := val.Validate()
+	if err == nil {
+		return
+	}
+	if errs, ok := err.(jsonschema.ValidationErrors); ok {
+		for _, e := range errs {
+			vd.addError(path+e.Path, "%s", e.Message)
+		}
+		return
+	}
+	vd.addError(path, "%s", err.Error())
+}
+
+func (vd *validator) validateField(v reflect.Value, rules *fieldRules, path string) {
+	if v.IsZero() {
+		if rules.required {
+			vd.addError(path, "is required")
+			return
+		}
+		if rules.omitempty {
+			return
+		}
+	}
+
+	n := len(vd.errs)
+	fv := v
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return
+		}
+		fv = fv.Elem()
+	}
+
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		vd.checkNumber(path, rules, float64(fv.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		vd.checkNumber(path, rules, float64(fv.Uint()))
+	case reflect.Float32, reflect.Float64:
+		vd.checkNumber(path, rules, fv.Float())
+	case reflect.String:
+		vd.checkLength(path, rules, utf8.RuneCountInString(fv.String()), "characters")
+		if rules.regex != nil && !rules.regex.MatchString(fv.String()) {
+			vd.addError(path, "should match %s", rules.regex.String())
+		}
+	case reflect.Slice, reflect.Array:
+		vd.checkLength(path, rules, fv.Len(), "items")
+	case reflect.Map:
+		vd.checkLength(path, rules, fv.Len(), "entries")
+	}
+
+	if len(rules.enum) != 0 {
+		s := fmt.Sprint(fv.Interface())
+		found := false
+		for _, e := range rules.enum {
+			if e == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			vd.addError(path, "should be one of %s", strings.Join(rules.enum, ", "))
+		}
+	}
+
+	// 本身已经出错时不再深入
+	if len(vd.errs) == n {
+		vd.validate(v, path)
+	}
+}
+
+func (vd *validator) checkNumber(path string, rules *fieldRules, f float64) {
+	if rules.min != nil && f < *rules.min {
+		vd.addError(path, "should be >= %v", *rules.min)
+	}
+	if rules.max != nil && f > *rules.max {
+		vd.addError(path, "should be <= %v", *rules.max)
+	}
+}
+
+func (vd *validator) checkLength(path string, rules *fieldRules, n int, unit string) {
+	if rules.length != nil && n != *rules.length {
+		vd.addError(path, "should have exactly %d %s", *rules.length, unit)
+	}
+	if rules.min != nil && float64(n) < *rules.min {
+		vd.addError(path, "should have at least %v %s", *rules.min, unit)
+	}
+	if rules.max != nil && float64(n) > *rules.max {
+		vd.addError(path, "should have at most %v %s", *rules.max, unit)
+	}
+}
+
+// rulesOf 返回结构体类型 t 中需要校验的字段及其规则（包括需要递归校验的字段）
+func rulesOf(t reflect.Type) []*fieldRules {
+	if rules, ok := structRules.Load(t); ok {
+		return rules.([]*fieldRules)
+	}
+	rules := []*fieldRules{}
+	for _, field := range reflect.VisibleFields(t) {
+		if field.PkgPath != "" || field.Anonymous && isStruct(field.Type) {
+			// 非导出字段；嵌入结构体（或其指针）的字段已经在 VisibleFields 中
+			continue
+		}
+		name, skip := jsonName(field)
+		if skip {
+			continue
+		}
+		rules = append(rules, parseRules(t, field, name))
+	}
+	structRules.Store(t, rules)
+	return rules
+}
+
+// isStruct 判断 t 是否结构体或结构体的指针
+func isStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// parseRules 解析字段的 validate tag
+func parseRules(t reflect.Type, field reflect.StructField, name string) *fieldRules {
+	rules := &fieldRules{
+		index: field.Index,
+		name:  name,
+	}
+	bad := func(rule string) {
+		panic(fmt.Errorf("%w: %s.%s %+q", ErrBadRule, t.String(), field.Name, rule))
+	}
+
+	kind := field.Type.Kind()
+	if kind == reflect.Ptr {
+		kind = field.Type.Elem().Kind()
+	}
+	isNumber := kind >= reflect.Int && kind <= reflect.Float64
+	hasLength := kind == reflect.String || kind == reflect.Slice || kind == reflect.Array || kind == reflect.Map
+
+	tag := field.Tag.Get("validate")
+	for tag != "" {
+		rule := tag
+		if strings.HasPrefix(tag, "regex=") {
+			// 正则表达式占用余下的所有部分
+			tag = ""
+		} else if i := strings.IndexByte(tag, ','); i >= 0 {
+			rule, tag = tag[:i], tag[i+1:]
+		} else {
+			tag = ""
+		}
+
+		key, arg := rule, ""
+		if i := strings.IndexByte(rule, '='); i >= 0 {
+			key, arg = rule[:i], rule[i+1:]
+		}
+		switch key {
+		case "required":
+			rules.required = true
+		case "omitempty":
+			rules.omitempty = true
+		case "min", "max":
+			f, err := strconv.ParseFloat(arg, 64)
+			if err != nil || !(isNumber || hasLength) {
+				bad(rule)
+			}
+			if key == "min" {
+				rules.min = &f
+			} else {
+				rules.max = &f
+			}
+		case "len":
+			n, err := strconv.Atoi(arg)
+			if err != nil || !hasLength {
+				bad(rule)
+			}
+			rules.length = &n
+		case "enum":
+			if arg == "" || !(isNumber || kind == reflect.String || kind == reflect.Bool) {
+				bad(rule)
+			}
+			rules.enum = strings.Split(arg, "|")
+		case "regex":
+			re, err := regexp.Compile(arg)
+			if err != nil || kind != reflect.String {
+				bad(rule)
+			}
+			rules.regex = re
+		case "":
+		default:
+			bad(rule)
+		}
+	}
+	return rules
+}
+
+// jsonName 返回字段在 json 中的名字
+func jsonName(field reflect.StructField) (name string, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	if name = strings.Split(tag, ",")[0]; name == "" {
+		name = field.Name
+	}
+	return name, false
+}
+
+// escapePointer 按 JSON Pointer 规则转义
+func escapePointer(s string) string {
+	return strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+}
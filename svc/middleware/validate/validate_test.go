@@ -0,0 +1,143 @@
+package validatemw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/huangjunwen/platform-kit/svc/jsonschema"
+	"github.com/stretchr/testify/assert"
+)
+
+type Address struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip" validate:"omitempty,len=6,regex=^[0-9,]+$"`
+}
+
+type Base struct {
+	ID int64 `json:"id" validate:"min=1"`
+}
+
+type userInput struct {
+	Base
+	Name     string             `json:"name" validate:"required,max=4"`
+	Age      *int               `json:"age,omitempty" validate:"min=0,max=150"`
+	Kind     string             `json:"kind" validate:"enum=a|b"`
+	Level    int                `json:"level" validate:"omitempty,enum=1|2|3"`
+	Tags     []string           `json:"tags" validate:"max=2"`
+	Address  *Address           `json:"address" validate:"required"`
+	Others   []Address          `json:"others"`
+	Extra    map[string]Address `json:"extra"`
+	Password password           `json:"password"`
+	ignored  string             `validate:"required"`
+}
+
+type password string
+
+func (p password) Validate() error {
+	if len(p) != 0 && len(p) < 3 {
+		return errors.New("too short")
+	}
+	return nil
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestValidate(t *testing.T) {
+	a := assert.New(t)
+
+	valid := func() *userInput {
+		return &userInput{
+			Base:    Base{ID: 1},
+			Name:    "好人",
+			Kind:    "a",
+			Address: &Address{City: "x", Zip: "123,45"},
+		}
+	}
+	a.NoError(Validate(valid()))
+
+	input := valid()
+	input.ID = 0
+	input.Name = "abcde"
+	input.Age = intPtr(151)
+	input.Kind = "c"
+	input.Level = 4
+	input.Tags = []string{"1", "2", "3"}
+	input.Address.Zip = "a"
+	input.Others = []Address{{City: "y"}, {}}
+	input.Extra = map[string]Address{"a/b": {}}
+	input.Password = "12"
+	err := Validate(input)
+	a.True(errors.Is(err, libsvc.ErrInvalidParams))
+	e := libsvc.AsError(err)
+	a.Equal(libsvc.CodeInvalidParams, e.Code)
+	data, _ := json.Marshal(e.Details)
+	a.JSONEq(`[
+		{"path": "/id", "message": "should be >= 1"},
+		{"path": "/name", "message": "should have at most 4 characters"},
+		{"path": "/age", "message": "should be <= 150"},
+		{"path": "/kind", "message": "should be one of a, b"},
+		{"path": "/level", "message": "should be one of 1, 2, 3"},
+		{"path": "/tags", "message": "should have at most 2 items"},
+		{"path": "/address/zip", "message": "should have exactly 6 characters"},
+		{"path": "/address/zip", "message": "should match ^[0-9,]+$"},
+		{"path": "/others/1/city", "message": "is required"},
+		{"path": "/extra/a~1b/city", "message": "is required"},
+		{"path": "/password", "message": "too short"}
+	]`, string(data))
+
+	input = valid()
+	input.Name = ""
+	input.Address = nil
+	err = Validate(input)
+	a.Equal(jsonschema.ValidationErrors{
+		{Path: "/name", Message: "is required"},
+		{Path: "/address", Message: "is required"},
+	}, libsvc.AsError(err).Details)
+
+	// 嵌入的结构体指针：其字段只校验一次，为 nil 时不校验
+	type withAddress struct {
+		*Address
+	}
+	err = Validate(&withAddress{Address: &Address{}})
+	a.Equal(jsonschema.ValidationErrors{
+		{Path: "/city", Message: "is required"},
+	}, libsvc.AsError(err).Details)
+	a.NoError(Validate(&withAddress{}))
+
+	// 不正确的规则
+	a.Panics(func() {
+		Validate(&struct {
+			B bool `validate:"min=1"`
+		}{})
+	})
+	a.Panics(func() {
+		Validate(&struct {
+			S string `validate:"unknown"`
+		}{})
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	method := libsvc.NewTypedMethod[Address, struct{}]("address")
+	called := false
+	svc := libsvc.DecorateService(libsvc.NewLocalService("address", method, method.Handler(func(context.Context, *Address, *struct{}) error {
+		called = true
+		return nil
+	})), New())
+
+	_, err := method.Invoke(ctx, svc, &Address{})
+	a.True(errors.Is(err, libsvc.ErrInvalidParams))
+	a.False(called)
+
+	_, err = method.Invoke(ctx, svc, &Address{City: "x"})
+	a.NoError(err)
+	a.True(called)
+}
@@ -0,0 +1,97 @@
+package libsvc
+
+import (
+	"context"
+	"path"
+)
+
+// MethodMatcher 判断方法是否匹配，用于 When 按方法选择中间件
+type MethodMatcher func(method Method) bool
+
+// When 返回一个只作用于匹配 match 的方法的中间件，mws[0] 是最外层中间件；不匹配的方法直接调用下一层，
+// 这样中间件本身不需要过滤方法名，例如：
+//
+//	DecorateServer(server,
+//	  recovermw.New(),
+//	  When(MatchPattern("admin.*"), audit),
+//	  When(MatchMeta(func(meta MethodMeta) bool { return meta.ReadOnly }), cache),
+//	)
+func When(match MethodMatcher, mws ...ServiceMiddleware) ServiceMiddleware {
+	return func(next ServiceHandler) ServiceHandler {
+		h := next
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+		return func(ctx context.Context, method Method, input, output interface{}) error {
+			if match(method) {
+				return h(ctx, method, input, output)
+			}
+			return next(ctx, method, input, output)
+		}
+	}
+}
+
+// MatchMethods 匹配 methods 中的方法
+func MatchMethods(methods ...Method) MethodMatcher {
+	set := make(map[Method]bool, len(methods))
+	for _, method := range methods {
+		set[method] = true
+	}
+	return func(method Method) bool {
+		return set[method]
+	}
+}
+
+// MatchNames 匹配名字为 names 之一的方法
+func MatchNames(names ...string) MethodMatcher {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return func(method Method) bool {
+		return set[method.Name()]
+	}
+}
+
+// MatchPattern 匹配名字符合 patterns 之一（path.Match 的模式，例如 "admin.*"）的方法，模式不合法时 panic
+func MatchPattern(patterns ...string) MethodMatcher {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic(err)
+		}
+	}
+	return func(method Method) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, method.Name()); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchMeta 匹配元数据（见 MethodMetaOf）满足 pred 的方法
+func MatchMeta(pred func(meta MethodMeta) bool) MethodMatcher {
+	return func(method Method) bool {
+		return pred(MethodMetaOf(method))
+	}
+}
+
+// MatchAny 匹配满足 matchers 之一的方法
+func MatchAny(matchers ...MethodMatcher) MethodMatcher {
+	return func(method Method) bool {
+		for _, match := range matchers {
+			if match(method) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchNot 匹配不满足 match 的方法
+func MatchNot(match MethodMatcher) MethodMatcher {
+	return func(method Method) bool {
+		return !match(method)
+	}
+}
@@ -0,0 +1,86 @@
+package libsvc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	svcNameMethod = NewTypedMethod[struct{}, struct{}]("svcName")
+)
+
+func TestServiceName(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	svc := NewLocalService("name.svc", svcNameMethod, svcNameMethod.Handler(func(context.Context, *struct{}, *struct{}) error {
+		return nil
+	}))
+	a.Equal("", ServiceName(ctx))
+
+	names := []string{}
+	mw := func(h ServiceHandler) ServiceHandler {
+		return func(ctx context.Context, method Method, input, output interface{}) error {
+			names = append(names, ServiceName(ctx))
+			return h(ctx, method, input, output)
+		}
+	}
+	_, err := svcNameMethod.Invoke(ctx, DecorateService(svc, mw), &struct{}{})
+	a.NoError(err)
+	_, err = svcNameMethod.Invoke(ctx, DecorateServiceWithInterface(svc, mw), &struct{}{})
+	a.NoError(err)
+	a.Equal([]string{"name.svc", "name.svc"}, names)
+}
+
+func TestWhen(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	getMethod := WithMethodMeta(NewTypedMethod[struct{}, struct{}]("get"), MethodMeta{ReadOnly: true})
+	setMethod := NewTypedMethod[struct{}, struct{}]("set")
+	adminMethod := NewTypedMethod[struct{}, struct{}]("admin.reset")
+	noop := func(context.Context, *struct{}, *struct{}) error { return nil }
+	svc := NewLocalService(
+		"when.svc",
+		getMethod, getMethod.Handler(noop),
+		setMethod, setMethod.Handler(noop),
+		adminMethod, adminMethod.Handler(noop),
+	)
+
+	calls := []string{}
+	record := func(tag string) ServiceMiddleware {
+		return func(h ServiceHandler) ServiceHandler {
+			return func(ctx context.Context, method Method, input, output interface{}) error {
+				calls = append(calls, tag+":"+method.Name())
+				return h(ctx, method, input, output)
+			}
+		}
+	}
+	dec := DecorateService(svc,
+		record("all"),
+		When(MatchMeta(func(meta MethodMeta) bool { return meta.ReadOnly }), record("read")),
+		When(MatchNot(MatchAny(MatchMethods(getMethod), MatchPattern("admin.*"))), record("write1"), record("write2")),
+		When(MatchPattern("admin.*"), record("admin")),
+		When(MatchNames("get", "set"), record("name")),
+	)
+
+	for _, method := range []*TypedMethod[struct{}, struct{}]{getMethod, setMethod, adminMethod} {
+		calls = calls[:0]
+		_, err := method.Invoke(ctx, dec, &struct{}{})
+		a.NoError(err)
+		switch method {
+		case getMethod:
+			a.Equal([]string{"all:get", "read:get", "name:get"}, calls)
+		case setMethod:
+			a.Equal([]string{"all:set", "write1:set", "write2:set", "name:set"}, calls)
+		case adminMethod:
+			a.Equal([]string{"all:admin.reset", "admin:admin.reset"}, calls)
+		}
+	}
+
+	a.Panics(func() {
+		MatchPattern("[")
+	}, "Expect panic for bad pattern")
+}
@@ -0,0 +1,85 @@
+package libsvc
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+type notificationKeyType struct{}
+
+var notificationKey = notificationKeyType{}
+
+// WithNotification 标记该次调用为 notification（即单向调用）：调用者不关心出参及业务错误，
+// 对于远程服务，请求发送后马上返回，服务端也不会返回响应；一般使用 Notify 即可
+func WithNotification(ctx context.Context) context.Context {
+	return context.WithValue(ctx, notificationKey, true)
+}
+
+// IsNotification 返回该次调用是否为 notification，用于客户端一侧（例如中间件）；执行处理器前标记会被清除，
+// 因此处理器中总是返回 false
+func IsNotification(ctx context.Context) bool {
+	v, _ := ctx.Value(notificationKey).(bool)
+	return v
+}
+
+// withoutNotification 清除 notification 标记，在调用处理器前使用：处理器内部用同一个 ctx 发起的调用不应成为 notification
+func withoutNotification(ctx context.Context) context.Context {
+	if !IsNotification(ctx) {
+		return ctx
+	}
+	return context.WithValue(ctx, notificationKey, false)
+}
+
+// Notify 以 notification 的方式调用服务 svc 的一个方法：
+//   - 远程服务：请求发送后马上返回，返回的错误只与发送有关；若协议或传输层不支持则返回 ErrNotifyUnsupported
+//   - 进程内客户端：方法在新的 goroutine 中执行
+//   - 其它服务：方法同步执行，出参被忽略
+func Notify(ctx context.Context, svc Service, method Method, input interface{}) error {
+	return svc.Invoke(WithNotification(ctx), method, input, method.GenOutput())
+}
+
+// invokeAsync 在新的 goroutine 中执行方法，不等待其结束，ctx 的取消不会影响执行；
+// 方法 panic 时使用 PanicLogger(ctx) 记录日志
+func invokeAsync(ctx context.Context, svc ServiceWithInterface, method Method, input, output interface{}) error {
+	if !svc.Interface().HasMethod(method) {
+		return ErrMethodNotFound
+	}
+	method.AssertInputType(input)
+	method.AssertOutputType(output)
+	ctx = withoutNotification(context.WithoutCancel(ctx))
+	go func() {
+		err := Recover(func() error {
+			return svc.Invoke(ctx, method, input, output)
+		})
+		pe := (*PanicError)(nil)
+		if errors.As(err, &pe) {
+			LogPanic(PanicLogger(ctx), svc.Name(), method.Name(), pe)
+		}
+	}()
+	return nil
+}
+
+// notify 发送 notification 请求
+func (svc *rpcClientService) notify(ctx context.Context, method Method, input interface{}) error {
+	client := svc.client
+	protocol, ok := client.protocol.Protocol().(RPCClientNotifyProtocol)
+	if !ok {
+		return ErrNotifyUnsupported
+	}
+
+	// 发现服务
+	requestor, err := client.transport.Discover(ctx, svc.name)
+	if err != nil {
+		return err
+	}
+	notifier, ok := requestor.(RPCTransportNotifier)
+	if !ok {
+		return ErrNotifyUnsupported
+	}
+
+	// 发送
+	return notifier.Notify(ctx, func(reqWriter io.Writer) error {
+		return protocol.ProcessNotification(reqWriter, method.Name(), input, Passthru(ctx))
+	})
+}
@@ -0,0 +1,106 @@
+package libsvc
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type notifyInput struct {
+	Msg string
+}
+
+var (
+	notifyMethod = NewTypedMethod[notifyInput, struct{}]("notify")
+	echoMethod   = NewTypedMethod[notifyInput, notifyInput]("echo")
+)
+
+func TestNotify(t *testing.T) {
+	a := assert.New(t)
+
+	received := make(chan string, 1)
+	block := make(chan struct{})
+	echo := NewLocalService("notify.echo", echoMethod, echoMethod.Handler(func(ctx context.Context, input, output *notifyInput) error {
+		*output = *input
+		return nil
+	}))
+	a.NoError(InprocServer().Register(echo))
+	defer InprocServer().Deregister(echo.Name())
+
+	svc := NewLocalService("notify.svc", notifyMethod, notifyMethod.Handler(func(ctx context.Context, input *notifyInput, _ *struct{}) error {
+		<-block
+		// 处理器内部发起的调用不是 notification
+		a.False(IsNotification(ctx))
+		output, err := echoMethod.Invoke(ctx, InprocClient().Make("notify.echo"), input)
+		if err != nil {
+			return err
+		}
+		received <- output.Msg
+		return nil
+	}))
+	a.NoError(InprocServer().Register(svc))
+	defer InprocServer().Deregister(svc.Name())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.False(IsNotification(ctx))
+
+	// 进程内客户端不等待方法执行完，且 ctx 取消后仍然继续执行
+	a.NoError(notifyMethod.Notify(ctx, InprocClient().Make("notify.svc"), &notifyInput{Msg: "hello"}))
+	cancel()
+	close(block)
+	a.Equal("hello", <-received)
+
+	// 找不到服务或方法
+	a.Equal(ErrSvcNotFound, notifyMethod.Notify(ctx, InprocClient().Make("notify.notExists"), &notifyInput{}))
+	a.Equal(ErrMethodNotFound, Notify(ctx, InprocClient().Make("notify.svc"), noopMethod, noopMethod.GenInput()))
+
+	// 其它服务同步执行
+	a.NoError(notifyMethod.Notify(context.Background(), svc, &notifyInput{Msg: "world"}))
+	a.Equal("world", <-received)
+}
+
+// syncBuffer 是并发安全的 bytes.Buffer
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestNotifyPanic(t *testing.T) {
+	a := assert.New(t)
+
+	done := make(chan struct{})
+	svc := NewLocalService("notify.panic", notifyMethod, notifyMethod.Handler(func(context.Context, *notifyInput, *struct{}) error {
+		defer close(done)
+		panic("oops")
+	}))
+	a.NoError(InprocServer().Register(svc))
+	defer InprocServer().Deregister(svc.Name())
+
+	// 进程内 notification 的 panic 不会令进程崩溃，并且会记录日志
+	buf := &syncBuffer{}
+	ctx := zerolog.New(buf).WithContext(context.Background())
+	a.NoError(notifyMethod.Notify(ctx, InprocClient().Make("notify.panic"), &notifyInput{}))
+	<-done
+	a.Eventually(func() bool {
+		return strings.Contains(buf.String(), `"panic":"oops"`)
+	}, time.Second, time.Millisecond)
+	a.Contains(buf.String(), `"svc":"notify.panic"`)
+}
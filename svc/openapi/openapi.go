@@ -0,0 +1,203 @@
+// openapi 为 libsvc.Interface 生成 OpenAPI 3.1 文档：每个方法对应一个 POST 操作，
+// 请求体为方法的入参，成功响应为方法的出参，其它响应为 jsonrpc 的错误对象
+package openapi
+
+import (
+	"reflect"
+	"sort"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/huangjunwen/platform-kit/svc/jsonschema"
+)
+
+// Version 是生成的文档所使用的 OpenAPI 版本
+const Version = "3.1.0"
+
+const (
+	contentType = "application/json"
+	refPrefix   = "#/components/schemas/"
+	// 错误对象的名字，NOTE: jsonschema.Reflector 生成的名字中不会有 '.'（除非名字冲突）
+	errorSchemaName = "jsonrpc.Error"
+)
+
+// Doc 是 OpenAPI 文档，这里只包含所需的一个子集
+type Doc struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       *Info                `json:"info"`
+	Servers    []*Server            `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components,omitempty"`
+}
+
+// Info 是文档的元信息
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Server 是服务器信息
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem 是单个路径
+type PathItem struct {
+	Post *Operation `json:"post,omitempty"`
+}
+
+// Operation 是单个操作，对应一个方法
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Deprecated  bool                 `json:"deprecated,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// RequestBody 是请求体
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response 是响应
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType 是某种媒体类型的内容
+type MediaType struct {
+	Schema *jsonschema.Schema `json:"schema"`
+}
+
+// Components 是可复用的定义
+type Components struct {
+	Schemas map[string]*jsonschema.Schema `json:"schemas,omitempty"`
+}
+
+// Option 是生成文档时的选项
+type Option func(*Doc)
+
+// OptInfo 设置文档的标题，版本和描述，默认标题为服务名，版本为 "0.0.0"
+func OptInfo(title, version, description string) Option {
+	return func(doc *Doc) {
+		doc.Info = &Info{
+			Title:       title,
+			Version:     version,
+			Description: description,
+		}
+	}
+}
+
+// OptServer 添加一个服务器
+func OptServer(url, description string) Option {
+	return func(doc *Doc) {
+		doc.Servers = append(doc.Servers, &Server{
+			URL:         url,
+			Description: description,
+		})
+	}
+}
+
+// Document 为名为 svcName 的服务的接口 itf 生成 OpenAPI 文档，每个方法对应路径：
+//
+//	POST /<svcName>/<methodName>
+//
+// 方法的元数据（见 libsvc.MethodMeta）中的说明，标签以及弃用说明会体现在对应的操作上
+func Document(svcName string, itf libsvc.Interface, opts ...Option) *Doc {
+	doc := &Doc{
+		OpenAPI: Version,
+		Info: &Info{
+			Title:   svcName,
+			Version: "0.0.0",
+		},
+		Paths: map[string]*PathItem{},
+	}
+	for _, opt := range opts {
+		opt(doc)
+	}
+
+	methods := itf.Methods()
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Name() < methods[j].Name()
+	})
+
+	r := &jsonschema.Reflector{RefPrefix: refPrefix}
+	errorResponse := &Response{
+		Description: "jsonrpc error object",
+		Content: map[string]*MediaType{
+			contentType: {Schema: &jsonschema.Schema{Ref: refPrefix + errorSchemaName}},
+		},
+	}
+	for _, method := range methods {
+		meta := libsvc.MethodMetaOf(method)
+		description := meta.Description
+		if meta.IsDeprecated() {
+			if description != "" {
+				description += "\n\n"
+			}
+			description += "Deprecated: " + meta.Deprecated
+		}
+		doc.Paths["/"+svcName+"/"+method.Name()] = &PathItem{
+			Post: &Operation{
+				OperationID: svcName + "." + method.Name(),
+				Description: description,
+				Tags:        append([]string{svcName}, meta.Tags...),
+				Deprecated:  meta.IsDeprecated(),
+				RequestBody: &RequestBody{
+					Required: true,
+					Content: map[string]*MediaType{
+						contentType: {Schema: r.Reflect(deref(method.GenInput()))},
+					},
+				},
+				Responses: map[string]*Response{
+					"200": {
+						Description: "OK",
+						Content: map[string]*MediaType{
+							contentType: {Schema: r.Reflect(deref(method.GenOutput()))},
+						},
+					},
+					"default": errorResponse,
+				},
+			},
+		}
+	}
+
+	schemas := r.Defs()
+	if schemas == nil {
+		schemas = map[string]*jsonschema.Schema{}
+	}
+	schemas[errorSchemaName] = errorSchema()
+	doc.Components = &Components{
+		Schemas: schemas,
+	}
+	return doc
+}
+
+// errorSchema 返回 jsonrpc 错误对象的 Schema
+func errorSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{
+		Type: jsonschema.Type{"object"},
+		Properties: map[string]*jsonschema.Schema{
+			"code":      {Type: jsonschema.Type{"integer"}},
+			"message":   {Type: jsonschema.Type{"string"}},
+			"data":      {},
+			"temporary": {Type: jsonschema.Type{"boolean"}},
+		},
+		Required: []string{"code", "message"},
+	}
+}
+
+// deref 返回出入参（指针）所指的类型
+func deref(v interface{}) reflect.Type {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,91 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/stretchr/testify/assert"
+)
+
+type User struct {
+	ID   int    `json:"id" jsonschema:"required"`
+	Name string `json:"name"`
+}
+
+type getUserInput struct {
+	ID int `json:"id" jsonschema:"required"`
+}
+
+func TestDocument(t *testing.T) {
+	a := assert.New(t)
+
+	itf := libsvc.NewInterface(
+		libsvc.NewTypedMethod[getUserInput, User]("getUser"),
+		libsvc.WithMethodMeta(libsvc.NewTypedMethod[User, map[string]string]("updateUser"), libsvc.MethodMeta{
+			Description: "Update a user",
+			Deprecated:  "use saveUser instead",
+			Tags:        []string{"write"},
+		}),
+	)
+	doc := Document("user.svc", itf, OptInfo("User service", "1.0.0", ""), OptServer("https://api.example.com", "prod"))
+
+	data, err := json.Marshal(doc)
+	a.NoError(err)
+	a.JSONEq(`{
+		"openapi": "3.1.0",
+		"info": {"title": "User service", "version": "1.0.0"},
+		"servers": [{"url": "https://api.example.com", "description": "prod"}],
+		"paths": {
+			"/user.svc/getUser": {
+				"post": {
+					"operationId": "user.svc.getUser",
+					"tags": ["user.svc"],
+					"requestBody": {
+						"required": true,
+						"content": {"application/json": {"schema": {"$ref": "#/components/schemas/getUserInput"}}}
+					},
+					"responses": {
+						"200": {"description": "OK", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+						"default": {"description": "jsonrpc error object", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/jsonrpc.Error"}}}}
+					}
+				}
+			},
+			"/user.svc/updateUser": {
+				"post": {
+					"operationId": "user.svc.updateUser",
+					"description": "Update a user\n\nDeprecated: use saveUser instead",
+					"tags": ["user.svc", "write"],
+					"deprecated": true,
+					"requestBody": {
+						"required": true,
+						"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}
+					},
+					"responses": {
+						"200": {"description": "OK", "content": {"application/json": {"schema": {"type": ["object", "null"], "additionalProperties": {"type": "string"}}}}},
+						"default": {"description": "jsonrpc error object", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/jsonrpc.Error"}}}}
+					}
+				}
+			}
+		},
+		"components": {
+			"schemas": {
+				"User": {
+					"type": "object",
+					"properties": {"id": {"type": "integer"}, "name": {"type": "string"}},
+					"required": ["id"]
+				},
+				"getUserInput": {
+					"type": "object",
+					"properties": {"id": {"type": "integer"}},
+					"required": ["id"]
+				},
+				"jsonrpc.Error": {
+					"type": "object",
+					"properties": {"code": {"type": "integer"}, "message": {"type": "string"}, "data": {}, "temporary": {"type": "boolean"}},
+					"required": ["code", "message"]
+				}
+			}
+		}
+	}`, string(data))
+}
@@ -2,6 +2,7 @@ package jsonrpc
 
 import (
 	"encoding/json"
+	libsvc "github.com/huangjunwen/platform-kit/svc"
 	"github.com/mailru/easyjson"
 	"github.com/mailru/easyjson/opt"
 )
@@ -17,11 +18,14 @@ type request struct {
 	// params 只能是 Object 或者 Array
 	Params interface{} `json:"params,omitempty"`
 
-	// id 只能是字符串或者是数字，在这个实现中不支持 notification，id 必填
-	ID interface{} `json:"id"`
+	// id 只能是字符串或者是数字，缺少 id 时表示 notification，服务端不会返回响应
+	ID interface{} `json:"id,omitempty"`
 
 	// 扩展
 	Context map[string]string `json:"ctx,omitempty"`
+
+	// 扩展：调用的剩余时间（毫秒），服务端以此设置处理的 deadline
+	Timeout int64 `json:"timeout,omitempty"`
 }
 
 // easyjson:json
@@ -35,6 +39,9 @@ type response struct {
 	Error *responseError `json:"error,omitempty"`
 
 	ID interface{} `json:"id"`
+
+	// 扩展：流式响应中每一帧都是一个响应，出参帧为 "item"，最后一帧为 "end"
+	Stream string `json:"stream,omitempty"`
 }
 
 // easyjson:json
@@ -45,6 +52,9 @@ type responseError struct {
 	Message string `json:"message"`
 
 	Data interface{} `json:"data,omitempty"`
+
+	// 扩展：错误是否是暂时性的（例如超时、过载），重试可能成功
+	Temporary bool `json:"temporary,omitempty"`
 }
 
 // ResponseError 代表一个 jsonrpc 响应错误，客户端在收到 error 时可以作类型判断，
@@ -90,3 +100,13 @@ func (e *responseError) ErrData() json.RawMessage {
 	}
 	return json.RawMessage(*ret)
 }
+
+// Unwrap 返回对应的 *libsvc.Error，使得 errors.Is(err, libsvc.ErrMethodNotFound) 等可以如同进程内调用一样判断
+func (e *responseError) Unwrap() error {
+	ret := libsvc.NewError(e.Code.V, e.Message)
+	if data := e.ErrData(); len(data) != 0 {
+		ret.Details = data
+	}
+	ret.Temporary = e.Temporary
+	return ret
+}
@@ -48,6 +48,8 @@ func easyjson3bd68309DecodeBitbucketOrgJnjteamPlatformPSvc2ProtocolsJsonrpc(in *
 			} else {
 				out.Data = in.Interface()
 			}
+		case "temporary":
+			out.Temporary = bool(in.Bool())
 		default:
 			in.SkipRecursive()
 		}
@@ -98,6 +100,16 @@ func easyjson3bd68309EncodeBitbucketOrgJnjteamPlatformPSvc2ProtocolsJsonrpc(out
 			out.Raw(json.Marshal(in.Data))
 		}
 	}
+	if in.Temporary {
+		const prefix string = ",\"temporary\":"
+		if first {
+			first = false
+			out.RawString(prefix[1:])
+		} else {
+			out.RawString(prefix)
+		}
+		out.Bool(bool(in.Temporary))
+	}
 	out.RawByte('}')
 }
 
@@ -173,6 +185,8 @@ func easyjson3bd68309DecodeBitbucketOrgJnjteamPlatformPSvc2ProtocolsJsonrpc1(in
 			} else {
 				out.ID = in.Interface()
 			}
+		case "stream":
+			out.Stream = string(in.String())
 		default:
 			in.SkipRecursive()
 		}
@@ -239,6 +253,16 @@ func easyjson3bd68309EncodeBitbucketOrgJnjteamPlatformPSvc2ProtocolsJsonrpc1(out
 			out.Raw(json.Marshal(in.ID))
 		}
 	}
+	if in.Stream != "" {
+		const prefix string = ",\"stream\":"
+		if first {
+			first = false
+			out.RawString(prefix[1:])
+		} else {
+			out.RawString(prefix)
+		}
+		out.String(string(in.Stream))
+	}
 	out.RawByte('}')
 }
 
@@ -326,6 +350,8 @@ func easyjson3bd68309DecodeBitbucketOrgJnjteamPlatformPSvc2ProtocolsJsonrpc2(in
 				}
 				in.Delim('}')
 			}
+		case "timeout":
+			out.Timeout = int64(in.Int64())
 		default:
 			in.SkipRecursive()
 		}
@@ -376,7 +402,7 @@ func easyjson3bd68309EncodeBitbucketOrgJnjteamPlatformPSvc2ProtocolsJsonrpc2(out
 			out.Raw(json.Marshal(in.Params))
 		}
 	}
-	{
+	if in.ID != nil {
 		const prefix string = ",\"id\":"
 		if first {
 			first = false
@@ -416,6 +442,16 @@ func easyjson3bd68309EncodeBitbucketOrgJnjteamPlatformPSvc2ProtocolsJsonrpc2(out
 			out.RawByte('}')
 		}
 	}
+	if in.Timeout != 0 {
+		const prefix string = ",\"timeout\":"
+		if first {
+			first = false
+			out.RawString(prefix[1:])
+		} else {
+			out.RawString(prefix)
+		}
+		out.Int64(int64(in.Timeout))
+	}
 	out.RawByte('}')
 }
 
@@ -1,11 +1,17 @@
 package jsonrpc
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"time"
 
 	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/huangjunwen/platform-kit/svc/jsonschema"
 	"github.com/mailru/easyjson"
 	"github.com/mailru/easyjson/opt"
 	"github.com/rs/xid"
@@ -17,7 +23,6 @@ const (
 	codeMethodNotFound = -32601
 	codeInvalidParams  = -32602
 	codeInternalError  = -32603
-	codeGeneralError   = -1
 )
 
 const (
@@ -26,58 +31,168 @@ const (
 	msgMethodNotFound = "Method not found"
 	msgInvalidParams  = "Invalid params"
 	msgInternalError  = "Internal error"
-	msgGeneralError   = "General error"
 )
 
 var (
-	missingID     = easyjson.RawMessage(`"Missing field 'id'"`)
 	badIDValue    = easyjson.RawMessage(`"Field 'id' should be string or number"`)
 	badParamValue = easyjson.RawMessage(`"Field 'param' should be object or array"`)
+	emptyBatch    = easyjson.RawMessage(`"Empty batch"`)
 	missingMethod = easyjson.RawMessage(`"Missing field 'method'"`)
+	emptyParams   = []byte(`{}`)
+)
+
+const (
+	streamItem = "item"
+	streamEnd  = "end"
 )
 
 var (
 	errIDMismatch = errors.New("Request/response id mismatch")
+	errBadFrame   = errors.New("Bad stream frame")
+	errBadBatch   = errors.New("Bad batch response")
+	errNoResponse = errors.New("Missing response in batch")
 )
 
 var (
 	// ServerProtocolFactory 为 jsonrpc 服务端协议工厂
-	ServerProtocolFactory libsvc.RPCServerProtocolFactory = serverProtocolFactory{}
+	ServerProtocolFactory libsvc.RPCServerProtocolFactory = NewServerProtocolFactory()
 	// ClientProtocolFactory 为 jsonrpc 客户端协议工厂
-	ClientProtocolFactory libsvc.RPCClientProtocolFactory = clientProtocolFactory{}
+	ClientProtocolFactory libsvc.RPCClientProtocolFactory = NewClientProtocolFactory()
+)
+
+// ServerOption 是创建服务端协议工厂时的选项
+type ServerOption func(*serverProtocolFactory)
+
+// ClientOption 是创建客户端协议工厂时的选项
+type ClientOption func(*clientProtocolFactory)
+
+var (
+	_ libsvc.RPCServerStreamProtocol  = (*serverProtocol)(nil)
+	_ libsvc.RPCServerBatchProtocol   = (*serverProtocol)(nil)
+	_ libsvc.RPCClientBatchProtocol   = (*clientProtocol)(nil)
+	_ libsvc.RPCServerTimeoutProtocol = (*serverProtocol)(nil)
+	_ libsvc.RPCClientTimeoutProtocol = (*clientProtocol)(nil)
+	_ libsvc.RPCClientStreamProtocol  = (*clientProtocol)(nil)
+	_ libsvc.RPCClientNotifyProtocol  = (*clientProtocol)(nil)
 )
 
-type serverProtocolFactory struct{}
+type serverProtocolFactory struct {
+	validateParams  bool
+	maxMetadataSize int
+	// reflect.Type -> *jsonschema.Schema
+	schemas sync.Map
+}
 
-type clientProtocolFactory struct{}
+type clientProtocolFactory struct {
+	maxMetadataSize int
+}
 
 type serverProtocol struct {
+	factory *serverProtocolFactory
 	// params 延迟解析
 	params easyjson.RawMessage
 	// 请求的 id，不需要解析，只需要检查类型，响应时原样返回
 	id easyjson.RawMessage
+	// 请求是否为 notification，是的话不返回任何响应
+	notification bool
+	// 请求所携带的剩余时间
+	timeout time.Duration
 }
 
 type clientProtocol struct {
 	// 记录下请求的 id，用于对比响应
 	id string
+	// 批量请求时各个请求的 id
+	ids []string
+	// 调用的剩余时间（毫秒）
+	timeout int64
+	// 元数据的大小上限
+	maxMetadataSize int
+}
+
+// OptValidateParams 使得服务端在解析入参前先使用入参类型的 JSON Schema 校验 params，
+// 校验失败时返回 Invalid params 错误，其 data 为各个出错的位置及原因，例如：
+//
+//	[{"path": "/name", "message": "is required"}]
+func OptValidateParams() ServerOption {
+	return func(f *serverProtocolFactory) {
+		f.validateParams = true
+	}
+}
+
+// OptMaxMetadataSize 设置请求中元数据（ctx 字段）的大小上限，超过时返回错误，默认为 libsvc.DefaultMaxMetadataSize
+func OptMaxMetadataSize(n int) ServerOption {
+	return func(f *serverProtocolFactory) {
+		f.maxMetadataSize = n
+	}
+}
+
+// NewServerProtocolFactory 创建一个 jsonrpc 服务端协议工厂
+func NewServerProtocolFactory(opts ...ServerOption) libsvc.RPCServerProtocolFactory {
+	f := &serverProtocolFactory{
+		maxMetadataSize: libsvc.DefaultMaxMetadataSize,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// OptClientMaxMetadataSize 设置请求中元数据（ctx 字段）的大小上限，超过时返回 libsvc.ErrMetadataTooLarge，
+// 默认为 libsvc.DefaultMaxMetadataSize
+func OptClientMaxMetadataSize(n int) ClientOption {
+	return func(f *clientProtocolFactory) {
+		f.maxMetadataSize = n
+	}
+}
+
+// NewClientProtocolFactory 创建一个 jsonrpc 客户端协议工厂
+func NewClientProtocolFactory(opts ...ClientOption) libsvc.RPCClientProtocolFactory {
+	f := &clientProtocolFactory{
+		maxMetadataSize: libsvc.DefaultMaxMetadataSize,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
-func (f serverProtocolFactory) Protocol() libsvc.RPCServerProtocol {
-	return &serverProtocol{}
+func (f *serverProtocolFactory) Protocol() libsvc.RPCServerProtocol {
+	return &serverProtocol{
+		factory: f,
+	}
 }
 
-func (f clientProtocolFactory) Protocol() libsvc.RPCClientProtocol {
-	return &clientProtocol{}
+// schema 返回入参类型的 JSON Schema
+func (f *serverProtocolFactory) schema(t reflect.Type) *jsonschema.Schema {
+	if s, ok := f.schemas.Load(t); ok {
+		return s.(*jsonschema.Schema)
+	}
+	s, _ := f.schemas.LoadOrStore(t, jsonschema.Reflect(t))
+	return s.(*jsonschema.Schema)
+}
+
+func (f *clientProtocolFactory) Protocol() libsvc.RPCClientProtocol {
+	return &clientProtocol{
+		maxMetadataSize: f.maxMetadataSize,
+	}
 }
 
 func (p *serverProtocol) writeErrorResponse(respWriter io.Writer, code int, message string, data interface{}) error {
+	return p.writeStreamErrorResponse(respWriter, &responseError{
+		Code:    opt.OInt(code),
+		Message: message,
+		Data:    data,
+	}, "")
+}
+
+func (p *serverProtocol) writeStreamErrorResponse(respWriter io.Writer, respErr *responseError, stream string) error {
+	if p.notification {
+		return nil
+	}
 	resp := response{
-		Error: &responseError{
-			Code:    opt.OInt(code),
-			Message: message,
-			Data:    data,
-		},
+		Error:  respErr,
+		Stream: stream,
 	}
 	if len(p.id) != 0 {
 		resp.ID = &p.id
@@ -89,8 +204,16 @@ func (p *serverProtocol) writeErrorResponse(respWriter io.Writer, code int, mess
 }
 
 func (p *serverProtocol) writeResponse(respWriter io.Writer, result interface{}) error {
+	return p.writeStreamResponse(respWriter, result, "")
+}
+
+func (p *serverProtocol) writeStreamResponse(respWriter io.Writer, result interface{}, stream string) error {
+	if p.notification {
+		return nil
+	}
 	resp := response{
 		Result: result,
+		Stream: stream,
 	}
 	if len(p.id) != 0 {
 		resp.ID = &p.id
@@ -117,16 +240,17 @@ func (p *serverProtocol) ProcessRequest(respWriter io.Writer, reqReader io.Reade
 
 	// 检查 ID
 	if len(id) == 0 {
-		// 缺 ID
-		return true, "", nil, p.writeErrorResponse(respWriter, codeInvalidReq, msgInvalidReq, missingID)
-	}
-	switch id[0] {
-	// ID 应该是字符串或者是数字，json 格式没问题，所以只需要检查第一个字符即可
-	case '"', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-	default:
-		return true, "", nil, p.writeErrorResponse(respWriter, codeInvalidReq, msgInvalidReq, badIDValue)
+		// 缺 ID 即为 notification，此后（包括出错时）都不再返回响应
+		p.notification = true
+	} else {
+		switch id[0] {
+		// ID 应该是字符串或者是数字，json 格式没问题，所以只需要检查第一个字符即可
+		case '"', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		default:
+			return true, "", nil, p.writeErrorResponse(respWriter, codeInvalidReq, msgInvalidReq, badIDValue)
+		}
+		p.id = id
 	}
-	p.id = id
 
 	// 检查 Params
 	if len(params) != 0 {
@@ -144,15 +268,87 @@ func (p *serverProtocol) ProcessRequest(respWriter io.Writer, reqReader io.Reade
 		return true, "", nil, p.writeErrorResponse(respWriter, codeInvalidReq, msgInvalidReq, missingMethod)
 	}
 
+	// 检查元数据
+	if libsvc.MetadataSize(req.Context) > p.factory.maxMetadataSize {
+		return true, "", nil, p.writeStreamErrorResponse(respWriter, outputError(libsvc.ErrMetadataTooLarge), "")
+	}
+
+	if req.Timeout > 0 {
+		p.timeout = time.Duration(req.Timeout) * time.Millisecond
+	}
+
 	return false, req.Method, req.Context, nil
 
 }
 
+func (p *serverProtocol) Timeout() time.Duration {
+	return p.timeout
+}
+
+func (p *serverProtocol) ProcessBatchRequest(respWriter io.Writer, req []byte) (done bool, subReqs [][]byte, err error) {
+	// 批量请求是一个 Array，只需要检查第一个非空白字符即可
+	if !isArray(req) {
+		return false, nil, nil
+	}
+
+	raws := []json.RawMessage{}
+	if err := json.Unmarshal(req, &raws); err != nil {
+		return true, nil, p.writeErrorResponse(respWriter, codeParseError, msgParseError, nil)
+	}
+	if len(raws) == 0 {
+		return true, nil, p.writeErrorResponse(respWriter, codeInvalidReq, msgInvalidReq, emptyBatch)
+	}
+
+	subReqs = make([][]byte, 0, len(raws))
+	for _, raw := range raws {
+		subReqs = append(subReqs, raw)
+	}
+	return false, subReqs, nil
+}
+
+func (p *serverProtocol) ProcessBatchResponse(respWriter io.Writer, subResps [][]byte) error {
+	buf := &bytes.Buffer{}
+	for _, subResp := range subResps {
+		// notification 没有响应
+		if len(subResp) == 0 {
+			continue
+		}
+		if buf.Len() == 0 {
+			buf.WriteByte('[')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.Write(subResp)
+	}
+	// 全部都是 notification 时不返回任何响应
+	if buf.Len() == 0 {
+		return nil
+	}
+	buf.WriteByte(']')
+	_, err := respWriter.Write(buf.Bytes())
+	return err
+}
+
 func (p *serverProtocol) ProcessMethodNotFound(respWriter io.Writer, methodName string) error {
 	return p.writeErrorResponse(respWriter, codeMethodNotFound, msgMethodNotFound, methodName)
 }
 
 func (p *serverProtocol) ProcessInput(respWriter io.Writer, input interface{}) (done bool, err error) {
+	// 校验入参
+	if p.factory.validateParams {
+		params := []byte(p.params)
+		if len(params) == 0 {
+			params = emptyParams
+		}
+		if err := p.factory.schema(reflect.TypeOf(input)).Validate(params); err != nil {
+			data := interface{}(err)
+			if _, ok := err.(jsonschema.ValidationErrors); !ok {
+				data = err.Error()
+			}
+			return true, p.writeErrorResponse(respWriter, codeInvalidParams, msgInvalidParams, data)
+		}
+	}
+
 	// 没有，跳过这步
 	if len(p.params) == 0 {
 		return false, nil
@@ -176,15 +372,46 @@ func (p *serverProtocol) ProcessOutput(respWriter io.Writer, output interface{},
 		// 没有错误
 		return p.writeResponse(respWriter, output)
 	}
-	// 若返回的 outputErr 可以被 json 序列化，则序列化之，否则序列化其 Error 字符串
-	data := interface{}(nil)
-	switch outputErr.(type) {
-	case json.Marshaler, easyjson.Marshaler:
-		data = outputErr
-	default:
-		data = outputErr.Error()
+	return p.writeStreamErrorResponse(respWriter, outputError(outputErr), "")
+}
+
+func (p *serverProtocol) ProcessStreamOutput(respWriter io.Writer, output interface{}) error {
+	return p.writeStreamResponse(respWriter, output, streamItem)
+}
+
+func (p *serverProtocol) ProcessStreamEnd(respWriter io.Writer, outputErr error) error {
+	if outputErr == nil {
+		return p.writeStreamResponse(respWriter, nil, streamEnd)
 	}
-	return p.writeErrorResponse(respWriter, codeGeneralError, msgGeneralError, data)
+	return p.writeStreamErrorResponse(respWriter, outputError(outputErr), streamEnd)
+}
+
+// outputError 将业务错误转换为 jsonrpc 错误，错误代码等见 libsvc.AsError；
+// 若 outputErr 不是 *libsvc.Error 但可以被 json 序列化，则序列化之作为 data
+func outputError(outputErr error) *responseError {
+	e := libsvc.AsError(outputErr)
+	data := e.Details
+	if data == nil && error(e) != outputErr {
+		switch outputErr.(type) {
+		case json.Marshaler, easyjson.Marshaler:
+			data = outputErr
+		}
+	}
+	return &responseError{
+		Code:      opt.OInt(e.Code),
+		Message:   e.Message,
+		Data:      data,
+		Temporary: e.Temporary,
+	}
+}
+
+func (p *clientProtocol) SetTimeout(timeout time.Duration) {
+	// 不足一毫秒的向上取整，以免变成没有超时
+	ms := int64((timeout + time.Millisecond - 1) / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	p.timeout = ms
 }
 
 func (p *clientProtocol) ProcessInput(reqWriter io.Writer, methodName string, input interface{}, passthru map[string]string) error {
@@ -193,13 +420,17 @@ func (p *clientProtocol) ProcessInput(reqWriter io.Writer, methodName string, in
 
 	// 装配 request 对象
 	req := request{
-		Method: methodName,
-		ID:     id,
+		Method:  methodName,
+		ID:      id,
+		Timeout: p.timeout,
 	}
 	if input != nil {
 		req.Params = input
 	}
 	if len(passthru) != 0 {
+		if libsvc.MetadataSize(passthru) > p.maxMetadataSize {
+			return libsvc.ErrMetadataTooLarge
+		}
 		req.Context = passthru
 	}
 
@@ -213,7 +444,157 @@ func (p *clientProtocol) ProcessInput(reqWriter io.Writer, methodName string, in
 	return nil
 }
 
+func (p *clientProtocol) ProcessNotification(reqWriter io.Writer, methodName string, input interface{}, passthru map[string]string) error {
+	// 不带 id 的请求
+	req := request{
+		Method: methodName,
+	}
+	if input != nil {
+		req.Params = input
+	}
+	if len(passthru) != 0 {
+		if libsvc.MetadataSize(passthru) > p.maxMetadataSize {
+			return libsvc.ErrMetadataTooLarge
+		}
+		req.Context = passthru
+	}
+
+	// 序列化请求
+	_, err := easyjson.MarshalToWriter(req, reqWriter)
+	return err
+}
+
+func (p *clientProtocol) ProcessBatchInput(reqWriter io.Writer, methodNames []string, inputs []interface{}, passthru map[string]string) error {
+	if libsvc.MetadataSize(passthru) > p.maxMetadataSize {
+		return libsvc.ErrMetadataTooLarge
+	}
+	buf := &bytes.Buffer{}
+	ids := make([]string, 0, len(methodNames))
+	buf.WriteByte('[')
+	for i, methodName := range methodNames {
+		id := xid.New().String()
+		req := request{
+			Method:  methodName,
+			ID:      id,
+			Timeout: p.timeout,
+		}
+		if inputs[i] != nil {
+			req.Params = inputs[i]
+		}
+		if len(passthru) != 0 {
+			req.Context = passthru
+		}
+
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		if _, err := easyjson.MarshalToWriter(req, buf); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	buf.WriteByte(']')
+
+	if _, err := reqWriter.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	// 记录下来
+	p.ids = ids
+	return nil
+}
+
+func (p *clientProtocol) ProcessBatchOutput(respReader io.Reader, outputs []interface{}) (errs []error, err error) {
+	data, err := ioutil.ReadAll(respReader)
+	if err != nil {
+		return nil, err
+	}
+
+	// 整个批量请求出错时服务端返回的是单个错误响应
+	if !isArray(data) {
+		if _, err := p.processOutput(bytes.NewBuffer(data), nil); err != nil && err != errIDMismatch {
+			return nil, err
+		}
+		return nil, errBadBatch
+	}
+
+	raws := []json.RawMessage{}
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, err
+	}
+
+	// 响应的顺序不一定跟请求相同，需要通过 id 对应
+	idx := make(map[string]int, len(p.ids))
+	for i, id := range p.ids {
+		idx[id] = i
+	}
+	errs = make([]error, len(outputs))
+	for i := range errs {
+		errs[i] = errNoResponse
+	}
+	for _, raw := range raws {
+		id := easyjson.RawMessage{}
+		result := easyjson.RawMessage{}
+		resp := response{
+			Result: &result,
+			Error: &responseError{
+				Data: &easyjson.RawMessage{},
+			},
+			ID: &id,
+		}
+		if err := easyjson.Unmarshal(raw, &resp); err != nil {
+			return nil, err
+		}
+
+		// NOTE: char set is 0-9, a-v，因此 json 序列化/反序列化时是不需要 escape 的
+		if len(id) < 2 || id[0] != '"' {
+			continue
+		}
+		i, ok := idx[string(id[1:len(id)-1])]
+		if !ok {
+			continue
+		}
+
+		if resp.Error.Code.IsDefined() {
+			errs[i] = resp.Error
+			continue
+		}
+		errs[i] = nil
+		if len(result) == 0 {
+			continue
+		}
+		switch o := outputs[i].(type) {
+		case easyjson.Unmarshaler:
+			errs[i] = easyjson.Unmarshal(result, o)
+		default:
+			errs[i] = json.Unmarshal(result, o)
+		}
+	}
+	return errs, nil
+}
+
 func (p *clientProtocol) ProcessOutput(respReader io.Reader, output interface{}) error {
+	_, err := p.processOutput(respReader, output)
+	return err
+}
+
+func (p *clientProtocol) ProcessStreamOutput(frameReader io.Reader, output interface{}) (end bool, err error) {
+	stream, err := p.processOutput(frameReader, output)
+	if err != nil {
+		return true, err
+	}
+	switch stream {
+	case streamItem:
+		return false, nil
+	case streamEnd:
+		return true, nil
+	default:
+		return true, errBadFrame
+	}
+}
+
+// processOutput 反序列化响应，返回其 stream 字段
+func (p *clientProtocol) processOutput(respReader io.Reader, output interface{}) (stream string, err error) {
 	// 反序列化响应
 	id := easyjson.RawMessage{}
 	resp := response{
@@ -226,17 +607,17 @@ func (p *clientProtocol) ProcessOutput(respReader io.Reader, output interface{})
 		ID: &id,
 	}
 	if err := unmarshalFromReader(respReader, &resp); err != nil {
-		return err
+		return "", err
 	}
 
 	// 判断是否有错误响应，有错误响应时无视 id 检查吧
 	if resp.Error.Code.IsDefined() {
-		return resp.Error
+		return resp.Stream, resp.Error
 	}
 
 	// 判断 id
 	if len(id) == 0 || id[0] != '"' {
-		return errIDMismatch
+		return "", errIDMismatch
 	}
 	// NOTE: char set is 0-9, a-v，因此 json 序列化/反序列化时是不需要 escape 的
 	id = id[1 : len(id)-1]
@@ -244,8 +625,14 @@ func (p *clientProtocol) ProcessOutput(respReader io.Reader, output interface{})
 	//   https://stackoverflow.com/a/35342389/157235
 	//   https://github.com/golang/go/commit/69cd91a5981c49eaaa59b33196bdb5586c18d289
 	if string(id) != p.id {
-		return errIDMismatch
+		return "", errIDMismatch
 	}
-	return nil
+	return resp.Stream, nil
+
+}
 
+// isArray 判断 json 数据是否是一个 Array，只检查第一个非空白字符
+func isArray(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) != 0 && data[0] == '['
 }
@@ -0,0 +1,175 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/stretchr/testify/assert"
+)
+
+type validateInput struct {
+	Name  string   `json:"name" jsonschema:"required"`
+	Tags  []string `json:"tags,omitempty"`
+	Count int      `json:"count,omitempty"`
+}
+
+func TestServerValidateParams(t *testing.T) {
+	a := assert.New(t)
+
+	for _, c := range []struct {
+		factory  libsvc.RPCServerProtocolFactory
+		req      string
+		expected string
+	}{
+		{
+			factory:  ServerProtocolFactory,
+			req:      `{"jsonrpc":"2.0","id":1,"method":"m","params":{"tags":"x"}}`,
+			expected: `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params","data":"json: cannot unmarshal string into Go struct field validateInput.tags of type []string"},"id":1}`,
+		},
+		{
+			factory:  NewServerProtocolFactory(OptValidateParams()),
+			req:      `{"jsonrpc":"2.0","id":1,"method":"m","params":{"tags":"x","count":1.5}}`,
+			expected: `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params","data":[{"path":"/name","message":"is required"},{"path":"/count","message":"expect integer but got number"},{"path":"/tags","message":"expect array or null but got string"}]},"id":1}`,
+		},
+		{
+			factory:  NewServerProtocolFactory(OptValidateParams()),
+			req:      `{"jsonrpc":"2.0","id":1,"method":"m"}`,
+			expected: `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params","data":[{"path":"/name","message":"is required"}]},"id":1}`,
+		},
+		{
+			factory:  NewServerProtocolFactory(OptValidateParams()),
+			req:      `{"jsonrpc":"2.0","id":1,"method":"m","params":{"name":"x","tags":null}}`,
+			expected: ``,
+		},
+	} {
+		p := c.factory.Protocol()
+		respWriter := &bytes.Buffer{}
+
+		done, methodName, _, err := p.ProcessRequest(respWriter, bytes.NewBufferString(c.req))
+		a.NoError(err)
+		a.False(done)
+		a.Equal("m", methodName)
+
+		input := &validateInput{}
+		done, err = p.ProcessInput(respWriter, input)
+		a.NoError(err)
+		if c.expected == "" {
+			a.False(done)
+			a.Equal(0, respWriter.Len())
+			continue
+		}
+		a.True(done)
+		a.JSONEq(c.expected, respWriter.String())
+	}
+}
+
+func TestNotification(t *testing.T) {
+	a := assert.New(t)
+
+	// 客户端请求不带 id
+	reqWriter := &bytes.Buffer{}
+	cp := ClientProtocolFactory.Protocol().(libsvc.RPCClientNotifyProtocol)
+	a.NoError(cp.ProcessNotification(reqWriter, "m", &validateInput{Name: "x"}, map[string]string{"k": "v"}))
+	a.JSONEq(`{"jsonrpc":"2.0","method":"m","params":{"name":"x"},"ctx":{"k":"v"}}`, reqWriter.String())
+
+	// 服务端不返回任何响应，包括错误
+	for _, c := range []struct {
+		req         string
+		methodFound bool
+	}{
+		{req: `{"jsonrpc":"2.0","method":"m","params":{"name":"x"}}`, methodFound: true},
+		{req: `{"jsonrpc":"2.0","method":"m","params":{"tags":"x"}}`, methodFound: true},
+		{req: `{"jsonrpc":"2.0","method":"m"}`, methodFound: false},
+	} {
+		p := ServerProtocolFactory.Protocol()
+		respWriter := &bytes.Buffer{}
+
+		done, methodName, _, err := p.ProcessRequest(respWriter, bytes.NewBufferString(c.req))
+		a.NoError(err)
+		a.False(done)
+		a.Equal("m", methodName)
+
+		if !c.methodFound {
+			a.NoError(p.ProcessMethodNotFound(respWriter, methodName))
+			a.Equal(0, respWriter.Len())
+			continue
+		}
+
+		input := &validateInput{}
+		done, err = p.ProcessInput(respWriter, input)
+		a.NoError(err)
+		if !done {
+			a.NoError(p.ProcessOutput(respWriter, input, nil))
+		}
+		a.Equal(0, respWriter.Len())
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	a := assert.New(t)
+
+	// 客户端
+	for _, c := range []struct {
+		timeout  time.Duration
+		expected int64
+	}{
+		{timeout: time.Second, expected: 1000},
+		{timeout: 1500 * time.Microsecond, expected: 2},
+		{timeout: -time.Second, expected: 1},
+	} {
+		cp := ClientProtocolFactory.Protocol()
+		cp.(libsvc.RPCClientTimeoutProtocol).SetTimeout(c.timeout)
+		reqWriter := &bytes.Buffer{}
+		a.NoError(cp.ProcessInput(reqWriter, "m", nil, nil))
+		req := request{}
+		a.NoError(req.UnmarshalJSON(reqWriter.Bytes()))
+		a.Equal(c.expected, req.Timeout)
+	}
+
+	// 服务端
+	for _, c := range []struct {
+		req      string
+		expected time.Duration
+	}{
+		{req: `{"jsonrpc":"2.0","id":1,"method":"m","timeout":1500}`, expected: 1500 * time.Millisecond},
+		{req: `{"jsonrpc":"2.0","id":1,"method":"m"}`, expected: 0},
+		{req: `{"jsonrpc":"2.0","id":1,"method":"m","timeout":-1}`, expected: 0},
+	} {
+		p := ServerProtocolFactory.Protocol()
+		_, _, _, err := p.ProcessRequest(&bytes.Buffer{}, bytes.NewBufferString(c.req))
+		a.NoError(err)
+		a.Equal(c.expected, p.(libsvc.RPCServerTimeoutProtocol).Timeout())
+	}
+}
+
+func TestMaxMetadataSize(t *testing.T) {
+	a := assert.New(t)
+
+	// 客户端
+	large := map[string]string{"k": strings.Repeat("v", libsvc.DefaultMaxMetadataSize)}
+	cp := ClientProtocolFactory.Protocol()
+	a.Equal(libsvc.ErrMetadataTooLarge, cp.ProcessInput(&bytes.Buffer{}, "m", nil, large))
+	a.Equal(libsvc.ErrMetadataTooLarge, cp.(libsvc.RPCClientBatchProtocol).ProcessBatchInput(&bytes.Buffer{}, []string{"m"}, []interface{}{nil}, large))
+
+	cp = NewClientProtocolFactory(OptClientMaxMetadataSize(4)).Protocol()
+	a.Equal(libsvc.ErrMetadataTooLarge, cp.ProcessInput(&bytes.Buffer{}, "m", nil, map[string]string{"k": "vvvv"}))
+	a.Equal(libsvc.ErrMetadataTooLarge, cp.(libsvc.RPCClientNotifyProtocol).ProcessNotification(&bytes.Buffer{}, "m", nil, map[string]string{"k": "vvvv"}))
+	a.NoError(cp.ProcessInput(&bytes.Buffer{}, "m", nil, map[string]string{"k": "vvv"}))
+
+	// 服务端
+	p := NewServerProtocolFactory(OptMaxMetadataSize(4)).Protocol()
+	respWriter := &bytes.Buffer{}
+	done, _, _, err := p.ProcessRequest(respWriter, bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"m","ctx":{"k":"vvvv"}}`))
+	a.NoError(err)
+	a.True(done)
+	a.JSONEq(`{"jsonrpc":"2.0","error":{"code":-32003,"message":"Metadata too large"},"id":1}`, respWriter.String())
+
+	p = NewServerProtocolFactory(OptMaxMetadataSize(4)).Protocol()
+	done, _, passthru, err := p.ProcessRequest(&bytes.Buffer{}, bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"m","ctx":{"k":"vvv"}}`))
+	a.NoError(err)
+	a.False(done)
+	a.Equal(map[string]string{"k": "vvv"}, passthru)
+}
@@ -0,0 +1,535 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	libsvc "github.com/huangjunwen/platform-kit/svc"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// memTransport 是一个进程内的传输层，用于测试
+type memTransport struct {
+	mu       sync.RWMutex
+	handlers map[string]libsvc.RPCTransportHandler
+	// notification 处理完后的响应数据
+	notified chan []byte
+	// 流没有结束就被关闭（即需要通知服务端取消）的次数
+	canceled int32
+}
+
+type memRequestor struct {
+	transport *memTransport
+	svcName   string
+}
+
+// memRespWriter 支持流式响应
+type memRespWriter struct {
+	bytes.Buffer
+	frames chan memFrame
+}
+
+// memFrame 为流式响应的一帧，end 表示为结束帧
+type memFrame struct {
+	data []byte
+	end  bool
+}
+
+type memStream struct {
+	ctx       context.Context
+	transport *memTransport
+	frames    chan memFrame
+	end       bool
+}
+
+var (
+	_ libsvc.RPCTransportServer          = (*memTransport)(nil)
+	_ libsvc.RPCTransportClient          = (*memTransport)(nil)
+	_ libsvc.RPCTransportStreamRequestor = (*memRequestor)(nil)
+	_ libsvc.RPCTransportNotifier        = (*memRequestor)(nil)
+	_ libsvc.RPCTransportStreamWriter    = (*memRespWriter)(nil)
+	_ libsvc.RPCTransportStream          = (*memStream)(nil)
+)
+
+func newMemTransport() *memTransport {
+	return &memTransport{
+		handlers: make(map[string]libsvc.RPCTransportHandler),
+		notified: make(chan []byte, 16),
+	}
+}
+
+func (t *memTransport) Register(svcName string, handler libsvc.RPCTransportHandler) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.handlers[svcName] != nil {
+		return libsvc.ErrSvcNameConflict
+	}
+	t.handlers[svcName] = handler
+	return nil
+}
+
+func (t *memTransport) Deregister(svcName string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.handlers, svcName)
+	return nil
+}
+
+func (t *memTransport) Close() {}
+
+func (t *memTransport) Discover(ctx context.Context, svcName string) (libsvc.RPCTransportRequestor, error) {
+	return &memRequestor{transport: t, svcName: svcName}, nil
+}
+
+func (t *memTransport) handler(svcName string) (libsvc.RPCTransportHandler, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	handler := t.handlers[svcName]
+	if handler == nil {
+		return nil, libsvc.ErrSvcNotFound
+	}
+	return handler, nil
+}
+
+func (r *memRequestor) Invoke(ctx context.Context, writeReq func(io.Writer) error) (io.Reader, error) {
+	handler, err := r.transport.handler(r.svcName)
+	if err != nil {
+		return nil, err
+	}
+	reqWriter := &bytes.Buffer{}
+	if err := writeReq(reqWriter); err != nil {
+		return nil, err
+	}
+	respWriter := &bytes.Buffer{}
+	if err := handler.Invoke(context.Background(), reqWriter, respWriter); err != nil {
+		return nil, err
+	}
+	return respWriter, nil
+}
+
+func (r *memRequestor) Notify(ctx context.Context, writeReq func(io.Writer) error) error {
+	handler, err := r.transport.handler(r.svcName)
+	if err != nil {
+		return err
+	}
+	reqWriter := &bytes.Buffer{}
+	if err := writeReq(reqWriter); err != nil {
+		return err
+	}
+	go func() {
+		respWriter := &bytes.Buffer{}
+		handler.Invoke(context.Background(), reqWriter, respWriter)
+		r.transport.notified <- respWriter.Bytes()
+	}()
+	return nil
+}
+
+func (r *memRequestor) InvokeStream(ctx context.Context, writeReq func(io.Writer) error) (libsvc.RPCTransportStream, error) {
+	handler, err := r.transport.handler(r.svcName)
+	if err != nil {
+		return nil, err
+	}
+	reqWriter := &bytes.Buffer{}
+	if err := writeReq(reqWriter); err != nil {
+		return nil, err
+	}
+	respWriter := &memRespWriter{frames: make(chan memFrame, 1024)}
+	go func() {
+		handler.Invoke(context.Background(), reqWriter, respWriter)
+		// 没有 Flush 的数据（例如流的结束）放在结束帧中
+		respWriter.frames <- memFrame{data: append([]byte(nil), respWriter.Bytes()...), end: true}
+	}()
+	return &memStream{ctx: ctx, transport: r.transport, frames: respWriter.frames}, nil
+}
+
+func (w *memRespWriter) Flush() error {
+	w.frames <- memFrame{data: append([]byte(nil), w.Bytes()...)}
+	w.Reset()
+	return nil
+}
+
+func (s *memStream) Next() (io.Reader, error) {
+	if s.end {
+		return nil, io.EOF
+	}
+	select {
+	case frame := <-s.frames:
+		if frame.end {
+			s.end = true
+			if len(frame.data) == 0 {
+				return nil, io.EOF
+			}
+		}
+		return bytes.NewBuffer(frame.data), nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func (s *memStream) Close() {
+	if !s.end {
+		atomic.AddInt32(&s.transport.canceled, 1)
+	}
+}
+
+type echoMsg struct {
+	Msg string `json:"msg"`
+}
+
+var (
+	echoMethod   = libsvc.NewTypedMethod[echoMsg, echoMsg]("echo")
+	repeatMethod = libsvc.NewTypedStreamMethod[echoMsg, echoMsg]("repeat")
+	errRepeat    = errors.New("repeat error")
+)
+
+func newTestService(svcName string) libsvc.ServiceWithInterface {
+	return libsvc.NewLocalService(
+		svcName,
+		echoMethod, echoMethod.Handler(func(_ context.Context, input, output *echoMsg) error {
+			*output = *input
+			return nil
+		}),
+		repeatMethod, repeatMethod.Handler(func(_ context.Context, input *echoMsg, send func(*echoMsg) error) error {
+			for _, c := range input.Msg {
+				if c == '!' {
+					return errRepeat
+				}
+				if err := send(&echoMsg{Msg: string(c)}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+}
+
+func newTestClient(t *testing.T, svcName string) libsvc.Service {
+	svc, _ := newTestClientTransport(t, svcName)
+	return svc
+}
+
+func newTestClientTransport(t *testing.T, svcName string) (libsvc.Service, *memTransport) {
+	transport := newMemTransport()
+	server := libsvc.NewRPCServer(ServerProtocolFactory, transport)
+	assert.NoError(t, server.Register(newTestService(svcName)))
+	return libsvc.NewRPCClient(ClientProtocolFactory, transport).Make(svcName), transport
+}
+
+func TestRPCInvoke(t *testing.T) {
+	a := assert.New(t)
+	svc := newTestClient(t, "test.echo")
+
+	output, err := echoMethod.Invoke(context.Background(), svc, &echoMsg{Msg: "hello"})
+	a.NoError(err)
+	a.Equal("hello", output.Msg)
+}
+
+func TestRPCStream(t *testing.T) {
+	a := assert.New(t)
+	svc, transport := newTestClientTransport(t, "test.echo")
+	ctx := context.Background()
+
+	// 正常结束
+	stream, err := repeatMethod.Invoke(ctx, svc, &echoMsg{Msg: "abc"})
+	a.NoError(err)
+	msgs := ""
+	for {
+		output, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		a.NoError(err)
+		msgs += output.Msg
+	}
+	a.Equal("abc", msgs)
+	_, err = stream.Recv()
+	a.Equal(io.EOF, err)
+	stream.Close()
+
+	// 异常结束
+	stream, err = repeatMethod.Invoke(ctx, svc, &echoMsg{Msg: "a!"})
+	a.NoError(err)
+	output, err := stream.Recv()
+	a.NoError(err)
+	a.Equal("a", output.Msg)
+	_, err = stream.Recv()
+	if a.Implements((*ResponseError)(nil), err) {
+		a.Equal(libsvc.CodeUnknown, err.(ResponseError).ErrCode())
+		a.Equal("repeat error", err.(ResponseError).ErrMessage())
+	}
+
+	// 流开始前的错误
+	stream, err = libsvc.NewTypedStreamMethod[echoMsg, echoMsg]("missing").Invoke(ctx, svc, &echoMsg{})
+	a.NoError(err)
+	_, err = stream.Recv()
+	if a.Implements((*ResponseError)(nil), err) {
+		a.Equal(libsvc.CodeMethodNotFound, err.(ResponseError).ErrCode())
+	}
+
+	// 以上的流都正常结束了，不需要通知服务端取消
+	a.Equal(int32(0), atomic.LoadInt32(&transport.canceled))
+
+	// 提前取消
+	cctx, cancel := context.WithCancel(ctx)
+	stream, err = repeatMethod.Invoke(cctx, svc, &echoMsg{Msg: "abc"})
+	a.NoError(err)
+	cancel()
+	_, err = stream.Recv()
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	a.Equal(context.Canceled, err)
+	stream.Close()
+}
+
+func TestRPCNotify(t *testing.T) {
+	a := assert.New(t)
+	svc, transport := newTestClientTransport(t, "test.echo")
+	ctx := context.Background()
+
+	// 正常调用以及找不到方法时都没有响应
+	a.NoError(echoMethod.Notify(ctx, svc, &echoMsg{Msg: "hello"}))
+	a.Len(<-transport.notified, 0)
+	a.NoError(libsvc.Notify(ctx, svc, libsvc.NewTypedMethod[echoMsg, echoMsg]("notExists"), &echoMsg{}))
+	a.Len(<-transport.notified, 0)
+
+	// 找不到服务
+	a.Equal(libsvc.ErrSvcNotFound, echoMethod.Notify(ctx, libsvc.NewRPCClient(ClientProtocolFactory, transport).Make("test.notExists"), &echoMsg{}))
+}
+
+func TestRPCBatch(t *testing.T) {
+	a := assert.New(t)
+	svc, transport := newTestClientTransport(t, "test.echo")
+	ctx := context.Background()
+
+	calls := []*libsvc.BatchCall{}
+	for _, msg := range []string{"a", "b", "c"} {
+		calls = append(calls, &libsvc.BatchCall{
+			Service: svc,
+			Method:  echoMethod,
+			Input:   &echoMsg{Msg: msg},
+			Output:  &echoMsg{},
+		})
+	}
+	notFound := libsvc.NewTypedMethod[echoMsg, echoMsg]("notExists")
+	calls = append(calls, &libsvc.BatchCall{
+		Service: svc,
+		Method:  notFound,
+		Input:   &echoMsg{},
+		Output:  &echoMsg{},
+	})
+
+	err := libsvc.InvokeBatch(ctx, calls...)
+	a.Equal(calls[3].Err, err)
+	for i, msg := range []string{"a", "b", "c"} {
+		a.NoError(calls[i].Err)
+		a.Equal(msg, calls[i].Output.(*echoMsg).Msg)
+	}
+	if a.Implements((*ResponseError)(nil), calls[3].Err) {
+		a.Equal(codeMethodNotFound, calls[3].Err.(ResponseError).ErrCode())
+	}
+
+	// 服务端
+	handler, err := transport.handler("test.echo")
+	a.NoError(err)
+	for _, c := range []struct {
+		req      string
+		expected string
+	}{
+		{
+			req:      `[{"jsonrpc":"2.0","id":1,"method":"echo","params":{"msg":"x"}},{"jsonrpc":"2.0","method":"echo"},{"jsonrpc":"2.0","id":2,"method":"repeat"}]`,
+			expected: `[{"jsonrpc":"2.0","result":{"msg":"x"},"id":1},{"jsonrpc":"2.0","error":{"code":-32001,"message":"Stream not supported"},"id":2}]`,
+		},
+		{
+			req:      `[{"jsonrpc":"2.0","method":"echo"}]`,
+			expected: ``,
+		},
+		{
+			req:      `[]`,
+			expected: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid request","data":"Empty batch"},"id":null}`,
+		},
+		{
+			req:      `[{]`,
+			expected: `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`,
+		},
+	} {
+		respWriter := &bytes.Buffer{}
+		a.NoError(handler.Invoke(ctx, bytes.NewBufferString(c.req), respWriter))
+		if c.expected == "" {
+			a.Equal(0, respWriter.Len())
+			continue
+		}
+		a.JSONEq(c.expected, respWriter.String())
+	}
+}
+
+var (
+	failMethod        = libsvc.NewTypedMethod[echoMsg, echoMsg]("fail")
+	errTestRegistered = errors.New("registered")
+)
+
+func init() {
+	libsvc.RegisterError(1000, errTestRegistered)
+}
+
+func TestRPCError(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	local := libsvc.NewLocalService(
+		"test.fail",
+		failMethod, failMethod.Handler(func(_ context.Context, input *echoMsg, _ *echoMsg) error {
+			switch input.Msg {
+			case "registered":
+				return fmt.Errorf("wrapped: %w", errTestRegistered)
+			case "structured":
+				return &libsvc.Error{Code: 1001, Message: "structured", Details: []int{1, 2}, Temporary: true}
+			default:
+				return errors.New(input.Msg)
+			}
+		}),
+	)
+	transport := newMemTransport()
+	a.NoError(libsvc.NewRPCServer(ServerProtocolFactory, transport).Register(local))
+	remote := libsvc.NewRPCClient(ClientProtocolFactory, transport).Make("test.fail")
+
+	// 远程调用跟本地调用的错误判断方式相同
+	for _, svc := range []libsvc.Service{local, remote} {
+		_, err := failMethod.Invoke(ctx, svc, &echoMsg{Msg: "registered"})
+		a.True(errors.Is(err, errTestRegistered))
+		a.Equal(1000, libsvc.AsError(err).Code)
+		a.Equal("wrapped: registered", libsvc.AsError(err).Message)
+		a.False(libsvc.IsTemporary(err))
+
+		_, err = failMethod.Invoke(ctx, svc, &echoMsg{Msg: "structured"})
+		e := libsvc.AsError(err)
+		a.Equal(1001, e.Code)
+		a.Equal("structured", e.Message)
+		a.True(libsvc.IsTemporary(err))
+		details, _ := json.Marshal(e.Details)
+		a.JSONEq(`[1,2]`, string(details))
+
+		_, err = failMethod.Invoke(ctx, svc, &echoMsg{Msg: "other"})
+		a.Equal(libsvc.CodeUnknown, libsvc.AsError(err).Code)
+		a.Equal("other", err.Error())
+
+		_, err = libsvc.NewTypedMethod[echoMsg, echoMsg]("notExists").Invoke(ctx, svc, &echoMsg{})
+		a.True(errors.Is(err, libsvc.ErrMethodNotFound))
+		a.Equal(libsvc.CodeMethodNotFound, libsvc.AsError(err).Code)
+	}
+}
+
+func TestRPCTimeout(t *testing.T) {
+	a := assert.New(t)
+
+	type deadlineOutput struct {
+		HasDeadline bool          `json:"hasDeadline"`
+		Remaining   time.Duration `json:"remaining"`
+	}
+	deadlineMethod := libsvc.NewTypedMethod[struct{}, deadlineOutput]("deadline")
+	transport := newMemTransport()
+	a.NoError(libsvc.NewRPCServer(ServerProtocolFactory, transport).Register(libsvc.NewLocalService(
+		"test.deadline",
+		deadlineMethod, deadlineMethod.Handler(func(ctx context.Context, _ *struct{}, output *deadlineOutput) error {
+			deadline, ok := ctx.Deadline()
+			output.HasDeadline = ok
+			output.Remaining = time.Until(deadline)
+			return nil
+		}),
+	)))
+	svc := libsvc.NewRPCClient(ClientProtocolFactory, transport).Make("test.deadline")
+
+	// 没有 deadline
+	output, err := deadlineMethod.Invoke(context.Background(), svc, &struct{}{})
+	a.NoError(err)
+	a.False(output.HasDeadline)
+
+	// deadline 传到服务端
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	output, err = deadlineMethod.Invoke(ctx, svc, &struct{}{})
+	a.NoError(err)
+	a.True(output.HasDeadline)
+	a.True(output.Remaining > 0 && output.Remaining <= time.Minute)
+
+	// 已经结束的 ctx 不会发出请求
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = deadlineMethod.Invoke(ctx, svc, &struct{}{})
+	a.Equal(context.Canceled, err)
+}
+
+func TestRPCMetadata(t *testing.T) {
+	a := assert.New(t)
+
+	mdMethod := libsvc.NewTypedMethod[struct{}, map[string]string]("metadata")
+	transport := newMemTransport()
+	a.NoError(libsvc.NewRPCServer(ServerProtocolFactory, transport).Register(libsvc.NewLocalService(
+		"test.metadata",
+		mdMethod, mdMethod.Handler(func(ctx context.Context, _ *struct{}, output *map[string]string) error {
+			*output = libsvc.IncomingMetadata(ctx)
+			return nil
+		}),
+	)))
+	svc := libsvc.NewRPCClient(ClientProtocolFactory, transport).Make("test.metadata")
+
+	ctx := libsvc.WithOutgoingMetadata(context.Background(), map[string]string{"a": "1"})
+	output, err := mdMethod.Invoke(ctx, svc, &struct{}{})
+	a.NoError(err)
+	a.Equal(map[string]string{"a": "1"}, *output)
+}
+
+func TestRPCPanic(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	panicMethod := libsvc.NewTypedMethod[echoMsg, echoMsg]("panic")
+	panicStreamMethod := libsvc.NewTypedStreamMethod[echoMsg, echoMsg]("panicStream")
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf)
+	transport := newMemTransport()
+	a.NoError(libsvc.NewRPCServer(ServerProtocolFactory, transport, libsvc.OptLogger(&logger)).Register(libsvc.NewLocalService(
+		"test.panic",
+		panicMethod, panicMethod.Handler(func(context.Context, *echoMsg, *echoMsg) error {
+			panic("boom")
+		}),
+		panicStreamMethod, panicStreamMethod.Handler(func(_ context.Context, _ *echoMsg, send func(*echoMsg) error) error {
+			send(&echoMsg{Msg: "a"})
+			panic("stream boom")
+		}),
+	)))
+	svc := libsvc.NewRPCClient(ClientProtocolFactory, transport).Make("test.panic")
+
+	// panic 转换为 internal error，细节不传给客户端而是记录到日志中
+	_, err := panicMethod.Invoke(ctx, svc, &echoMsg{})
+	a.True(errors.Is(err, libsvc.ErrInternal))
+	a.Equal(libsvc.ErrInternal.Error(), err.Error())
+	a.Contains(buf.String(), `"comp":"svc.rpc_server"`)
+	a.Contains(buf.String(), `"method":"panic"`)
+	a.Contains(buf.String(), `"panic":"boom"`)
+	a.Contains(buf.String(), `"stack":`)
+
+	// 流式方法
+	buf.Reset()
+	stream, err := panicStreamMethod.Invoke(ctx, svc, &echoMsg{})
+	a.NoError(err)
+	output, err := stream.Recv()
+	a.NoError(err)
+	a.Equal("a", output.Msg)
+	_, err = stream.Recv()
+	a.True(errors.Is(err, libsvc.ErrInternal))
+	a.Contains(buf.String(), `"panic":"stream boom"`)
+
+	// 服务仍然可用
+	_, err = panicMethod.Invoke(ctx, svc, &echoMsg{})
+	a.True(errors.Is(err, libsvc.ErrInternal))
+}
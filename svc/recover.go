@@ -0,0 +1,94 @@
+package libsvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// PanicError 是 panic 所转换成的错误，errors.Is(err, ErrInternal) 成立
+type PanicError struct {
+	// Value 为 recover 的返回值
+	Value interface{}
+
+	// Stack 为 panic 时的调用栈
+	Stack []byte
+}
+
+// Recover 调用 fn，若 fn panic 则将其转换为 *PanicError 返回
+func Recover(fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{
+				Value: v,
+				Stack: debug.Stack(),
+			}
+		}
+	}()
+	return fn()
+}
+
+// Error 实现 error 接口
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Is 用于 errors.Is
+func (e *PanicError) Is(target error) bool {
+	return target == ErrInternal
+}
+
+// OptLogger 设置 RPC 服务端的 logger，用于记录处理器的 panic（包括调用栈）；默认使用 PanicLogger(ctx)
+func OptLogger(logger *zerolog.Logger) RPCServerOption {
+	return func(server *rpcServer) {
+		l := logger.With().Str("comp", "svc.rpc_server").Logger()
+		server.logger = &l
+	}
+}
+
+// recover 需要被 defer 调用：若有 panic 则记录日志并将 *err 设为 ErrInternal
+func (server *rpcServer) recover(ctx context.Context, svcName string, err *error) {
+	if v := recover(); v != nil {
+		*err = server.internalErr(ctx, svcName, "", &PanicError{
+			Value: v,
+			Stack: debug.Stack(),
+		})
+	}
+}
+
+// internalErr 若 err 是 *PanicError 则记录日志并返回 ErrInternal（不将 panic 的细节传给客户端），否则原样返回
+func (server *rpcServer) internalErr(ctx context.Context, svcName, methodName string, err error) error {
+	pe := (*PanicError)(nil)
+	if !errors.As(err, &pe) {
+		return err
+	}
+	logger := server.logger
+	if logger == nil {
+		logger = PanicLogger(ctx)
+	}
+	LogPanic(logger, svcName, methodName, pe)
+	return ErrInternal
+}
+
+// PanicLogger 返回用于记录 panic 的 logger：ctx 中的 logger（见 zerolog.Ctx），没有（或被禁用）时使用全局的 log.Logger，
+// 以免 panic 被悄悄地吞掉，例如传输层以 context.Background() 处理请求时
+func PanicLogger(ctx context.Context) *zerolog.Logger {
+	if logger := zerolog.Ctx(ctx); logger.GetLevel() != zerolog.Disabled {
+		return logger
+	}
+	return &log.Logger
+}
+
+// LogPanic 记录处理器的 panic（包括调用栈）
+func LogPanic(logger *zerolog.Logger, svcName, methodName string, pe *PanicError) {
+	logger.Error().
+		Str("svc", svcName).
+		Str("method", methodName).
+		Str("panic", fmt.Sprint(pe.Value)).
+		Bytes("stack", pe.Stack).
+		Msg("")
+}
@@ -1,15 +1,26 @@
 package libsvc
 
 import (
+	"bytes"
 	"context"
 	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
 )
 
 type rpcServer struct {
-	protocol  RPCServerProtocolFactory
-	transport RPCTransportServer
+	protocol         RPCServerProtocolFactory
+	transport        RPCTransportServer
+	batchConcurrency int
+	logger           *zerolog.Logger
 }
 
+// RPCServerOption 是创建 RPC 服务端时的选项
+type RPCServerOption func(*rpcServer)
+
 type rpcClient struct {
 	protocol  RPCClientProtocolFactory
 	transport RPCTransportClient
@@ -26,56 +37,153 @@ var (
 	_ Service       = (*rpcClientService)(nil)
 )
 
+var (
+	// DefaultBatchConcurrency 为批量请求中子请求的默认最大并发数
+	DefaultBatchConcurrency = 8
+)
+
+// OptBatchConcurrency 设置批量请求中子请求的最大并发数，默认为 DefaultBatchConcurrency
+func OptBatchConcurrency(n int) RPCServerOption {
+	return func(server *rpcServer) {
+		if n < 1 {
+			n = 1
+		}
+		server.batchConcurrency = n
+	}
+}
+
 // NewRPCServer 创建一个 RPC 服务端，在此注册的服务可以被对应的 RPCClient 访问
-func NewRPCServer(protocol RPCServerProtocolFactory, transport RPCTransportServer) ServiceServer {
-	return &rpcServer{
-		protocol:  protocol,
-		transport: transport,
+func NewRPCServer(protocol RPCServerProtocolFactory, transport RPCTransportServer, opts ...RPCServerOption) ServiceServer {
+	server := &rpcServer{
+		protocol:         protocol,
+		transport:        transport,
+		batchConcurrency: DefaultBatchConcurrency,
 	}
+	for _, opt := range opts {
+		opt(server)
+	}
+	return server
 }
 
 func (server *rpcServer) Register(svc ServiceWithInterface) error {
 	itf := svc.Interface()
 	return server.transport.Register(
 		svc.Name(),
-		RPCTransportHandlerFunc(func(ctx context.Context, reqReader io.Reader, respWriter io.Writer) error {
+		RPCTransportHandlerFunc(func(ctx context.Context, reqReader io.Reader, respWriter io.Writer) (err error) {
+			// 一个有问题的请求不应令整个进程崩溃
+			defer server.recover(ctx, svc.Name(), &err)
 			protocol := server.protocol.Protocol()
 
-			// 解析出方法名和 passthru
-			done, methodName, passthru, err := protocol.ProcessRequest(respWriter, reqReader)
-			if err != nil || done {
-				return err
+			// 批量请求
+			if batchProtocol, ok := protocol.(RPCServerBatchProtocol); ok {
+				req, err := ioutil.ReadAll(reqReader)
+				if err != nil {
+					return err
+				}
+				done, subReqs, err := batchProtocol.ProcessBatchRequest(respWriter, req)
+				if err != nil || done {
+					return err
+				}
+				if subReqs != nil {
+					return server.handleBatch(ctx, svc, itf, batchProtocol, subReqs, respWriter)
+				}
+				reqReader = bytes.NewBuffer(req)
 			}
 
-			// 查找方法
-			method := itf.MethodByName(methodName)
+			return server.handle(ctx, svc, itf, protocol, reqReader, respWriter)
 
-			// 找不到
-			if method == nil {
-				return protocol.ProcessMethodNotFound(respWriter, methodName)
-			}
+		}),
+	)
 
-			// 生成出入参
-			input := method.GenInput()
-			output := method.GenOutput()
+}
 
-			// 处理入参
-			done, err = protocol.ProcessInput(respWriter, input)
-			if err != nil || done {
-				return err
-			}
+// handle 处理单个 RPC 请求
+func (server *rpcServer) handle(ctx context.Context, svc ServiceWithInterface, itf Interface, protocol RPCServerProtocol,
+	reqReader io.Reader, respWriter io.Writer) error {
 
-			// 执行
-			if len(passthru) != 0 {
-				ctx = WithPassthru(ctx, passthru)
-			}
-			outputErr := svc.Invoke(ctx, method, input, output)
+	// 解析出方法名和 passthru
+	done, methodName, passthru, err := protocol.ProcessRequest(respWriter, reqReader)
+	if err != nil || done {
+		return err
+	}
 
-			// 处理出参
-			return protocol.ProcessOutput(respWriter, output, outputErr)
+	// 客户端传来的超时
+	if tp, ok := protocol.(RPCServerTimeoutProtocol); ok {
+		if timeout := tp.Timeout(); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+	}
 
-		}),
-	)
+	// 查找方法
+	method := itf.MethodByName(methodName)
+
+	// 找不到
+	if method == nil {
+		return protocol.ProcessMethodNotFound(respWriter, methodName)
+	}
+
+	// 生成出入参
+	input := method.GenInput()
+	output := method.GenOutput()
+
+	// 处理入参
+	done, err = protocol.ProcessInput(respWriter, input)
+	if err != nil || done {
+		return err
+	}
+
+	// 执行
+	if len(passthru) != 0 {
+		ctx = WithIncomingMetadata(ctx, passthru)
+	}
+	if IsStreamMethod(method) {
+		return server.invokeStream(ctx, svc, method.(StreamMethod), input, protocol, respWriter)
+	}
+	outputErr := server.internalErr(ctx, svc.Name(), methodName, Recover(func() error {
+		return svc.Invoke(ctx, method, input, output)
+	}))
+
+	// 处理出参
+	return protocol.ProcessOutput(respWriter, output, outputErr)
+
+}
+
+// handleBatch 并发地处理批量请求中的各个子请求，并发数由 OptBatchConcurrency 限制
+func (server *rpcServer) handleBatch(ctx context.Context, svc ServiceWithInterface, itf Interface, protocol RPCServerBatchProtocol,
+	subReqs [][]byte, respWriter io.Writer) error {
+
+	subResps := make([][]byte, len(subReqs))
+	errs := make([]error, len(subReqs))
+	sem := make(chan struct{}, server.batchConcurrency)
+	wg := &sync.WaitGroup{}
+	for i, subReq := range subReqs {
+		i, subReq := i, subReq
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			defer server.recover(ctx, svc.Name(), &errs[i])
+			subRespWriter := &bytes.Buffer{}
+			errs[i] = server.handle(ctx, svc, itf, server.protocol.Protocol(), bytes.NewBuffer(subReq), subRespWriter)
+			subResps[i] = subRespWriter.Bytes()
+		}()
+	}
+	wg.Wait()
+
+	if err := protocol.ProcessBatchResponse(respWriter, subResps); err != nil {
+		return err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 
 }
 
@@ -110,8 +218,16 @@ func (svc *rpcClientService) Invoke(ctx context.Context, method Method, input, o
 	method.AssertInputType(input)
 	method.AssertOutputType(output)
 
+	// 单向调用
+	if IsNotification(ctx) {
+		return svc.notify(ctx, method, input)
+	}
+
 	client := svc.client
 	protocol := client.protocol.Protocol()
+	if err := setTimeout(ctx, protocol); err != nil {
+		return err
+	}
 
 	// 发现服务
 	requestor, err := client.transport.Discover(ctx, svc.name)
@@ -132,3 +248,18 @@ func (svc *rpcClientService) Invoke(ctx context.Context, method Method, input, o
 	return protocol.ProcessOutput(respReader, output)
 
 }
+
+// setTimeout 将 ctx 的剩余时间告知协议，若 ctx 已经结束则直接返回其错误
+func setTimeout(ctx context.Context, protocol RPCClientProtocol) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tp, ok := protocol.(RPCClientTimeoutProtocol)
+	if !ok {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		tp.SetTimeout(time.Until(deadline))
+	}
+	return nil
+}
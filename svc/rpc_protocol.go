@@ -2,6 +2,7 @@ package libsvc
 
 import (
 	"io"
+	"time"
 )
 
 // RPCServerProtocolFactory 代表 RPC 服务端协议工厂，主要负责传输层面数据与方法层面对象之间的转换；
@@ -41,6 +42,17 @@ type RPCServerProtocol interface {
 	ProcessOutput(respWriter io.Writer, output interface{}, outputErr error) (err error)
 }
 
+// RPCServerStreamProtocol 可以由 RPCServerProtocol 实现以支持流式方法：在 ProcessInput 之后，
+// 每个出参调用一次 ProcessStreamOutput，最后调用一次 ProcessStreamEnd；每次调用后写入的数据作为一帧发送，
+// 最后一帧跟传输层的结束通知一起发送
+type RPCServerStreamProtocol interface {
+	// ProcessStreamOutput 处理流式方法的一个出参
+	ProcessStreamOutput(respWriter io.Writer, output interface{}) (err error)
+
+	// ProcessStreamEnd 处理流的结束，outputErr 非空时表示流异常结束；该步骤完成后流程结束
+	ProcessStreamEnd(respWriter io.Writer, outputErr error) (err error)
+}
+
 // RPCClientProtocol 代表客户端协议
 type RPCClientProtocol interface {
 	// ProcessInput 在开始 rpc 请求时触发，RPCClientProtocol 应当序列化请求，
@@ -51,3 +63,60 @@ type RPCClientProtocol interface {
 	// 返回错误
 	ProcessOutput(respReader io.Reader, output interface{}) error
 }
+
+// RPCClientStreamProtocol 可以由 RPCClientProtocol 实现以支持流式方法：请求同样由 ProcessInput 序列化，
+// 响应的每一帧由 ProcessStreamOutput 处理
+type RPCClientStreamProtocol interface {
+	RPCClientProtocol
+
+	// ProcessStreamOutput 处理流式响应的一帧：若是一个出参则反序列化到 output 中并返回 end 为 false；
+	// 若是流的结束则返回 end 为 true，此时 err 为流的错误（若有）
+	ProcessStreamOutput(frameReader io.Reader, output interface{}) (end bool, err error)
+}
+
+// RPCClientBatchProtocol 可以由 RPCClientProtocol 实现以支持在一个请求中调用多个方法
+type RPCClientBatchProtocol interface {
+	RPCClientProtocol
+
+	// ProcessBatchInput 序列化批量请求，methodNames 与 inputs 一一对应，其它同 ProcessInput
+	ProcessBatchInput(reqWriter io.Writer, methodNames []string, inputs []interface{}, passthru map[string]string) error
+
+	// ProcessBatchOutput 反序列化批量响应到 outputs 中（与请求一一对应），errs 为各个调用的错误；
+	// err 不为 nil 时表示整个批量请求失败
+	ProcessBatchOutput(respReader io.Reader, outputs []interface{}) (errs []error, err error)
+}
+
+// RPCClientNotifyProtocol 可以由 RPCClientProtocol 实现以支持 notification（即单向调用）：
+// 请求由 ProcessNotification 序列化，服务端不会返回任何响应
+type RPCClientNotifyProtocol interface {
+	RPCClientProtocol
+
+	// ProcessNotification 序列化 notification 请求，参数同 ProcessInput
+	ProcessNotification(reqWriter io.Writer, methodName string, input interface{}, passthru map[string]string) error
+}
+
+// RPCServerBatchProtocol 可以由 RPCServerProtocol 实现以支持批量请求：rpcServer 会将批量请求拆分为多个子请求，
+// 每个子请求使用一个新的协议对象按正常步骤（并发地）处理，最后将各个子请求的响应合并
+type RPCServerBatchProtocol interface {
+	// ProcessBatchRequest 在 ProcessRequest 之前触发，req 为完整的请求数据；若是批量请求则返回拆分后的
+	// 各个子请求，若 subReqs 为 nil 则按正常步骤继续处理该请求；done/err 的含义同 RPCServerProtocol
+	ProcessBatchRequest(respWriter io.Writer, req []byte) (done bool, subReqs [][]byte, err error)
+
+	// ProcessBatchResponse 在所有子请求处理完后触发，subResps 为各个子请求的响应数据（不需要响应时为空），
+	// 协议应当将它们合并写入 respWriter；该步骤完成后流程结束
+	ProcessBatchResponse(respWriter io.Writer, subResps [][]byte) (err error)
+}
+
+// RPCServerTimeoutProtocol 可以由 RPCServerProtocol 实现以支持客户端传来的超时：
+// rpcServer 以此设置处理请求时 ctx 的 deadline，使得超时可以跨越多次调用
+type RPCServerTimeoutProtocol interface {
+	// Timeout 在 ProcessRequest 之后触发，返回请求所携带的调用剩余时间，没有时返回 0
+	Timeout() time.Duration
+}
+
+// RPCClientTimeoutProtocol 可以由 RPCClientProtocol 实现以将调用的剩余时间传到服务端；
+// 使用剩余时间而非绝对的 deadline 是为了避免两端时钟不一致
+type RPCClientTimeoutProtocol interface {
+	// SetTimeout 在 ProcessInput（或 ProcessBatchInput）之前触发，仅当调用的 ctx 有 deadline 时
+	SetTimeout(timeout time.Duration)
+}
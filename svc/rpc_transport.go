@@ -46,3 +46,34 @@ type RPCTransportRequestor interface {
 	// Invoke 发送请求并等待响应，调用者应该提供一个 writeReq 函数用于写入请求
 	Invoke(ctx context.Context, writeReq func(reqWriter io.Writer) error) (respReader io.Reader, err error)
 }
+
+// RPCTransportStreamWriter 可以由 RPCTransportServer 传给处理器的 respWriter 实现以支持流式响应：
+// 每次调用 Flush 时，自上次 Flush 以来写入的数据作为一帧发送；处理器返回后传输层应当将
+// 未 Flush 的数据（例如流的结束）作为最后一帧，连同流已结束的通知一起发送
+type RPCTransportStreamWriter interface {
+	io.Writer
+
+	// Flush 将已写入的数据作为一帧发送
+	Flush() error
+}
+
+// RPCTransportStreamRequestor 可以由 RPCTransportRequestor 实现以支持流式响应
+type RPCTransportStreamRequestor interface {
+	// InvokeStream 发送请求，返回的 RPCTransportStream 用于依次接收响应的各帧
+	InvokeStream(ctx context.Context, writeReq func(reqWriter io.Writer) error) (RPCTransportStream, error)
+}
+
+// RPCTransportStream 代表流式响应
+type RPCTransportStream interface {
+	// Next 返回下一帧数据，服务端通知流结束后返回 io.EOF
+	Next() (frameReader io.Reader, err error)
+
+	// Close 释放资源
+	Close()
+}
+
+// RPCTransportNotifier 可以由 RPCTransportRequestor 实现以支持 notification：只发送请求而不等待响应
+type RPCTransportNotifier interface {
+	// Notify 发送请求后马上返回
+	Notify(ctx context.Context, writeReq func(reqWriter io.Writer) error) error
+}
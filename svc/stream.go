@@ -0,0 +1,416 @@
+package libsvc
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// StreamMethod 定义一个服务端流式方法：单入参，多个出参（每个出参的类型都跟 GenOutput 生成的相同）
+type StreamMethod interface {
+	Method
+
+	// IsStream 用于区分普通的方法，总是返回 true
+	IsStream() bool
+}
+
+// StreamHandler 是流式方法的处理器，通过 send 依次发送出参，返回时流结束；
+// 若 send 返回错误（例如客户端已取消），处理器应当尽快返回
+type StreamHandler interface {
+	InvokeStream(ctx context.Context, input interface{}, send func(output interface{}) error) error
+}
+
+// StreamHandlerFunc 适配 StreamHandler
+type StreamHandlerFunc func(context.Context, interface{}, func(interface{}) error) error
+
+// StreamService 代表一个支持流式方法的服务
+type StreamService interface {
+	Service
+
+	// InvokeStream 调用服务的一个流式方法，input 必须满足 method 定义的类型，否则应当 panic；
+	// 取消 ctx 会终止流
+	InvokeStream(ctx context.Context, method StreamMethod, input interface{}) (OutputStream, error)
+}
+
+// OutputStream 用于依次接收流式方法的出参
+type OutputStream interface {
+	// Recv 接收下一个出参，流正常结束时返回 io.EOF，其它错误表示流异常结束
+	Recv() (output interface{}, err error)
+
+	// Close 提前终止流并释放资源，在 Recv 返回错误后调用也是安全的
+	Close()
+}
+
+type streamMethod struct {
+	*defaultMethod
+}
+
+// StreamOutput 是流式方法的调用经过中间件（见 DecorateService）时传给中间件的出参：中间件链的最内层在流开始后
+// 通过它依次发送流的各个出参，因此中间件作用于整个流（例如计时，限制并发）；中间件一般不需要关心它，
+// 需要读写出参的中间件（例如重试，缓存）应当跳过流式方法
+type StreamOutput struct {
+	once   sync.Once
+	opened chan struct{}
+	send   func(interface{}) error
+}
+
+// chanStream 是基于 channel 的 OutputStream，由一个 goroutine 运行处理器产生出参
+type chanStream struct {
+	ch     chan interface{}
+	cancel context.CancelFunc
+	// 在 ch 关闭前设置
+	err error
+}
+
+var (
+	_ StreamMethod  = (*streamMethod)(nil)
+	_ OutputStream  = (*chanStream)(nil)
+	_ StreamService = (*localService)(nil)
+	_ StreamService = (*inprocClientService)(nil)
+	_ StreamService = (*inprocFirstClientService)(nil)
+	_ StreamService = (*boundService)(nil)
+	_ StreamService = (*decSvc)(nil)
+	_ StreamService = (*decSvcWithItf)(nil)
+	_ StreamService = (*rpcClientService)(nil)
+)
+
+// NewStreamMethod 定义一个新的流式方法，参数要求同 NewMethod
+func NewStreamMethod(methodName string, inFactory, outFactory func() interface{}) StreamMethod {
+	return &streamMethod{
+		defaultMethod: NewMethod(methodName, inFactory, outFactory).(*defaultMethod),
+	}
+}
+
+// IsStreamMethod 判断方法是否是流式方法
+func IsStreamMethod(method Method) bool {
+	sm, ok := method.(StreamMethod)
+	return ok && sm.IsStream()
+}
+
+// InvokeStream 调用服务 svc 的一个流式方法，若 svc 不支持流式方法则返回 ErrStreamUnsupported
+func InvokeStream(ctx context.Context, svc Service, method StreamMethod, input interface{}) (OutputStream, error) {
+	s, ok := svc.(StreamService)
+	if !ok {
+		return nil, ErrStreamUnsupported
+	}
+	return s.InvokeStream(ctx, method, input)
+}
+
+func (m *streamMethod) IsStream() bool {
+	return true
+}
+
+func (m *streamMethod) HasMethod(method Method) bool {
+	return Method(m) == method
+}
+
+func (m *streamMethod) MethodByName(methodName string) Method {
+	if methodName == m.name {
+		return m
+	}
+	return nil
+}
+
+func (m *streamMethod) Methods() []Method {
+	return []Method{m}
+}
+
+// InvokeStream 实现 StreamHandler 接口
+func (fn StreamHandlerFunc) InvokeStream(ctx context.Context, input interface{}, send func(interface{}) error) error {
+	return fn(ctx, input, send)
+}
+
+// newChanStream 在一个新的 goroutine 中运行 run，run 通过 send 发送的出参可以从返回的 OutputStream 中接收
+func newChanStream(ctx context.Context, run func(ctx context.Context, send func(interface{}) error) error) OutputStream {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &chanStream{
+		ch:     make(chan interface{}),
+		cancel: cancel,
+	}
+	go func() {
+		defer close(s.ch)
+		// run 在单独的 goroutine 中运行，panic 无法被调用者捕获，因此转换为流的错误
+		s.err = Recover(func() error {
+			return run(ctx, func(output interface{}) error {
+				select {
+				case s.ch <- output:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		})
+	}()
+	return s
+}
+
+func (s *chanStream) Recv() (interface{}, error) {
+	output, ok := <-s.ch
+	if ok {
+		return output, nil
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return nil, io.EOF
+}
+
+func (s *chanStream) Close() {
+	s.cancel()
+}
+
+func (svc *localService) InvokeStream(ctx context.Context, method StreamMethod, input interface{}) (OutputStream, error) {
+	// 查找方法
+	handler := svc.streamHandlers[method]
+	if handler == nil {
+		return nil, ErrMethodNotFound
+	}
+
+	// 对入参进行类型检查
+	method.AssertInputType(input)
+
+	return newChanStream(ctx, func(ctx context.Context, send func(interface{}) error) error {
+		return handler.InvokeStream(ctx, input, func(output interface{}) error {
+			method.AssertOutputType(output)
+			return send(output)
+		})
+	}), nil
+}
+
+func (svc *inprocClientService) InvokeStream(ctx context.Context, method StreamMethod, input interface{}) (OutputStream, error) {
+	inproc.mu.RLock()
+	s := inproc.svcs[svc.name]
+	inproc.mu.RUnlock()
+
+	if s == nil {
+		return nil, ErrSvcNotFound
+	}
+	return InvokeStream(withNextHopMetadata(ctx), s, method, input)
+}
+
+func (svc *inprocFirstClientService) InvokeStream(ctx context.Context, method StreamMethod, input interface{}) (OutputStream, error) {
+	inproc.mu.RLock()
+	s := inproc.svcs[svc.name]
+	inproc.mu.RUnlock()
+
+	if s == nil {
+		return InvokeStream(ctx, svc.alt, method, input)
+	}
+	return InvokeStream(withNextHopMetadata(ctx), s, method, input)
+}
+
+func (svc *boundService) InvokeStream(ctx context.Context, method StreamMethod, input interface{}) (OutputStream, error) {
+	return InvokeStream(ctx, svc.Service, method, input)
+}
+
+// InvokeStream 实现 StreamService 接口，调用经过中间件，见 StreamOutput
+func (svc *decSvc) InvokeStream(ctx context.Context, method StreamMethod, input interface{}) (OutputStream, error) {
+	return invokeStreamThrough(context.WithValue(ctx, svcNameKey, svc.svc.Name()), svc.h, method, input)
+}
+
+// InvokeStream 实现 StreamService 接口，调用经过中间件，见 StreamOutput
+func (svc *decSvcWithItf) InvokeStream(ctx context.Context, method StreamMethod, input interface{}) (OutputStream, error) {
+	return invokeStreamThrough(context.WithValue(ctx, svcNameKey, svc.svc.Name()), svc.h, method, input)
+}
+
+// Send 发送流的一个出参
+func (o *StreamOutput) Send(output interface{}) error {
+	o.open()
+	return o.send(output)
+}
+
+// open 标记流已开始
+func (o *StreamOutput) open() {
+	o.once.Do(func() {
+		close(o.opened)
+	})
+}
+
+// invokeStream 调用被装饰的服务的流式方法并通过 so 依次转发其出参
+func (t *terminal) invokeStream(ctx context.Context, method StreamMethod, input interface{}, so *StreamOutput) error {
+	stream, err := InvokeStream(ctx, t.svc, method, input)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	so.open()
+	for {
+		output, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := so.send(output); err != nil {
+			return err
+		}
+	}
+}
+
+// invokeStreamThrough 通过中间件链 h 调用流式方法，整个流都在 h 中进行；流开始前的错误（例如被中间件拒绝）直接返回
+func invokeStreamThrough(ctx context.Context, h ServiceHandler, method StreamMethod, input interface{}) (OutputStream, error) {
+	so := &StreamOutput{
+		opened: make(chan struct{}),
+	}
+	ended := make(chan struct{})
+	s := newChanStream(ctx, func(ctx context.Context, send func(interface{}) error) error {
+		defer close(ended)
+		so.send = send
+		return h(ctx, method, input, so)
+	})
+
+	select {
+	case <-so.opened:
+		return s, nil
+	case <-ended:
+	}
+	select {
+	case <-so.opened:
+		return s, nil
+	default:
+	}
+
+	// 流没有开始就结束了
+	if _, err := s.Recv(); err != io.EOF {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// rpcOutputStream 是 RPC 客户端的 OutputStream
+type rpcOutputStream struct {
+	method    StreamMethod
+	protocol  RPCClientStreamProtocol
+	transport RPCTransportStream
+
+	mu  sync.Mutex
+	err error // 流结束后不为空
+}
+
+func (s *rpcOutputStream) Recv() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	end, output, err := s.recv()
+	if !end {
+		return output, nil
+	}
+
+	// 流结束
+	if err == nil {
+		err = io.EOF
+	}
+	s.err = err
+	s.transport.Close()
+	return nil, err
+}
+
+func (s *rpcOutputStream) recv() (end bool, output interface{}, err error) {
+	frameReader, err := s.transport.Next()
+	if err != nil {
+		if err == io.EOF {
+			// 传输层结束了，协议层却还没有结束
+			err = io.ErrUnexpectedEOF
+		}
+		return true, nil, err
+	}
+	output = s.method.GenOutput()
+	end, err = s.protocol.ProcessStreamOutput(frameReader, output)
+	if end {
+		return true, nil, err
+	}
+	return false, output, nil
+}
+
+func (s *rpcOutputStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err == nil {
+		s.err = io.EOF
+		s.transport.Close()
+	}
+}
+
+func (svc *rpcClientService) InvokeStream(ctx context.Context, method StreamMethod, input interface{}) (OutputStream, error) {
+	// 首先检查一下 input type
+	method.AssertInputType(input)
+
+	client := svc.client
+	protocol, ok := client.protocol.Protocol().(RPCClientStreamProtocol)
+	if !ok {
+		return nil, ErrStreamUnsupported
+	}
+	if err := setTimeout(ctx, protocol); err != nil {
+		return nil, err
+	}
+
+	// 发现服务
+	requestor, err := client.transport.Discover(ctx, svc.name)
+	if err != nil {
+		return nil, err
+	}
+	streamRequestor, ok := requestor.(RPCTransportStreamRequestor)
+	if !ok {
+		return nil, ErrStreamUnsupported
+	}
+
+	// 远程调用
+	stream, err := streamRequestor.InvokeStream(ctx, func(reqWriter io.Writer) error {
+		// 入参 -> RPC 请求
+		return protocol.ProcessInput(reqWriter, method.Name(), input, Passthru(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpcOutputStream{
+		method:    method,
+		protocol:  protocol,
+		transport: stream,
+	}, nil
+}
+
+// invokeStream 处理流式方法的 RPC 请求
+func (server *rpcServer) invokeStream(ctx context.Context, svc ServiceWithInterface, method StreamMethod, input interface{},
+	protocol RPCServerProtocol, respWriter io.Writer) error {
+
+	streamProtocol, ok1 := protocol.(RPCServerStreamProtocol)
+	streamWriter, ok2 := respWriter.(RPCTransportStreamWriter)
+	if !ok1 || !ok2 {
+		return protocol.ProcessOutput(respWriter, nil, ErrStreamUnsupported)
+	}
+
+	// NOTE: 流的结束不需要 Flush，传输层会将其跟结束通知一起发送，
+	// 这样客户端收到流的结束时传输层也已经结束了，关闭时不需要通知服务端取消
+	stream, err := InvokeStream(ctx, svc, method, input)
+	if err != nil {
+		err = server.internalErr(ctx, svc.Name(), method.Name(), err)
+		return streamProtocol.ProcessStreamEnd(respWriter, err)
+	}
+	defer stream.Close()
+
+	for {
+		output, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			err = server.internalErr(ctx, svc.Name(), method.Name(), err)
+			return streamProtocol.ProcessStreamEnd(respWriter, err)
+		}
+		if err := streamProtocol.ProcessStreamOutput(respWriter, output); err != nil {
+			return err
+		}
+		if err := streamWriter.Flush(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package libsvc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countInput struct {
+	N int
+}
+
+type countOutput struct {
+	I int
+}
+
+var (
+	countMethod = NewTypedStreamMethod[countInput, countOutput]("count")
+	countErr    = errors.New("count error")
+)
+
+func countHandler(ctx context.Context, input *countInput, send func(*countOutput) error) error {
+	for i := 0; i < input.N; i++ {
+		if err := send(&countOutput{I: i}); err != nil {
+			return err
+		}
+	}
+	if input.N < 0 {
+		return countErr
+	}
+	return nil
+}
+
+func TestStreamMethod(t *testing.T) {
+	a := assert.New(t)
+
+	a.True(IsStreamMethod(countMethod))
+	a.False(IsStreamMethod(noopMethod))
+	a.True(IsStreamMethod(NewStreamMethod("s", func() interface{} { return &struct{}{} }, func() interface{} { return &struct{}{} })))
+	a.True(NewInterface(countMethod).HasMethod(countMethod))
+
+	a.Panics(func() {
+		NewLocalService("bad.pair", countMethod, MethodHandlerFunc(func(context.Context, interface{}, interface{}) error { return nil }))
+	}, "Expect panic since stream method paired with non stream handler")
+
+	a.Panics(func() {
+		NewLocalService("bad.pair", noopMethod, countMethod.Handler(countHandler))
+	}, "Expect panic since method paired with stream handler")
+
+	svc := NewLocalService("stream.svc", countMethod, countMethod.Handler(countHandler))
+	a.NoError(InprocServer().Register(svc))
+	defer InprocServer().Deregister(svc.Name())
+
+	ctx := context.Background()
+	client := InprocClient().Make("stream.svc")
+
+	// 正常结束
+	{
+		stream, err := countMethod.Invoke(ctx, client, &countInput{N: 3})
+		a.NoError(err)
+		for i := 0; i < 3; i++ {
+			output, err := stream.Recv()
+			a.NoError(err)
+			a.Equal(i, output.I)
+		}
+		_, err = stream.Recv()
+		a.Equal(io.EOF, err)
+		stream.Close()
+	}
+
+	// 异常结束
+	{
+		stream, err := countMethod.Invoke(ctx, client, &countInput{N: -1})
+		a.NoError(err)
+		_, err = stream.Recv()
+		a.Equal(countErr, err)
+	}
+
+	// 提前取消
+	{
+		cctx, cancel := context.WithCancel(ctx)
+		stream, err := countMethod.Invoke(cctx, client, &countInput{N: 1000})
+		a.NoError(err)
+		_, err = stream.Recv()
+		a.NoError(err)
+		cancel()
+		for err == nil {
+			_, err = stream.Recv()
+		}
+		a.Equal(context.Canceled, err)
+	}
+
+	// 普通调用流式方法
+	a.Equal(ErrMethodNotFound, svc.Invoke(ctx, countMethod, &countInput{}, &countOutput{}))
+
+	// 不支持流式方法的服务
+	_, err := countMethod.Invoke(ctx, &struct{ Service }{client}, &countInput{N: 1})
+	a.Equal(ErrStreamUnsupported, err)
+
+	_, err = countMethod.Invoke(ctx, InprocClient().Make("stream.svc.not.exists"), &countInput{N: 1})
+	a.Equal(ErrSvcNotFound, err)
+}
+
+func TestStreamMiddleware(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	svc := NewLocalService("stream.mw.svc", countMethod, countMethod.Handler(countHandler))
+
+	errDenied := errors.New("denied")
+	calls := []string{}
+	mw := func(h ServiceHandler) ServiceHandler {
+		return func(ctx context.Context, method Method, input, output interface{}) error {
+			if input.(*countInput).N == 0 {
+				return errDenied
+			}
+			calls = append(calls, "begin:"+ServiceName(ctx)+"."+method.Name())
+			_, isStream := output.(*StreamOutput)
+			a.True(isStream)
+			err := h(ctx, method, input, output)
+			calls = append(calls, "end")
+			return err
+		}
+	}
+
+	for _, dec := range []StreamService{
+		DecorateService(svc, mw).(StreamService),
+		DecorateServiceWithInterface(svc, mw).(StreamService),
+	} {
+		calls = calls[:0]
+
+		// 中间件覆盖整个流
+		stream, err := countMethod.Invoke(ctx, dec, &countInput{N: 2})
+		a.NoError(err)
+		for i := 0; i < 2; i++ {
+			output, err := stream.Recv()
+			a.NoError(err)
+			a.Equal(i, output.I)
+		}
+		_, err = stream.Recv()
+		a.Equal(io.EOF, err)
+		a.Equal([]string{"begin:stream.mw.svc.count", "end"}, calls)
+
+		// 流开始前被中间件拒绝
+		_, err = countMethod.Invoke(ctx, dec, &countInput{N: 0})
+		a.Equal(errDenied, err)
+
+		// 流开始前的错误
+		_, err = InvokeStream(ctx, dec, NewTypedStreamMethod[countInput, countOutput]("other"), &countInput{N: 1})
+		a.Equal(ErrMethodNotFound, err)
+
+		// 异常结束
+		stream, err = countMethod.Invoke(ctx, dec, &countInput{N: -1})
+		a.NoError(err)
+		_, err = stream.Recv()
+		a.Equal(countErr, err)
+	}
+}
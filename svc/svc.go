@@ -2,6 +2,7 @@ package libsvc
 
 import (
 	"context"
+	"reflect"
 	"regexp"
 )
 
@@ -51,9 +52,10 @@ type boundService struct {
 }
 
 type localService struct {
-	name     string
-	methods  map[string]Method
-	handlers map[Method]MethodHandler
+	name           string
+	methods        map[string]Method
+	handlers       map[Method]MethodHandler
+	streamHandlers map[Method]StreamHandler
 }
 
 var (
@@ -85,14 +87,16 @@ func (svc *boundService) Interface() Interface {
 
 // NewLocalService 新建一个本地服务，methodAndHandlers 应当为一系列 Method 和 MethodHandler/MethodHandlerFunc 对：
 //   Method1, Handler1, Method2, Handler2, ...
+// 其中流式方法 StreamMethod 对应的则是 StreamHandler/StreamHandlerFunc
 func NewLocalService(svcName string, methodAndHandlers ...interface{}) ServiceWithInterface {
 	if !IsValidServiceName(svcName) {
 		panic(ErrBadSvcName)
 	}
 	svc := &localService{
-		name:     svcName,
-		methods:  make(map[string]Method),
-		handlers: make(map[Method]MethodHandler),
+		name:           svcName,
+		methods:        make(map[string]Method),
+		handlers:       make(map[Method]MethodHandler),
+		streamHandlers: make(map[Method]StreamHandler),
 	}
 	// 应当偶数个
 	if len(methodAndHandlers)&1 == 1 {
@@ -109,6 +113,21 @@ func NewLocalService(svcName string, methodAndHandlers ...interface{}) ServiceWi
 		if method, ok = methodAndHandlers[i].(Method); !ok {
 			panic(ErrMethodHandlerPair)
 		}
+		// 流式方法
+		if IsStreamMethod(method) {
+			var streamHandler StreamHandler
+			switch h := methodAndHandlers[i+1].(type) {
+			case func(context.Context, interface{}, func(interface{}) error) error:
+				streamHandler = StreamHandlerFunc(h)
+			case StreamHandler:
+				streamHandler = h
+			default:
+				panic(ErrMethodHandlerPair)
+			}
+			svc.methods[method.Name()] = method
+			svc.streamHandlers[method] = streamHandler
+			continue
+		}
 		// 检查 handler
 		switch h := methodAndHandlers[i+1].(type) {
 		case func(context.Context, interface{}, interface{}) error:
@@ -125,6 +144,81 @@ func NewLocalService(svcName string, methodAndHandlers ...interface{}) ServiceWi
 	return svc
 }
 
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// NewStructService 新建一个本地服务，impl 须为结构体或结构体指针，它所有形如
+//
+//	func(ctx context.Context, input *In, output *Out) error
+//
+// 的导出方法都会成为服务的方法，方法名即 go 中的方法名；其它导出方法会被忽略
+func NewStructService(svcName string, impl interface{}) ServiceWithInterface {
+	if !IsValidServiceName(svcName) {
+		panic(ErrBadSvcName)
+	}
+	v := reflect.ValueOf(impl)
+	if !v.IsValid() {
+		panic(ErrNotStruct)
+	}
+	t := v.Type()
+	if !(t.Kind() == reflect.Struct || (t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct && !v.IsNil())) {
+		panic(ErrNotStruct)
+	}
+
+	svc := &localService{
+		name:           svcName,
+		methods:        make(map[string]Method),
+		handlers:       make(map[Method]MethodHandler),
+		streamHandlers: make(map[Method]StreamHandler),
+	}
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		// NOTE: reflect.Value.Method 的方法不包括接收者，所以这里用 fn.Type()
+		fn := v.Method(i)
+		inType, outType, ok := structMethodTypes(fn.Type())
+		if !ok {
+			continue
+		}
+
+		method := NewMethod(
+			m.Name,
+			func() interface{} { return reflect.New(inType).Interface() },
+			func() interface{} { return reflect.New(outType).Interface() },
+		)
+		svc.methods[method.Name()] = method
+		svc.handlers[method] = MethodHandlerFunc(func(ctx context.Context, input, output interface{}) error {
+			ret := fn.Call([]reflect.Value{
+				reflect.ValueOf(&ctx).Elem(),
+				reflect.ValueOf(input),
+				reflect.ValueOf(output),
+			})
+			err, _ := ret[0].Interface().(error)
+			return err
+		})
+	}
+
+	if len(svc.methods) == 0 {
+		panic(ErrNoMethod)
+	}
+	return svc
+}
+
+// structMethodTypes 检查方法签名是否为 func(context.Context, *In, *Out) error，是的话返回 In 和 Out
+func structMethodTypes(fnType reflect.Type) (inType, outType reflect.Type, ok bool) {
+	if fnType.NumIn() != 3 || fnType.NumOut() != 1 || fnType.IsVariadic() {
+		return nil, nil, false
+	}
+	if fnType.In(0) != contextType || fnType.Out(0) != errorType {
+		return nil, nil, false
+	}
+	if fnType.In(1).Kind() != reflect.Ptr || fnType.In(2).Kind() != reflect.Ptr {
+		return nil, nil, false
+	}
+	return fnType.In(1).Elem(), fnType.In(2).Elem(), true
+}
+
 func (svc *localService) Name() string {
 	return svc.name
 }
@@ -141,7 +235,7 @@ func (svc *localService) Invoke(ctx context.Context, method Method, input, outpu
 	method.AssertOutputType(output)
 
 	// 执行 handler
-	return handler.Invoke(ctx, input, output)
+	return handler.Invoke(withoutNotification(ctx), input, output)
 
 }
 
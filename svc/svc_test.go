@@ -53,3 +53,72 @@ func TestLocalService(t *testing.T) {
 	}, "Expect panic since input does not match method's")
 
 }
+
+type structSvcInput struct {
+	X int
+}
+
+type structSvcOutput struct {
+	Y int
+}
+
+type structSvc struct {
+	delta int
+}
+
+func (s *structSvc) Incr(_ context.Context, input *structSvcInput, output *structSvcOutput) error {
+	output.Y = input.X + s.delta
+	return nil
+}
+
+func (s *structSvc) Fail(_ context.Context, input *structSvcInput, output *structSvcOutput) error {
+	return ErrMethodNotFound
+}
+
+func (s *structSvc) NotAMethod(input *structSvcInput, output *structSvcOutput) error {
+	return nil
+}
+
+func (s *structSvc) NotAMethodEither(_ context.Context, input structSvcInput, output *structSvcOutput) error {
+	return nil
+}
+
+func TestStructService(t *testing.T) {
+	a := assert.New(t)
+
+	a.Panics(func() {
+		NewStructService("bad.service.name.*", &structSvc{})
+	}, "Expect panic since bad service name calling NewStructService")
+
+	a.Panics(func() {
+		NewStructService("not.struct", 1)
+	}, "Expect panic since impl is not a struct")
+
+	a.Panics(func() {
+		NewStructService("nil.ptr", (*structSvc)(nil))
+	}, "Expect panic since impl is a nil pointer")
+
+	a.Panics(func() {
+		NewStructService("no.method", structSvc{})
+	}, "Expect panic since methods are defined on pointer receiver")
+
+	svc := NewStructService("struct.svc", &structSvc{delta: 10})
+	itf := svc.Interface()
+	a.Len(itf.Methods(), 2)
+	a.Nil(itf.MethodByName("NotAMethod"))
+	a.Nil(itf.MethodByName("NotAMethodEither"))
+
+	incr := itf.MethodByName("Incr")
+	a.NotNil(incr)
+	output := incr.GenOutput()
+	a.NoError(svc.Invoke(context.Background(), incr, &structSvcInput{X: 1}, output))
+	a.Equal(&structSvcOutput{Y: 11}, output)
+
+	fail := itf.MethodByName("Fail")
+	a.NotNil(fail)
+	a.Equal(ErrMethodNotFound, svc.Invoke(context.Background(), fail, fail.GenInput(), fail.GenOutput()))
+
+	a.Panics(func() {
+		svc.Invoke(context.Background(), incr, &structSvcOutput{}, &structSvcOutput{})
+	}, "Expect panic since input does not match method's")
+}
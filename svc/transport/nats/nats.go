@@ -3,36 +3,128 @@ package natstransport
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"io"
 	"math/rand"
+	"strconv"
+	"strings"
 	"sync"
 
 	libsvc "github.com/huangjunwen/platform-kit/svc"
 	"github.com/nats-io/go-nats"
 )
 
+// ServerOption 是创建 RPCTransportServer 时的选项
+type ServerOption func(*natsServer)
+
 type natsServer struct {
 	errHandler func(error)
 	mu         sync.Mutex
 	conns      []*nats.Conn
 	// svc name -> 在各个连接上的订阅
 	subs map[string][]*nats.Subscription
+
+	inflightMu sync.Mutex
+	// 处理中的请求：reply subject -> cancel
+	inflight map[string]context.CancelFunc
+
+	// 限制同时处理的请求数，为 nil 时不限制
+	sem chan struct{}
 }
 
 type natsClient struct {
-	mu    sync.RWMutex
-	conns []*nats.Conn
+	mu sync.RWMutex
+	// 每个 nats.Conn 一个
+	muxes []*respMux
 }
 
 type natsRequestor struct {
-	conn    *nats.Conn
+	mux     *respMux
 	svcName string
 }
 
+// respMux 在一个 nats.Conn 上使用一个通配订阅（前缀加 ">"）接收所有请求的回复：
+// 每个请求的 reply subject 为前缀加上该请求的 token，回复按 token 分发给各个请求
+type respMux struct {
+	conn   *nats.Conn
+	prefix string
+
+	mu sync.Mutex
+	// 第一个请求时才订阅
+	sub    *nats.Subscription
+	closed bool
+	// 用于生成 token
+	next uint64
+	// token -> 请求
+	calls map[string]*respCall
+}
+
+// respCall 接收一个请求的回复
+type respCall struct {
+	msgs chan *nats.Msg
+	// msgs 被关闭的原因
+	err error
+}
+
+// natsCall 代表一个发出去的请求
+type natsCall struct {
+	mux     *respMux
+	svcName string
+	token   string
+	reply   string
+	resp    *respCall
+}
+
+// respWriter 是服务端传给处理器的 respWriter，处理器返回后需要 Close
+type respWriter interface {
+	io.Writer
+	Close() error
+}
+
+// natsRespWriter 是服务端的 respWriter，处理器返回后将响应一次过发送
+type natsRespWriter struct {
+	bytes.Buffer
+	conn  *nats.Conn
+	reply string
+}
+
+// natsStreamWriter 是流式请求（reply subject 以 streamReplySuffix 结尾）的 respWriter：
+// 每一帧都以一个字节的帧类型以及 4 个字节的序号（大端）开头，处理器返回后发送结束帧，
+// 结束帧带有未 Flush 的数据（例如流开始前的错误响应）
+type natsStreamWriter struct {
+	natsRespWriter
+	seq uint32
+}
+
+// natsStream 是客户端接收流式响应的 RPCTransportStream
+type natsStream struct {
+	ctx  context.Context
+	call *natsCall
+	// 期望的下一帧的序号
+	seq uint32
+	end bool
+}
+
 const (
-	subjectPrefix = "svc."
-	group         = "svc"
+	subjectPrefix       = "svc."
+	cancelSubjectPrefix = "svc_cancel."
+	group               = "svc"
+)
+
+const (
+	// 流式响应的帧类型
+	frameData byte = '+'
+	frameEnd  byte = '.'
+
+	// 帧头的大小：帧类型 + 序号
+	frameHeaderSize = 5
+
+	// 流式请求的 reply subject 的后缀，服务端据此使用流式响应
+	streamReplySuffix = ".stream"
+
+	// 流式请求缓冲的帧数，接收太慢以致缓冲满了时流会以 errFrameGap 结束
+	streamBufferSize = 1024
 )
 
 var (
@@ -40,10 +132,30 @@ var (
 	errConnNil      = errors.New("nats.Conn is nil")
 	errServerClosed = errors.New("Server has closed")
 	errClientClosed = errors.New("Client has closed")
+	errBadFrame     = errors.New("Bad stream frame")
+	errFrameGap     = errors.New("Stream frame lost")
+)
+
+var (
+	_ libsvc.RPCTransportStreamWriter    = (*natsStreamWriter)(nil)
+	_ libsvc.RPCTransportStreamRequestor = (*natsRequestor)(nil)
+	_ libsvc.RPCTransportStream          = (*natsStream)(nil)
+	_ libsvc.RPCTransportNotifier        = (*natsRequestor)(nil)
 )
 
+// OptMaxConcurrency 限制同时处理的请求数（所有服务共享）：达到上限时暂停从 nats 接收请求，
+// 未处理的请求积压在 nats.Conn 的 pending 缓冲中（超出缓冲的会被丢弃，客户端将超时）；
+// 需要以错误拒绝多余的请求时应使用 limitmw 中间件
+func OptMaxConcurrency(n int) ServerOption {
+	return func(server *natsServer) {
+		if n > 0 {
+			server.sem = make(chan struct{}, n)
+		}
+	}
+}
+
 // NewServer 使用 nats.Conn(s) 创建一个 RPCTransportServer；errHandler 用于处理内部错误，例如记录日志
-func NewServer(conns []*nats.Conn, errHandler func(error)) libsvc.RPCTransportServer {
+func NewServer(conns []*nats.Conn, errHandler func(error), opts ...ServerOption) libsvc.RPCTransportServer {
 	if len(conns) == 0 {
 		panic(errNoConns)
 	}
@@ -56,11 +168,16 @@ func NewServer(conns []*nats.Conn, errHandler func(error)) libsvc.RPCTransportSe
 		errHandler = func(error) {}
 	}
 
-	return &natsServer{
+	server := &natsServer{
 		errHandler: errHandler,
 		conns:      conns,
 		subs:       make(map[string][]*nats.Subscription),
+		inflight:   make(map[string]context.CancelFunc),
+	}
+	for _, opt := range opts {
+		opt(server)
 	}
+	return server
 }
 
 func (server *natsServer) Register(svcName string, handler libsvc.RPCTransportHandler) error {
@@ -83,14 +200,25 @@ func (server *natsServer) Register(svcName string, handler libsvc.RPCTransportHa
 			subj(svcName),
 			group,
 			func(reqMsg *nats.Msg) {
+				if server.sem != nil {
+					// 阻塞在这里即暂停接收该订阅的请求
+					server.sem <- struct{}{}
+				}
 				go func() {
+					if server.sem != nil {
+						defer func() { <-server.sem }()
+					}
+					ctx, cancel := server.track(reqMsg.Reply)
+					defer cancel()
 					reqReader := bytes.NewBuffer(reqMsg.Data)
-					respWriter := &bytes.Buffer{}
-					err := handler.Invoke(context.Background(), reqReader, respWriter)
+					respWriter := newRespWriter(conn, reqMsg.Reply)
+					err := handler.Invoke(ctx, reqReader, respWriter)
 					if err != nil {
 						server.errHandler(err)
 					}
-					conn.Publish(reqMsg.Reply, respWriter.Bytes())
+					if err := respWriter.Close(); err != nil {
+						server.errHandler(err)
+					}
 				}()
 			},
 		)
@@ -102,6 +230,21 @@ func (server *natsServer) Register(svcName string, handler libsvc.RPCTransportHa
 			return err
 		}
 		subs = append(subs, sub)
+
+		// 客户端取消请求时会发送请求的 reply subject 到 cancel subject，每个服务端都需要收到
+		sub, err = conn.Subscribe(
+			cancelSubj(svcName),
+			func(cancelMsg *nats.Msg) {
+				server.cancel(string(cancelMsg.Data))
+			},
+		)
+		if err != nil {
+			for _, sub := range subs {
+				sub.Unsubscribe()
+			}
+			return err
+		}
+		subs = append(subs, sub)
 	}
 
 	server.subs[svcName] = subs
@@ -152,6 +295,34 @@ func (server *natsServer) Close() {
 
 }
 
+// track 返回处理请求所用的 ctx，在处理完前可以通过 cancel subject 取消
+func (server *natsServer) track(reply string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// notification 没有 reply，无法取消
+	if reply == "" {
+		return ctx, cancel
+	}
+	server.inflightMu.Lock()
+	server.inflight[reply] = cancel
+	server.inflightMu.Unlock()
+	return ctx, func() {
+		server.inflightMu.Lock()
+		delete(server.inflight, reply)
+		server.inflightMu.Unlock()
+		cancel()
+	}
+}
+
+// cancel 取消处理中的请求
+func (server *natsServer) cancel(reply string) {
+	server.inflightMu.Lock()
+	cancel := server.inflight[reply]
+	server.inflightMu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
 // NewClient 使用 nats.Conn(s) 创建一个 RPCTransportClient
 func NewClient(conns []*nats.Conn) libsvc.RPCTransportClient {
 	if len(conns) == 0 {
@@ -162,22 +333,26 @@ func NewClient(conns []*nats.Conn) libsvc.RPCTransportClient {
 			panic(errConnNil)
 		}
 	}
+	muxes := make([]*respMux, 0, len(conns))
+	for _, conn := range conns {
+		muxes = append(muxes, newRespMux(conn))
+	}
 	return &natsClient{
-		conns: conns,
+		muxes: muxes,
 	}
 }
 
 func (client *natsClient) Discover(ctx context.Context, svcName string) (requestor libsvc.RPCTransportRequestor, err error) {
 	client.mu.RLock()
-	if len(client.conns) == 0 {
+	if len(client.muxes) == 0 {
 		client.mu.RUnlock()
 		return nil, errClientClosed
 	}
-	conn := client.conns[rand.Intn(len(client.conns))]
+	mux := client.muxes[rand.Intn(len(client.muxes))]
 	client.mu.RUnlock()
 
 	return &natsRequestor{
-		conn:    conn,
+		mux:     mux,
 		svcName: svcName,
 	}, nil
 }
@@ -185,24 +360,271 @@ func (client *natsClient) Discover(ctx context.Context, svcName string) (request
 func (client *natsClient) Close() {
 	client.mu.Lock()
 	defer client.mu.Unlock()
-	if len(client.conns) == 0 {
+	if len(client.muxes) == 0 {
 		panic(errClientClosed)
 	}
-	client.conns = nil
+	for _, mux := range client.muxes {
+		mux.close()
+	}
+	client.muxes = nil
 }
 
+// Invoke 实现 libsvc.RPCTransportRequestor 接口；ctx 结束时会按 reply subject（包含请求的 token）通知服务端取消处理
 func (requestor *natsRequestor) Invoke(ctx context.Context, writeReq func(io.Writer) error) (respReader io.Reader, err error) {
+	call, err := requestor.call(writeReq, false)
+	if err != nil {
+		return nil, err
+	}
+	defer call.close()
+
+	respMsg, err := call.next(ctx)
+	if err != nil {
+		call.cancel()
+		return nil, err
+	}
+	return bytes.NewBuffer(respMsg.Data), nil
+}
+
+// Notify 实现 libsvc.RPCTransportNotifier 接口，使用不带 reply 的 Publish 发送请求
+func (requestor *natsRequestor) Notify(ctx context.Context, writeReq func(io.Writer) error) error {
+	reqWriter := &bytes.Buffer{}
+	if err := writeReq(reqWriter); err != nil {
+		return err
+	}
+	if err := requestor.mux.conn.Publish(subj(requestor.svcName), reqWriter.Bytes()); err != nil {
+		return libsvc.Unavailable(err)
+	}
+	return nil
+}
+
+func (requestor *natsRequestor) InvokeStream(ctx context.Context, writeReq func(io.Writer) error) (libsvc.RPCTransportStream, error) {
+	call, err := requestor.call(writeReq, true)
+	if err != nil {
+		return nil, err
+	}
+	return &natsStream{
+		ctx:  ctx,
+		call: call,
+	}, nil
+}
+
+// call 在 respMux 上登记一个新的 token 并发送请求
+func (requestor *natsRequestor) call(writeReq func(io.Writer) error, stream bool) (*natsCall, error) {
 	reqWriter := &bytes.Buffer{}
 	if err := writeReq(reqWriter); err != nil {
 		return nil, err
 	}
-	respMsg, err := requestor.conn.RequestWithContext(ctx, subj(requestor.svcName), reqWriter.Bytes())
+
+	size := 1
+	if stream {
+		size = streamBufferSize
+	}
+	mux := requestor.mux
+	token, resp, err := mux.add(size)
 	if err != nil {
 		return nil, err
 	}
-	return bytes.NewBuffer(respMsg.Data), nil
+	reply := mux.prefix + token
+	if stream {
+		reply += streamReplySuffix
+	}
+	if err := mux.conn.PublishRequest(subj(requestor.svcName), reply, reqWriter.Bytes()); err != nil {
+		mux.remove(token)
+		return nil, libsvc.Unavailable(err)
+	}
+	return &natsCall{
+		mux:     mux,
+		svcName: requestor.svcName,
+		token:   token,
+		reply:   reply,
+		resp:    resp,
+	}, nil
+}
+
+// next 等待下一个回复
+func (call *natsCall) next(ctx context.Context) (*nats.Msg, error) {
+	select {
+	case msg, ok := <-call.resp.msgs:
+		if !ok {
+			return nil, call.resp.err
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// cancel 通知服务端取消处理该请求，尽力而为
+func (call *natsCall) cancel() {
+	call.mux.conn.Publish(cancelSubj(call.svcName), []byte(call.reply))
+}
+
+// close 注销 token，之后收到的回复会被丢弃
+func (call *natsCall) close() {
+	call.mux.remove(call.token)
+}
+
+func newRespMux(conn *nats.Conn) *respMux {
+	return &respMux{
+		conn:   conn,
+		prefix: nats.NewInbox() + ".",
+		calls:  make(map[string]*respCall),
+	}
+}
+
+// add 分配一个 token 并登记接收回复的缓冲，size 为缓冲的大小
+func (mux *respMux) add(size int) (string, *respCall, error) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	if mux.closed {
+		return "", nil, errClientClosed
+	}
+	if mux.sub == nil {
+		sub, err := mux.conn.Subscribe(mux.prefix+">", mux.dispatch)
+		if err != nil {
+			return "", nil, libsvc.Unavailable(err)
+		}
+		mux.sub = sub
+	}
+	mux.next++
+	token := strconv.FormatUint(mux.next, 36)
+	resp := &respCall{
+		msgs: make(chan *nats.Msg, size),
+	}
+	mux.calls[token] = resp
+	return token, resp, nil
+}
+
+func (mux *respMux) remove(token string) {
+	mux.mu.Lock()
+	delete(mux.calls, token)
+	mux.mu.Unlock()
+}
+
+// dispatch 按 token 分发回复，不会阻塞：缓冲满了的请求被注销，以 errFrameGap 结束
+func (mux *respMux) dispatch(msg *nats.Msg) {
+	token := strings.TrimSuffix(strings.TrimPrefix(msg.Subject, mux.prefix), streamReplySuffix)
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	resp := mux.calls[token]
+	if resp == nil {
+		// 已经结束的请求
+		return
+	}
+	select {
+	case resp.msgs <- msg:
+	default:
+		delete(mux.calls, token)
+		resp.err = libsvc.Unavailable(errFrameGap)
+		close(resp.msgs)
+	}
+}
+
+// close 退订，等待中的请求以 errClientClosed 结束
+func (mux *respMux) close() {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	mux.closed = true
+	if mux.sub != nil {
+		mux.sub.Unsubscribe()
+	}
+	for _, resp := range mux.calls {
+		resp.err = errClientClosed
+		close(resp.msgs)
+	}
+	mux.calls = nil
+}
+
+func (stream *natsStream) Next() (io.Reader, error) {
+	if stream.end {
+		return nil, io.EOF
+	}
+	msg, err := stream.call.next(stream.ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg.Data) < frameHeaderSize {
+		return nil, errBadFrame
+	}
+
+	// 序号不连续说明有帧丢失了（例如接收太慢）
+	if binary.BigEndian.Uint32(msg.Data[1:frameHeaderSize]) != stream.seq {
+		return nil, libsvc.Unavailable(errFrameGap)
+	}
+	stream.seq++
+
+	payload := msg.Data[frameHeaderSize:]
+	switch msg.Data[0] {
+	case frameData:
+		return bytes.NewBuffer(payload), nil
+	case frameEnd:
+		stream.end = true
+		if len(payload) == 0 {
+			return nil, io.EOF
+		}
+		return bytes.NewBuffer(payload), nil
+	default:
+		return nil, errBadFrame
+	}
+}
+
+// Close 释放资源，若流还没有结束则通知服务端取消处理
+func (stream *natsStream) Close() {
+	if !stream.end {
+		stream.call.cancel()
+	}
+	stream.call.close()
+}
+
+// newRespWriter 按 reply subject 创建 respWriter
+func newRespWriter(conn *nats.Conn, reply string) respWriter {
+	w := natsRespWriter{
+		conn:  conn,
+		reply: reply,
+	}
+	if strings.HasSuffix(reply, streamReplySuffix) {
+		return &natsStreamWriter{natsRespWriter: w}
+	}
+	return &w
+}
+
+// Close 在处理器返回后调用，将响应一次过发送
+func (w *natsRespWriter) Close() error {
+	// 没有 reply 的请求（notification）不需要响应
+	if w.reply == "" {
+		return nil
+	}
+	return w.conn.Publish(w.reply, w.Bytes())
+}
+
+// Flush 实现 libsvc.RPCTransportStreamWriter 接口，将已写入的数据作为一帧发送
+func (w *natsStreamWriter) Flush() error {
+	return w.publish(frameData)
+}
+
+// Close 在处理器返回后调用，发送带有未 Flush 的数据的结束帧
+func (w *natsStreamWriter) Close() error {
+	return w.publish(frameEnd)
+}
+
+func (w *natsStreamWriter) publish(frameType byte) error {
+	data := make([]byte, frameHeaderSize, frameHeaderSize+w.Len())
+	data[0] = frameType
+	binary.BigEndian.PutUint32(data[1:], w.seq)
+	data = append(data, w.Bytes()...)
+	w.Reset()
+	w.seq++
+	return w.conn.Publish(w.reply, data)
 }
 
 func subj(name string) string {
 	return subjectPrefix + name
 }
+
+func cancelSubj(name string) string {
+	return cancelSubjectPrefix + name
+}
@@ -0,0 +1,186 @@
+package libsvc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// TypedMethod 是一个带有出入参类型信息的 Method：GenInput 生成 *In，GenOutput 生成 *Out，
+// 这样出入参的类型检查可以在编译期完成；它同时实现了 Method 接口，因此可以跟非泛型的 API 混用
+type TypedMethod[In, Out any] struct {
+	name string
+}
+
+// TypedMethodHandlerFunc 是 TypedMethod 对应的强类型处理函数，它实现了 MethodHandler 接口
+type TypedMethodHandlerFunc[In, Out any] func(ctx context.Context, input *In, output *Out) error
+
+var (
+	_ Method        = (*TypedMethod[struct{}, struct{}])(nil)
+	_ MethodHandler = TypedMethodHandlerFunc[struct{}, struct{}](nil)
+)
+
+// NewTypedMethod 定义一个新的强类型方法，入参类型为 *In，出参类型为 *Out
+func NewTypedMethod[In, Out any](methodName string) *TypedMethod[In, Out] {
+	if !IsValidMethodName(methodName) {
+		panic(ErrBadMethodName)
+	}
+	return &TypedMethod[In, Out]{
+		name: methodName,
+	}
+}
+
+// Name 实现 Method 接口
+func (m *TypedMethod[In, Out]) Name() string {
+	return m.name
+}
+
+// GenInput 实现 Method 接口，返回 *In
+func (m *TypedMethod[In, Out]) GenInput() interface{} {
+	return new(In)
+}
+
+// GenOutput 实现 Method 接口，返回 *Out
+func (m *TypedMethod[In, Out]) GenOutput() interface{} {
+	return new(Out)
+}
+
+// AssertInputType 实现 Method 接口
+func (m *TypedMethod[In, Out]) AssertInputType(input interface{}) {
+	if _, ok := input.(*In); !ok {
+		panic(fmt.Errorf("Method %+q input expect %s but got %T", m.name,
+			reflect.TypeOf((*In)(nil)).String(), input))
+	}
+}
+
+// AssertOutputType 实现 Method 接口
+func (m *TypedMethod[In, Out]) AssertOutputType(output interface{}) {
+	if _, ok := output.(*Out); !ok {
+		panic(fmt.Errorf("Method %+q output expect %s but got %T", m.name,
+			reflect.TypeOf((*Out)(nil)).String(), output))
+	}
+}
+
+// HasMethod 实现 Interface 接口
+func (m *TypedMethod[In, Out]) HasMethod(method Method) bool {
+	return Method(m) == method
+}
+
+// MethodByName 实现 Interface 接口
+func (m *TypedMethod[In, Out]) MethodByName(methodName string) Method {
+	if methodName == m.name {
+		return m
+	}
+	return nil
+}
+
+// Methods 实现 Interface 接口
+func (m *TypedMethod[In, Out]) Methods() []Method {
+	return []Method{m}
+}
+
+// Handler 将强类型的处理函数转换为 MethodHandler，可直接用于 NewLocalService：
+//
+//	NewLocalService("svc", m, m.Handler(func(ctx context.Context, input *In, output *Out) error {
+//	  ...
+//	}))
+func (m *TypedMethod[In, Out]) Handler(fn func(ctx context.Context, input *In, output *Out) error) MethodHandler {
+	return TypedMethodHandlerFunc[In, Out](fn)
+}
+
+// Invoke 使用 input 调用服务 svc 的该方法，成功时返回出参
+func (m *TypedMethod[In, Out]) Invoke(ctx context.Context, svc Service, input *In) (*Out, error) {
+	output := new(Out)
+	if err := svc.Invoke(ctx, m, input, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// Notify 使用 input 以 notification 的方式调用服务 svc 的该方法，见 libsvc.Notify
+func (m *TypedMethod[In, Out]) Notify(ctx context.Context, svc Service, input *In) error {
+	return Notify(ctx, svc, m, input)
+}
+
+// Invoke 实现 MethodHandler 接口
+func (fn TypedMethodHandlerFunc[In, Out]) Invoke(ctx context.Context, input, output interface{}) error {
+	return fn(ctx, input.(*In), output.(*Out))
+}
+
+// TypedStreamMethod 是一个带有出入参类型信息的流式方法
+type TypedStreamMethod[In, Out any] struct {
+	TypedMethod[In, Out]
+}
+
+// TypedOutputStream 用于依次接收 TypedStreamMethod 的出参
+type TypedOutputStream[Out any] struct {
+	stream OutputStream
+}
+
+var (
+	_ StreamMethod = (*TypedStreamMethod[struct{}, struct{}])(nil)
+)
+
+// NewTypedStreamMethod 定义一个新的强类型流式方法，入参类型为 *In，每个出参的类型为 *Out
+func NewTypedStreamMethod[In, Out any](methodName string) *TypedStreamMethod[In, Out] {
+	return &TypedStreamMethod[In, Out]{
+		TypedMethod: *NewTypedMethod[In, Out](methodName),
+	}
+}
+
+// IsStream 实现 StreamMethod 接口
+func (m *TypedStreamMethod[In, Out]) IsStream() bool {
+	return true
+}
+
+// HasMethod 实现 Interface 接口
+func (m *TypedStreamMethod[In, Out]) HasMethod(method Method) bool {
+	return Method(m) == method
+}
+
+// MethodByName 实现 Interface 接口
+func (m *TypedStreamMethod[In, Out]) MethodByName(methodName string) Method {
+	if methodName == m.name {
+		return m
+	}
+	return nil
+}
+
+// Methods 实现 Interface 接口
+func (m *TypedStreamMethod[In, Out]) Methods() []Method {
+	return []Method{m}
+}
+
+// Handler 将强类型的流式处理函数转换为 StreamHandler，可直接用于 NewLocalService
+func (m *TypedStreamMethod[In, Out]) Handler(fn func(ctx context.Context, input *In, send func(output *Out) error) error) StreamHandler {
+	return StreamHandlerFunc(func(ctx context.Context, input interface{}, send func(interface{}) error) error {
+		return fn(ctx, input.(*In), func(output *Out) error {
+			return send(output)
+		})
+	})
+}
+
+// Invoke 使用 input 调用服务 svc 的该流式方法，返回的流用于依次接收出参
+func (m *TypedStreamMethod[In, Out]) Invoke(ctx context.Context, svc Service, input *In) (*TypedOutputStream[Out], error) {
+	stream, err := InvokeStream(ctx, svc, m, input)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedOutputStream[Out]{
+		stream: stream,
+	}, nil
+}
+
+// Recv 接收下一个出参，流正常结束时返回 io.EOF
+func (s *TypedOutputStream[Out]) Recv() (*Out, error) {
+	output, err := s.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return output.(*Out), nil
+}
+
+// Close 提前终止流并释放资源
+func (s *TypedOutputStream[Out]) Close() {
+	s.stream.Close()
+}
@@ -0,0 +1,59 @@
+package libsvc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type addInput struct {
+	A int
+	B int
+}
+
+type addOutput struct {
+	Sum int
+}
+
+func TestTypedMethod(t *testing.T) {
+	a := assert.New(t)
+
+	a.Panics(func() {
+		NewTypedMethod[addInput, addOutput]("bad.method.*")
+	}, "Expect panic for bad method name")
+
+	add := NewTypedMethod[addInput, addOutput]("add")
+	a.IsType(&addInput{}, add.GenInput())
+	a.IsType(&addOutput{}, add.GenOutput())
+	a.NotPanics(func() {
+		add.AssertInputType(&addInput{})
+		add.AssertOutputType(&addOutput{})
+	})
+	a.Panics(func() {
+		add.AssertInputType(addInput{})
+	}, "Expect panic since input is not a pointer")
+	a.Panics(func() {
+		add.AssertOutputType(&addInput{})
+	}, "Expect panic since output type mismatch")
+
+	itf := NewInterface(add, noopMethod)
+	a.True(itf.HasMethod(add))
+	a.Equal(Method(add), itf.MethodByName("add"))
+	a.True(add.HasMethod(add))
+	a.False(add.HasMethod(noopMethod))
+
+	svc := NewLocalService("typed.svc", add, add.Handler(func(_ context.Context, input *addInput, output *addOutput) error {
+		output.Sum = input.A + input.B
+		return nil
+	}))
+	a.NoError(InprocServer().Register(svc))
+	defer InprocServer().Deregister(svc.Name())
+
+	output, err := add.Invoke(context.Background(), InprocClient().Make("typed.svc"), &addInput{A: 1, B: 2})
+	a.NoError(err)
+	a.Equal(3, output.Sum)
+
+	_, err = add.Invoke(context.Background(), InprocClient().Make("typed.svc.not.exists"), &addInput{})
+	a.Equal(ErrSvcNotFound, err)
+}
@@ -0,0 +1,2 @@
+// metricsutil 包含一个简单的指标（counter/gauge/histogram）注册表，可以通过 http.Handler 以 Prometheus 文本格式导出
+package metricsutil
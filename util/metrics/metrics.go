@@ -0,0 +1,387 @@
+package metricsutil
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// DefaultBuckets 为默认的 histogram 桶（单位一般为秒）
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// DefaultRegistry 为默认的注册表，进程内的各个组件默认都注册到这里，以便用一个 endpoint 导出
+	DefaultRegistry = NewRegistry()
+
+	// ErrMetricConflict 在以同一名字注册不同类型（或不同标签）的指标时 panic
+	ErrMetricConflict = errors.New("Metric conflict (duplicated name)")
+
+	// ErrLabelValues 在标签值的数量与标签名的数量不一致时 panic
+	ErrLabelValues = errors.New("Label values not match label names")
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// Registry 为指标注册表
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]*vec
+}
+
+// vec 为同一名字、不同标签值的一组指标
+type vec struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+	buckets    []float64
+
+	mu sync.RWMutex
+	// 标签值（以 \xff 连接）-> *value 或 *Histogram
+	series map[string]interface{}
+}
+
+// value 为 counter 或 gauge 的值
+type value struct {
+	labelValues []string
+	bits        uint64
+}
+
+// CounterVec 为一组 counter
+type CounterVec struct {
+	vec *vec
+}
+
+// Counter 为只增不减的计数
+type Counter struct {
+	v *value
+}
+
+// GaugeVec 为一组 gauge
+type GaugeVec struct {
+	vec *vec
+}
+
+// Gauge 为可增可减的值
+type Gauge struct {
+	v *value
+}
+
+// HistogramVec 为一组 histogram
+type HistogramVec struct {
+	vec *vec
+}
+
+// Histogram 统计观测值的分布
+type Histogram struct {
+	labelValues []string
+	upperBounds []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewRegistry 创建一个空的注册表
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics: make(map[string]*vec),
+	}
+}
+
+// Counter 注册（或返回已注册的）名为 name 的一组 counter；同名但类型或标签不同时 panic
+func (r *Registry) Counter(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{vec: r.register(name, help, typeCounter, labelNames, nil)}
+}
+
+// Gauge 注册（或返回已注册的）名为 name 的一组 gauge；同名但类型或标签不同时 panic
+func (r *Registry) Gauge(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{vec: r.register(name, help, typeGauge, labelNames, nil)}
+}
+
+// Histogram 注册（或返回已注册的）名为 name 的一组 histogram，buckets 为各个桶的上限（升序），为空时使用 DefaultBuckets
+// （已注册时忽略）；同名但类型或标签不同时 panic
+func (r *Registry) Histogram(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &HistogramVec{vec: r.register(name, help, typeHistogram, labelNames, buckets)}
+}
+
+func (r *Registry) register(name, help, typ string, labelNames []string, buckets []float64) *vec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v := r.metrics[name]; v != nil {
+		if v.typ != typ || strings.Join(v.labelNames, ",") != strings.Join(labelNames, ",") {
+			panic(ErrMetricConflict)
+		}
+		return v
+	}
+	v := &vec{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]interface{}),
+	}
+	r.metrics[name] = v
+	return v
+}
+
+// get 返回标签值对应的指标，不存在时用 create 创建
+func (v *vec) get(labelValues []string, create func() interface{}) interface{} {
+	if len(labelValues) != len(v.labelNames) {
+		panic(ErrLabelValues)
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.RLock()
+	s := v.series[key]
+	v.mu.RUnlock()
+	if s != nil {
+		return s
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s = v.series[key]; s == nil {
+		s = create()
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *vec) value(labelValues []string) *value {
+	return v.get(labelValues, func() interface{} {
+		return &value{labelValues: append([]string(nil), labelValues...)}
+	}).(*value)
+}
+
+// With 返回标签值对应的 counter，标签值的顺序同注册时的标签名
+func (cv *CounterVec) With(labelValues ...string) *Counter {
+	return &Counter{v: cv.vec.value(labelValues)}
+}
+
+// Inc 加一
+func (c *Counter) Inc() {
+	c.v.add(1)
+}
+
+// Add 加上 delta，delta 不能为负
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.v.add(delta)
+}
+
+// Value 返回当前值
+func (c *Counter) Value() float64 {
+	return c.v.get()
+}
+
+// With 返回标签值对应的 gauge，标签值的顺序同注册时的标签名
+func (gv *GaugeVec) With(labelValues ...string) *Gauge {
+	return &Gauge{v: gv.vec.value(labelValues)}
+}
+
+// Inc 加一
+func (g *Gauge) Inc() {
+	g.v.add(1)
+}
+
+// Dec 减一
+func (g *Gauge) Dec() {
+	g.v.add(-1)
+}
+
+// Add 加上 delta
+func (g *Gauge) Add(delta float64) {
+	g.v.add(delta)
+}
+
+// Set 设置当前值
+func (g *Gauge) Set(val float64) {
+	atomic.StoreUint64(&g.v.bits, math.Float64bits(val))
+}
+
+// Value 返回当前值
+func (g *Gauge) Value() float64 {
+	return g.v.get()
+}
+
+// With 返回标签值对应的 histogram，标签值的顺序同注册时的标签名
+func (hv *HistogramVec) With(labelValues ...string) *Histogram {
+	buckets := hv.vec.buckets
+	return hv.vec.get(labelValues, func() interface{} {
+		return &Histogram{
+			labelValues: append([]string(nil), labelValues...),
+			upperBounds: buckets,
+			counts:      make([]uint64, len(buckets)),
+		}
+	}).(*Histogram)
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(val float64) {
+	i := sort.SearchFloat64s(h.upperBounds, val)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += val
+}
+
+// Count 返回观测值的个数
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (v *value) add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&v.bits)
+		nv := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&v.bits, old, nv) {
+			return
+		}
+	}
+}
+
+func (v *value) get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.bits))
+}
+
+// Handler 返回一个以 Prometheus 文本格式导出所有指标的 http.Handler
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// WriteText 以 Prometheus 文本格式写出所有指标，指标按名字排序，同一指标的各个标签值按字典序排序
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	vecs := make([]*vec, 0, len(r.metrics))
+	for _, v := range r.metrics {
+		vecs = append(vecs, v)
+	}
+	r.mu.RUnlock()
+	sort.Slice(vecs, func(i, j int) bool {
+		return vecs[i].name < vecs[j].name
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, v := range vecs {
+		v.writeText(bw)
+	}
+	return bw.Flush()
+}
+
+func (v *vec) writeText(w *bufio.Writer) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		series = append(series, v.series[key])
+	}
+	v.mu.RUnlock()
+
+	if v.help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+	for _, s := range series {
+		switch s := s.(type) {
+		case *value:
+			v.writeSample(w, "", s.labelValues, "", s.get())
+		case *Histogram:
+			s.mu.Lock()
+			counts := append([]uint64(nil), s.counts...)
+			count, sum := s.count, s.sum
+			s.mu.Unlock()
+
+			cumulative := uint64(0)
+			for i, upperBound := range s.upperBounds {
+				cumulative += counts[i]
+				v.writeSample(w, "_bucket", s.labelValues, formatFloat(upperBound), float64(cumulative))
+			}
+			v.writeSample(w, "_bucket", s.labelValues, "+Inf", float64(count))
+			v.writeSample(w, "_sum", s.labelValues, "", sum)
+			v.writeSample(w, "_count", s.labelValues, "", float64(count))
+		}
+	}
+}
+
+// writeSample 写出一行样本，le 不为空时添加 le 标签
+func (v *vec) writeSample(w *bufio.Writer, suffix string, labelValues []string, le string, val float64) {
+	w.WriteString(v.name)
+	w.WriteString(suffix)
+	if len(labelValues) != 0 || le != "" {
+		w.WriteByte('{')
+		for i, labelValue := range labelValues {
+			if i != 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", v.labelNames[i], escapeLabelValue(labelValue))
+		}
+		if le != "" {
+			if len(labelValues) != 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "le=\"%s\"", le)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(val))
+	w.WriteByte('\n')
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
@@ -0,0 +1,56 @@
+package metricsutil
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	a := assert.New(t)
+	r := NewRegistry()
+
+	requests := r.Counter("requests_total", "Total requests.", "svc", "method")
+	requests.With("a", "x").Inc()
+	requests.With("a", "x").Add(2)
+	requests.With("a", "x").Add(-1)
+	requests.With("b", "q\"\n\\").Inc()
+	a.Equal(3.0, requests.With("a", "x").Value())
+
+	// 同名同类型返回已注册的
+	a.Equal(3.0, r.Counter("requests_total", "", "svc", "method").With("a", "x").Value())
+	a.PanicsWithValue(ErrMetricConflict, func() { r.Gauge("requests_total", "") })
+	a.PanicsWithValue(ErrMetricConflict, func() { r.Counter("requests_total", "", "svc") })
+	a.PanicsWithValue(ErrLabelValues, func() { requests.With("a") })
+
+	inflight := r.Gauge("inflight", "In-flight\nrequests.")
+	inflight.With().Inc()
+	inflight.With().Inc()
+	inflight.With().Dec()
+
+	dur := r.Histogram("dur_seconds", "", []float64{0.1, 1}, "svc")
+	dur.With("a").Observe(0.05)
+	dur.With("a").Observe(0.1)
+	dur.With("a").Observe(0.5)
+	dur.With("a").Observe(5)
+	a.Equal(uint64(4), dur.With("a").Count())
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	a.Equal("text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	a.Equal(`# TYPE dur_seconds histogram
+dur_seconds_bucket{svc="a",le="0.1"} 2
+dur_seconds_bucket{svc="a",le="1"} 3
+dur_seconds_bucket{svc="a",le="+Inf"} 4
+dur_seconds_sum{svc="a"} 5.65
+dur_seconds_count{svc="a"} 4
+# HELP inflight In-flight\nrequests.
+# TYPE inflight gauge
+inflight 1
+# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total{svc="a",method="x"} 3
+requests_total{svc="b",method="q\"\n\\"} 1
+`, w.Body.String())
+}
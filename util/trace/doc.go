@@ -0,0 +1,3 @@
+// traceutil 包含一个简单的分布式追踪实现：W3C trace context (traceparent/tracestate) 的解析与生成、Span 的记录与导出，
+// 以及为 HTTP 请求创建 Span 的中间件（可用于 chi.Router）
+package traceutil
@@ -0,0 +1,56 @@
+package traceutil
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+)
+
+const (
+	// TraceparentHeader 为 W3C traceparent 的 HTTP 头
+	TraceparentHeader = "traceparent"
+	// TracestateHeader 为 W3C tracestate 的 HTTP 头
+	TracestateHeader = "tracestate"
+)
+
+// HTTPMiddleware 为每个 HTTP 请求创建一个 server Span（父 Span 来自请求的 traceparent 头），
+// 处理器中发起的服务调用都会成为它的子 Span，例如：
+//
+//	router.Use(tracer.HTTPMiddleware)
+//
+// 若使用 chi.Router，Span 名使用路由的 pattern 而非实际的路径
+func (t *Tracer) HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote, _ := ParseTraceparent(r.Header.Get(TraceparentHeader), r.Header.Get(TracestateHeader))
+		ctx, span := t.Start(r.Context(), "HTTP "+r.Method, SpanKindServer, remote)
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		path := r.URL.Path
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			path = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.Name = "HTTP " + r.Method + " " + path
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.RequestURI())
+		span.SetAttribute("http.route", path)
+		span.SetAttribute("http.status_code", strconv.Itoa(status))
+		if status >= 500 {
+			span.SetError(errStatus(status))
+		}
+	})
+}
+
+type errStatus int
+
+func (err errStatus) Error() string {
+	return http.StatusText(int(err))
+}
@@ -0,0 +1,143 @@
+package traceutil
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// otlpFileExporter 将 Span 以 OTLP JSON 格式（每行一个 ExportTraceServiceRequest）写到 io.Writer，
+// 可以被 OpenTelemetry Collector 的 otlpjsonfile receiver 读取
+type otlpFileExporter struct {
+	mu          sync.Mutex
+	w           io.Writer
+	serviceName string
+}
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	TraceState        string         `json:"traceState,omitempty"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+const (
+	otlpScopeName = "github.com/huangjunwen/platform-kit/util/trace"
+
+	// OTLP 的 status code
+	otlpStatusOk    = 1
+	otlpStatusError = 2
+)
+
+var (
+	_ Exporter = (*otlpFileExporter)(nil)
+)
+
+// NewOTLPFileExporter 创建一个将 Span 以 OTLP JSON 格式逐行写到 w 的 Exporter，用于本地调试；
+// serviceName 为 resource 的 service.name 属性
+func NewOTLPFileExporter(w io.Writer, serviceName string) Exporter {
+	return &otlpFileExporter{
+		w:           w,
+		serviceName: serviceName,
+	}
+}
+
+// Export 实现 Exporter 接口
+func (e *otlpFileExporter) Export(span *Span) {
+	rs := otlpResourceSpans{}
+	rs.Resource.Attributes = []otlpKeyValue{newOTLPKeyValue("service.name", e.serviceName)}
+	ss := otlpScopeSpans{}
+	ss.Scope.Name = otlpScopeName
+	ss.Spans = []otlpSpan{toOTLPSpan(span)}
+	rs.ScopeSpans = []otlpScopeSpans{ss}
+
+	data, err := json.Marshal(&otlpRequest{
+		ResourceSpans: []otlpResourceSpans{rs},
+	})
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(data)
+}
+
+func toOTLPSpan(span *Span) otlpSpan {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	ret := otlpSpan{
+		TraceID:           span.SpanContext.TraceID.String(),
+		SpanID:            span.SpanContext.SpanID.String(),
+		TraceState:        span.SpanContext.TraceState,
+		Name:              span.Name,
+		Kind:              span.Kind,
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+		Status:            otlpStatus{Code: otlpStatusOk},
+	}
+	if span.ParentSpanID != (SpanID{}) {
+		ret.ParentSpanID = span.ParentSpanID.String()
+	}
+	keys := make([]string, 0, len(span.Attributes))
+	for key := range span.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		ret.Attributes = append(ret.Attributes, newOTLPKeyValue(key, span.Attributes[key]))
+	}
+	if span.Error {
+		ret.Status = otlpStatus{
+			Code:    otlpStatusError,
+			Message: span.StatusMessage,
+		}
+	}
+	return ret
+}
+
+func newOTLPKeyValue(key, value string) otlpKeyValue {
+	kv := otlpKeyValue{Key: key}
+	kv.Value.StringValue = value
+	return kv
+}
@@ -0,0 +1,244 @@
+package traceutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID 为 16 字节的 trace id
+type TraceID [16]byte
+
+// SpanID 为 8 字节的 span id
+type SpanID [8]byte
+
+// SpanContext 为需要跨进程传播的 Span 信息
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Sampled 表示该 trace 是否被采样（记录并导出）
+	Sampled bool
+	// TraceState 为 W3C tracestate，原样传播
+	TraceState string
+}
+
+// SpanKind 为 Span 的类型
+type SpanKind int
+
+const (
+	// SpanKindInternal 为进程内的操作
+	SpanKindInternal SpanKind = iota + 1
+	// SpanKindServer 为服务端处理请求
+	SpanKindServer
+	// SpanKindClient 为客户端发起请求
+	SpanKindClient
+)
+
+// Span 代表一次操作，由 Tracer.Start 创建，结束时需要调用 End
+type Span struct {
+	tracer *Tracer
+
+	Name         string
+	Kind         SpanKind
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	StartTime    time.Time
+
+	mu            sync.Mutex
+	EndTime       time.Time
+	Attributes    map[string]string
+	Error         bool
+	StatusMessage string
+}
+
+// Exporter 负责导出已结束的 Span
+type Exporter interface {
+	// Export 导出一个已结束且被采样的 Span，会被并发调用
+	Export(span *Span)
+}
+
+// Tracer 用于创建 Span
+type Tracer struct {
+	exporter    Exporter
+	sampleRatio float64
+}
+
+// TracerOption 是创建 Tracer 时的选项
+type TracerOption func(*Tracer)
+
+type spanKeyType struct{}
+
+var spanKey = spanKeyType{}
+
+var (
+	// DefaultTracer 为默认的 Tracer，它只传播 trace context 而不导出 Span；需要在创建各个中间件之前替换
+	DefaultTracer = NewTracer(nil)
+
+	// ErrBadTraceparent 在 traceparent 格式不正确时返回
+	ErrBadTraceparent = errors.New("Bad traceparent")
+)
+
+// OptSampleRatio 设置新 trace 的采样比例（[0, 1]），默认为 1；有上游的 trace 跟随上游的采样结果
+func OptSampleRatio(ratio float64) TracerOption {
+	return func(t *Tracer) {
+		t.sampleRatio = ratio
+	}
+}
+
+// NewTracer 创建一个 Tracer，exporter 为 nil 时不导出 Span
+func NewTracer(exporter Exporter, opts ...TracerOption) *Tracer {
+	t := &Tracer{
+		exporter:    exporter,
+		sampleRatio: 1,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Start 创建并开始一个 Span：remote 为从上游传播过来的 SpanContext（没有时为零值），无效时使用 ctx 中的 Span 作为父 Span，
+// 都没有时开始一个新的 trace；返回带有新 Span 的 ctx
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, remote SpanContext) (context.Context, *Span) {
+	parent := remote
+	if !parent.IsValid() {
+		if span := SpanFromContext(ctx); span != nil {
+			parent = span.SpanContext
+		}
+	}
+
+	span := &Span{
+		tracer:    t,
+		Name:      name,
+		Kind:      kind,
+		StartTime: time.Now(),
+	}
+	if parent.IsValid() {
+		span.SpanContext = SpanContext{
+			TraceID:    parent.TraceID,
+			Sampled:    parent.Sampled,
+			TraceState: parent.TraceState,
+		}
+		span.ParentSpanID = parent.SpanID
+	} else {
+		rand.Read(span.SpanContext.TraceID[:])
+		span.SpanContext.Sampled = t.sample(span.SpanContext.TraceID)
+	}
+	rand.Read(span.SpanContext.SpanID[:])
+	return ContextWithSpan(ctx, span), span
+}
+
+// sample 根据 trace id 决定是否采样，同一 trace id 的结果总是相同
+func (t *Tracer) sample(traceID TraceID) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	if t.sampleRatio <= 0 {
+		return false
+	}
+	return float64(binary.BigEndian.Uint64(traceID[8:])>>11)/(1<<53) < t.sampleRatio
+}
+
+// SpanFromContext 返回 ctx 中的 Span，没有时返回 nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// ContextWithSpan 返回带有 span 的 ctx
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey, span)
+}
+
+// SetAttribute 设置 Span 的属性
+func (span *Span) SetAttribute(key, value string) {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	if span.Attributes == nil {
+		span.Attributes = make(map[string]string)
+	}
+	span.Attributes[key] = value
+}
+
+// SetError 将 Span 标记为失败，err 为 nil 时不做任何事
+func (span *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	span.Error = true
+	span.StatusMessage = err.Error()
+}
+
+// End 结束 Span，若被采样则导出；重复调用无效
+func (span *Span) End() {
+	span.mu.Lock()
+	if !span.EndTime.IsZero() {
+		span.mu.Unlock()
+		return
+	}
+	span.EndTime = time.Now()
+	span.mu.Unlock()
+
+	if span.SpanContext.Sampled && span.tracer.exporter != nil {
+		span.tracer.exporter.Export(span)
+	}
+}
+
+// IsValid 返回 trace id 跟 span id 是否都非零
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent 返回 W3C traceparent，例如 "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent 解析 W3C traceparent，tracestate 原样保存
+func ParseTraceparent(traceparent, tracestate string) (SpanContext, error) {
+	sc := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, ErrBadTraceparent
+	}
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) || !sc.IsValid() {
+		return SpanContext{}, ErrBadTraceparent
+	}
+	flags := [1]byte{}
+	if !decodeHex(flags[:], parts[3]) {
+		return SpanContext{}, ErrBadTraceparent
+	}
+	sc.Sampled = flags[0]&1 == 1
+	sc.TraceState = tracestate
+	return sc, nil
+}
+
+// String 返回小写的十六进制
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// String 返回小写的十六进制
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != len(dst)*2 || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
@@ -0,0 +1,148 @@
+package traceutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (r *recorder) Export(span *Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+func TestTraceparent(t *testing.T) {
+	a := assert.New(t)
+
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "k=v")
+	a.NoError(err)
+	a.True(sc.IsValid())
+	a.True(sc.Sampled)
+	a.Equal("4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	a.Equal("00f067aa0ba902b7", sc.SpanID.String())
+	a.Equal("k=v", sc.TraceState)
+	a.Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	// 未来的版本可以有更多的字段
+	_, err = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-xx", "")
+	a.NoError(err)
+
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-xx",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(s, "")
+		a.Equal(ErrBadTraceparent, err, s)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	a := assert.New(t)
+	rec := &recorder{}
+	tracer := NewTracer(rec)
+
+	ctx, root := tracer.Start(context.Background(), "root", SpanKindInternal, SpanContext{})
+	a.True(root.SpanContext.IsValid())
+	a.True(root.SpanContext.Sampled)
+	a.Equal(SpanID{}, root.ParentSpanID)
+
+	// 子 Span
+	_, child := tracer.Start(ctx, "child", SpanKindClient, SpanContext{})
+	a.Equal(root.SpanContext.TraceID, child.SpanContext.TraceID)
+	a.Equal(root.SpanContext.SpanID, child.ParentSpanID)
+	child.SetError(errors.New("oops"))
+	child.End()
+	child.End()
+	root.End()
+	a.Len(rec.spans, 2)
+
+	// 上游的 SpanContext 优先，且跟随上游的采样结果
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "")
+	_, span := tracer.Start(ctx, "remote", SpanKindServer, remote)
+	a.Equal(remote.TraceID, span.SpanContext.TraceID)
+	a.Equal(remote.SpanID, span.ParentSpanID)
+	span.End()
+	a.Len(rec.spans, 2)
+
+	// 采样比例
+	_, span = NewTracer(rec, OptSampleRatio(0)).Start(context.Background(), "x", SpanKindInternal, SpanContext{})
+	a.False(span.SpanContext.Sampled)
+}
+
+func TestOTLPFileExporter(t *testing.T) {
+	a := assert.New(t)
+	buf := &bytes.Buffer{}
+	tracer := NewTracer(NewOTLPFileExporter(buf, "test"))
+
+	ctx, root := tracer.Start(context.Background(), "root", SpanKindServer, SpanContext{})
+	_, child := tracer.Start(ctx, "child", SpanKindClient, SpanContext{})
+	child.SetAttribute("k", "v")
+	child.SetError(errors.New("oops"))
+	child.End()
+	root.End()
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	a.Len(lines, 2)
+	req := otlpRequest{}
+	a.NoError(json.Unmarshal(lines[0], &req))
+	a.Equal("service.name", req.ResourceSpans[0].Resource.Attributes[0].Key)
+	a.Equal("test", req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+	span := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	a.Equal("child", span.Name)
+	a.Equal(SpanKindClient, span.Kind)
+	a.Equal(root.SpanContext.TraceID.String(), span.TraceID)
+	a.Equal(root.SpanContext.SpanID.String(), span.ParentSpanID)
+	a.Equal("k", span.Attributes[0].Key)
+	a.Equal(otlpStatus{Code: otlpStatusError, Message: "oops"}, span.Status)
+	a.Contains(string(lines[1]), `"status":{"code":1}`)
+	a.NotContains(string(lines[1]), `parentSpanId`)
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	a := assert.New(t)
+	rec := &recorder{}
+	tracer := NewTracer(rec)
+
+	inner := (*Span)(nil)
+	router := chi.NewRouter()
+	router.Use(tracer.HTTPMiddleware)
+	router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, inner = tracer.Start(r.Context(), "inner", SpanKindClient, SpanContext{})
+		inner.End()
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	req := httptest.NewRequest("GET", "/users/1?x=y", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	a.Len(rec.spans, 2)
+	span := rec.spans[1]
+	a.Equal("HTTP GET /users/{id}", span.Name)
+	a.Equal(SpanKindServer, span.Kind)
+	a.Equal("4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID.String())
+	a.Equal("00f067aa0ba902b7", span.ParentSpanID.String())
+	a.Equal(span.SpanContext.SpanID, inner.ParentSpanID)
+	a.Equal("/users/1?x=y", span.Attributes["http.target"])
+	a.Equal("502", span.Attributes["http.status_code"])
+	a.True(span.Error)
+}